@@ -12,9 +12,14 @@ import (
 	"syscall"
 
 	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/history"
+	"github.com/led0nk/ark-overseer/internal/journal"
+	"github.com/led0nk/ark-overseer/internal/livestate"
 	"github.com/led0nk/ark-overseer/internal/observer"
 	"github.com/led0nk/ark-overseer/internal/server"
 	"github.com/led0nk/ark-overseer/internal/services"
+	"github.com/led0nk/ark-overseer/internal/services/mqtt"
+	"github.com/led0nk/ark-overseer/internal/sqlite"
 	"github.com/led0nk/ark-overseer/internal/storage"
 	"github.com/led0nk/ark-overseer/internal/storagewrapper"
 	"github.com/led0nk/ark-overseer/pkg/config"
@@ -29,20 +34,38 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:], os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	var (
 		addr        = flag.String("addr", "localhost:8080", "server port")
 		grpcAddr    = flag.String("grpc", "", "grpc address, e.g. localhost:4317")
-		dbPath      = flag.String("db", "testdata", "path to the database")
-		blPath      = flag.String("blacklist", "testdata", "path to the blacklist")
+		dbURL       = flag.String("db", "testdata", "database url, e.g. file:///etc/ark-overseer, memory:// or sqlite:///etc/ark-overseer/overseer.db (a plain path is a file url, memory:// keeps blacklist, history and journal in a temporary directory)")
+		blPath      = flag.String("blacklist", "testdata", "path to the blacklist, ignored with -db memory://")
+		dsn         = flag.String("dsn", "", "deprecated, use -db sqlite://<path>")
+		importJSON  = flag.Bool("import-json", false, "import cluster.json and blacklist.json once into the sqlite database")
 		domain      = flag.String("domain", "127.0.0.1", "given domain for cookies/mail")
 		logLevelStr = flag.String("loglevel", "INFO", "define the level for logs")
 		configPath  = flag.String("config", "config", "path to config-file")
+		keyFile     = flag.String("config-key", "", "key file for the secrets in config.yaml, defaults to config.key next to it (overridden by $"+config.KeyEnv+")")
+		retention   = history.DefaultRetention()
+		rotation    = journal.DefaultRotation()
 		logLevel    slog.Level
 		shutdownWg  sync.WaitGroup
 		initWg      sync.WaitGroup
 		listenerWg  sync.WaitGroup
 	)
+	flag.DurationVar(&retention.Raw, "history-raw", retention.Raw, "how long raw history samples are kept")
+	flag.DurationVar(&retention.FiveMinute, "history-5m", retention.FiveMinute, "how long 5 minute history rollups are kept")
+	flag.DurationVar(&retention.Hourly, "history-1h", retention.Hourly, "how long hourly history rollups are kept")
+	flag.Int64Var(&rotation.MaxSize, "journal-size", rotation.MaxSize, "size in bytes after which the event journal is rotated")
+	flag.IntVar(&rotation.MaxFiles, "journal-files", rotation.MaxFiles, "number of rotated event journal files that are kept")
 	flag.Parse()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -57,7 +80,21 @@ func main() {
 	logger.Info("server address", "addr", *addr)
 	logger.Info("grpc address", "grpcaddr", *grpcAddr)
 	logger.Info("level for logging", "loglevel", *logLevelStr)
-	logger.Info("path to database", "db", *dbPath)
+	if *dsn != "" {
+		logger.Warn("-dsn is deprecated, use -db sqlite://<path>", "dsn", *dsn)
+		*dbURL = "sqlite://" + *dsn
+	}
+
+	logger.Info("database", "db", *dbURL)
+	if ephemeral(*dbURL) {
+		tmp, err := os.MkdirTemp("", "ark-overseer-")
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to create temporary data directory", "error", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmp)
+		*blPath = tmp
+	}
 	logger.Info("path to config", "config", *configPath)
 	logger.Info("path to blacklist", "blacklist", *blPath)
 
@@ -69,13 +106,20 @@ func main() {
 	defer conn.Close()
 
 	eventManager := events.NewEventManager()
+	eventManager.SetDeadLetter(func(dl events.DeadLetter) {
+		logger.Warn("dropped event", "type", dl.Event.Type, "subscriber", dl.Subscriber, "policy", dl.Policy.String(), "reason", dl.Reason)
+	})
 	serviceManager := services.NewServiceManager(eventManager, &initWg)
 
-	database, blackList, obs, cfg, err := initServices(
+	database, blackList, hist, jrnl, obs, cfg, err := initServices(
 		ctx,
-		dbPath,
+		dbURL,
 		blPath,
+		importJSON,
 		configPath,
+		keyFile,
+		retention,
+		rotation,
 		eventManager,
 	)
 	if err != nil {
@@ -83,72 +127,194 @@ func main() {
 		os.Exit(1)
 	}
 
-	listenerWg.Add(2)
-	startEventListeners(ctx, eventManager, &listenerWg, &shutdownWg, serviceManager, obs)
+	publisher := mqtt.NewPublisher(mqttConfig(ctx, cfg))
+	err = publisher.Connect(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to connect to mqtt broker", "error", err)
+	}
+
+	listenerWg.Add(4)
+	startEventListeners(ctx, eventManager, &listenerWg, &shutdownWg, serviceManager, obs, jrnl, publisher)
 	listenerWg.Wait()
 
 	initWg.Add(2)
-	go func(config.Configuration) {
+	go func(cfg config.Configuration) {
 		defer initWg.Done()
-		eventManager.Publish(events.EventMessage{Type: "init.services", Payload: cfg})
+		section, err := cfg.GetSection(config.NotificationSection)
+		if err != nil {
+			logger.WarnContext(ctx, "no notification services configured", "error", err)
+		}
+		eventManager.Publish(ctx, events.ServicesInit{Section: section})
 	}(cfg)
 	initWg.Wait()
 
 	initWg.Add(1)
 	go func() {
 		defer initWg.Done()
-		eventManager.Publish(events.EventMessage{Type: "init"})
+		eventManager.Publish(ctx, events.Init{})
 	}()
 
-	srv := server.NewServer(*addr, *domain, database, blackList, cfg)
+	srv := server.NewServer(*addr, *domain, database, database, blackList, hist, jrnl, cfg, eventManager)
 	startHTTPServer(ctx, srv, &shutdownWg)
 
-	handleShutdown(ctx, cancel, &initWg, &shutdownWg, database)
+	handleShutdown(ctx, cancel, &initWg, &shutdownWg, database, hist, jrnl)
 }
 
 func initServices(
 	ctx context.Context,
-	dbpath *string,
+	dbURL *string,
 	blpath *string,
+	importJSON *bool,
 	configPath *string,
+	keyFile *string,
+	retention history.Retention,
+	rotation journal.Rotation,
 	eventManager *events.EventManager,
 ) (
-	storage.Database,
+	*storagewrapper.StorageWrapper,
 	blacklist.Blacklister,
+	history.Recorder,
+	*journal.FileJournal,
 	observer.Overseer,
 	config.Configuration,
 	error) {
 	var (
-		database  storage.Database
 		blackList blacklist.Blacklister
+		hist      history.Recorder
 		obs       observer.Overseer
 		cfg       config.Configuration
 	)
 
-	database, err := storage.NewServerStorage(ctx, filepath.Join(*dbpath, "cluster.json"))
+	database, err := storage.Open(ctx, *dbURL)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to open server storage: %w", err)
+	}
+
+	dir, err := dataDir(*dbURL, *blpath)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+
+	if sqliteStorage, ok := database.(*sqlite.ServerStorage); ok {
+		if *importJSON {
+			imported, err := sqliteStorage.DB().ImportJSON(
+				ctx,
+				filepath.Join(dir, "cluster.json"),
+				filepath.Join(*blpath, "blacklist.json"),
+			)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to import json files: %w", err)
+			}
+			slog.Default().InfoContext(ctx, "imported json files into sqlite database", "imported", imported)
+		}
+
+		blackList = sqlite.NewBlacklist(sqliteStorage.DB())
+	} else {
+		blackList, err = blacklist.NewBlacklist(filepath.Join(*blpath, "blacklist.json"))
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to create blacklist: %w", err)
+		}
+	}
+
+	storageWrapper := storagewrapper.NewStorageWrapper(database, livestate.NewMemoryStore(), eventManager)
+
+	hist, err = history.NewHistory(ctx, filepath.Join(dir, "history.json"), retention)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to create history: %w", err)
+	}
+
+	jrnl, err := journal.NewFileJournal(dir, rotation, eventManager)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to open event journal: %w", err)
+	}
+
+	err = seedStatuses(ctx, storageWrapper, jrnl)
+	if err != nil {
+		slog.Default().WarnContext(ctx, "failed to read the last server statuses from the journal", "error", err)
+	}
+
+	obs, err = observer.NewObserver(ctx, storageWrapper, storageWrapper, blackList, hist, eventManager)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to create observer: %w", err)
+	}
+
+	if *keyFile == "" {
+		*keyFile = filepath.Join(*configPath, "config.key")
+	}
+	key, err := config.LoadKey(*keyFile)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to load config key: %w", err)
+	}
+	cipher, err := config.NewCipher(key)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to create config cipher: %w", err)
+	}
+
+	cfg, err = config.NewConfiguration(filepath.Join(*configPath, "config.yaml"), cipher, eventManager)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("failed to create new server storage: %w", err)
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("failed to create config: %w", err)
 	}
 
-	storageWrapper := storagewrapper.NewStorageWrapper(database, eventManager)
-	database = storageWrapper
+	return storageWrapper, blackList, hist, jrnl, obs, cfg, nil
+}
 
-	blackList, err = blacklist.NewBlacklist(filepath.Join(*blpath, "blacklist.json"))
+// seedStatuses hands the last journaled status of every server to the
+// wrapper, so only statuses that changed while the application was down are
+// published again.
+func seedStatuses(ctx context.Context, wrapper *storagewrapper.StorageWrapper, jrnl *journal.FileJournal) error {
+	online := events.ServerStatusChanged{Online: true}.Topic()
+	entries, err := jrnl.Query(ctx, journal.Query{Types: []string{online, events.ServerStatusChanged{}.Topic()}})
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("failed to create blacklist: %w", err)
+		return err
 	}
 
-	obs, err = observer.NewObserver(ctx, database, blackList, eventManager)
+	// the entries are sorted from oldest to newest
+	for _, entry := range entries {
+		wrapper.SeedStatus(entry.ServerID, entry.Type == online)
+	}
+	return nil
+}
+
+// mqttConfig reads the mqtt section of the config, a missing or invalid
+// section disables the publisher.
+func mqttConfig(ctx context.Context, cfg config.Configuration) config.MQTT {
+	section, err := cfg.GetSection(config.MQTTSection)
+	if err != nil {
+		return config.DefaultMQTT()
+	}
+	mqttCfg, err := config.ParseMQTT(section)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("failed to create observer: %w", err)
+		slog.Default().ErrorContext(ctx, "invalid mqtt config, publisher disabled", "error", err)
+		return config.DefaultMQTT()
 	}
+	return mqttCfg
+}
 
-	cfg, err = config.NewConfiguration(filepath.Join(*configPath, "config.yaml"), eventManager)
+// ephemeral reports whether the database is kept in memory only. The
+// blacklist, history and journal are then kept in a temporary directory
+// that is removed on exit.
+func ephemeral(dbURL string) bool {
+	u, err := storage.ParseURL(dbURL)
+	return err == nil && u.Scheme == "memory"
+}
+
+// dataDir returns the directory next to the database that holds further
+// files such as history.json. Databases without a directory of their own
+// fall back to fallback.
+func dataDir(dbURL string, fallback string) (string, error) {
+	u, err := storage.ParseURL(dbURL)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("failed to create config: %w", err)
+		return "", err
 	}
 
-	return database, blackList, obs, cfg, nil
+	switch u.Scheme {
+	case "file":
+		return storage.Path(u), nil
+	case "sqlite":
+		return filepath.Dir(storage.Path(u)), nil
+	default:
+		return fallback, nil
+	}
 }
 
 func startHTTPServer(
@@ -169,17 +335,41 @@ func startEventListeners(
 	listenerWg, shutdownWg *sync.WaitGroup,
 	sm *services.ServiceManager,
 	obs observer.Overseer,
+	jrnl *journal.FileJournal,
+	publisher *mqtt.Publisher,
 ) {
 	shutdownWg.Add(1)
 	go func() {
 		defer shutdownWg.Done()
-		em.StartListening(ctx, sm, "serviceManager", func() { listenerWg.Done() })
+		em.StartListening(ctx, sm, "serviceManager", func() { listenerWg.Done() },
+			events.WithPolicy(events.Unbounded),
+			events.WithTopics(events.ServicesInit{}.Topic(), events.ConfigChanged{}.Topic()),
+		)
+	}()
+
+	shutdownWg.Add(1)
+	go func() {
+		defer shutdownWg.Done()
+		em.StartListening(ctx, obs, "observer", func() { listenerWg.Done() },
+			events.WithPolicy(events.Unbounded),
+			events.WithTopics(events.Init{}.Topic(), events.ServerAdded{}.Topic(), events.ServerDeleted{}.Topic()),
+		)
 	}()
 
 	shutdownWg.Add(1)
 	go func() {
 		defer shutdownWg.Done()
-		em.StartListening(ctx, obs, "observer", func() { listenerWg.Done() })
+		em.StartListening(ctx, jrnl, journal.SubscriberName, func() { listenerWg.Done() }, events.WithPolicy(events.Unbounded))
+	}()
+
+	shutdownWg.Add(1)
+	go func() {
+		defer shutdownWg.Done()
+		defer publisher.Disconnect()
+		em.StartListening(ctx, publisher, "mqtt", func() { listenerWg.Done() },
+			events.WithPolicy(events.Block),
+			events.WithTopics(publisher.Topics()...),
+		)
 	}()
 }
 
@@ -188,6 +378,8 @@ func handleShutdown(
 	cancel context.CancelFunc,
 	initWg, shutdownWg *sync.WaitGroup,
 	database storage.Database,
+	hist history.Recorder,
+	jrnl *journal.FileJournal,
 ) {
 	logger := slog.Default()
 	sigCh := make(chan os.Signal, 1)
@@ -210,6 +402,19 @@ func handleShutdown(
 		return
 	}
 
+	logger.InfoContext(ctx, "finally saving server history", "info", "shutdown")
+	err = hist.Save()
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to save server history", "error", err)
+		return
+	}
+
+	err = jrnl.Close()
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to close event journal", "error", err)
+		return
+	}
+
 	logger.InfoContext(ctx, "application stopped gracefully", "info", "shutdown")
 }
 
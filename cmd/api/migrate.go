@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/history"
+	"github.com/led0nk/ark-overseer/internal/storage"
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/schema"
+)
+
+// runMigrate upgrades cluster.json, history.json, blacklist.json and config.yaml to their
+// current schema versions. With -dry-run it only reports what would change.
+func runMigrate(args []string, out io.Writer) error {
+	var (
+		fs         = flag.NewFlagSet("migrate", flag.ExitOnError)
+		dryRun     = fs.Bool("dry-run", false, "report pending migrations without changing any file")
+		dbURL      = fs.String("db", "testdata", "database url or path")
+		blPath     = fs.String("blacklist", "testdata", "path to the blacklist")
+		configPath = fs.String("config", "config", "path to config-file")
+	)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	dir, err := dataDir(*dbURL, *blPath)
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		filename string
+		registry *schema.Registry
+	}{
+		{filepath.Join(dir, "cluster.json"), storage.Schema},
+		{filepath.Join(dir, "history.json"), history.Schema},
+		{filepath.Join(*blPath, "blacklist.json"), blacklist.Schema},
+		{filepath.Join(*configPath, "config.yaml"), config.Schema},
+	}
+
+	for _, file := range files {
+		err := migrateFile(file.filename, file.registry, *dryRun, out)
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", file.filename, err)
+		}
+	}
+	return nil
+}
+
+func migrateFile(filename string, registry *schema.Registry, dryRun bool, out io.Writer) error {
+	raw, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(out, "%s: not found, skipping\n", filename)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	version, steps, err := registry.Plan(raw)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Fprintf(out, "%s: up to date (version %d)\n", filename, version)
+		return nil
+	}
+
+	fmt.Fprintf(out, "%s: version %d -> %d\n", filename, version, registry.Version())
+	for _, step := range steps {
+		fmt.Fprintf(out, "  %d -> %d: %s\n", step.From, step.From+1, step.Description)
+	}
+
+	migrated, _, err := registry.Migrate(raw)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(out, "  would write %d bytes (currently %d), backup %s\n",
+			len(migrated), len(raw), schema.BackupPath(filename, version))
+		return nil
+	}
+
+	err = schema.Backup(filename, version)
+	if err != nil {
+		return err
+	}
+	err = atomicfile.WriteFile(filename, migrated, 0644, atomicfile.DefaultBackups)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "  migrated, backup written to %s\n", schema.BackupPath(filename, version))
+	return nil
+}
@@ -1,25 +1,80 @@
 package blacklist
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/google/uuid"
 	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
+	"github.com/led0nk/ark-overseer/pkg/schema"
+)
+
+// DefaultList is the watchlist used for entries without an explicit list.
+const DefaultList = "default"
+
+// MaxSightings limits the sighting history kept per tracked person.
+const MaxSightings = 100
+
+const (
+	// LogSuffix is appended to the name of the blacklist file to get the
+	// name of the log sightings are appended to between two writes of the
+	// whole file.
+	LogSuffix = ".log"
+	// maxLogEntries is the number of logged sightings after which they are
+	// written into the blacklist file and the log is emptied.
+	maxLogEntries = 1000
+)
+
+// Schema holds the on-disk versions of blacklist.json.
+var Schema = schema.NewRegistry(
+	"blacklist.json",
+	schema.JSON,
+	schema.Migration{
+		From:        0,
+		Description: "wrap the entries into a versioned envelope and assign them to the default watchlist",
+		Apply:       assignDefaultList,
+	},
+)
+
+var (
+	ErrNotFound  = errors.New("blacklist entry not found")
+	ErrDuplicate = errors.New("player is already on this watchlist")
+	ErrEmptyName = errors.New("player name must not be empty")
 )
 
 type Blacklister interface {
 	Create(context.Context, *model.BlacklistPlayers) (*model.BlacklistPlayers, error)
 	List(context.Context) []*model.BlacklistPlayers
+	GetByID(context.Context, uuid.UUID) (*model.BlacklistPlayers, error)
+	Update(context.Context, *model.BlacklistPlayers) error
+	Edit(context.Context, *model.BlacklistPlayers) (*model.BlacklistPlayers, error)
 	Delete(context.Context, uuid.UUID) error
+	RecordSighting(context.Context, uuid.UUID, model.Sighting) error
+}
+
+// logEntry is a line of the log.
+type logEntry struct {
+	PlayerID uuid.UUID `json:"playerID"`
+	model.Sighting
 }
 
+// Blacklist keeps the entries in memory and writes them to disk on every
+// change made by a user, keeping backups of the previous versions. Sightings
+// are appended to a log instead, which is folded into the file on the next
+// write. Loading replays the log on top of the file.
 type Blacklist struct {
 	filename  string
 	blacklist map[uuid.UUID]*model.BlacklistPlayers
+	logged    int
 	mu        sync.Mutex
 }
 
@@ -34,35 +89,165 @@ func NewBlacklist(filename string) (*Blacklist, error) {
 	return blacklist, nil
 }
 
+// save writes the blacklist to disk and keeps the previous version as a
+// backup. The caller must hold b.mu.
 func (b *Blacklist) save() error {
-	as_json, err := json.MarshalIndent(b.blacklist, "", "\t")
+	return b.write(atomicfile.DefaultBackups)
+}
+
+// write writes the blacklist to disk and removes the log, whose sightings
+// are part of it now. The caller must hold b.mu.
+func (b *Blacklist) write(backups int) error {
+	as_json, err := Schema.Encode(b.blacklist)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(b.filename, as_json, 0644)
+	err = atomicfile.WriteFile(b.filename, as_json, 0644, backups)
 	if err != nil {
 		return err
 	}
+	b.logged = 0
+
+	err = os.Remove(b.filename + LogSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
+// log appends a sighting to the log. Once the log holds maxLogEntries, the
+// blacklist is written instead, without a backup since only sightings
+// changed. The caller must hold b.mu.
+func (b *Blacklist) log(id uuid.UUID, sighting model.Sighting) error {
+	if b.logged >= maxLogEntries {
+		return b.write(0)
+	}
+
+	line, err := json.Marshal(logEntry{PlayerID: id, Sighting: sighting})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(b.filename+LogSuffix, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	b.logged++
+	return file.Sync()
+}
+
+// replay records the sightings of the log. Sightings that are already part
+// of the blacklist, because the log was not removed after the last write,
+// are skipped. The caller must hold b.mu.
+func (b *Blacklist) replay() error {
+	file, err := os.Open(b.filename + LogSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry logEntry
+		// a partially written last line after a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		b.logged++
+
+		player, exists := b.blacklist[entry.PlayerID]
+		if !exists || hasSighting(player.Sightings, entry.Sighting) {
+			continue
+		}
+		player.Sightings = recordSighting(player.Sightings, entry.Sighting)
+	}
+	return scanner.Err()
+}
+
 func (b *Blacklist) load() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	if _, err := os.Stat(b.filename); os.IsNotExist(err) {
-		err = os.MkdirAll(filepath.Dir(b.filename), 0644)
+		err = os.MkdirAll(filepath.Dir(b.filename), 0777)
 		if err != nil {
 			return err
 		}
-		err = b.save()
+		backups, err := atomicfile.Backups(b.filename)
 		if err != nil {
 			return err
 		}
+		if len(backups) == 0 {
+			err = b.save()
+			if err != nil {
+				return err
+			}
+		}
 	}
-	data, err := os.ReadFile(b.filename)
+
+	var version int
+	recovered, err := atomicfile.ReadFile(b.filename, func(data []byte) error {
+		blacklist := make(map[uuid.UUID]*model.BlacklistPlayers)
+		v, err := Schema.Decode(data, &blacklist)
+		if err != nil {
+			return err
+		}
+		b.blacklist = blacklist
+		version = v
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, &b.blacklist)
+	if recovered != "" {
+		slog.Default().Warn("recovered blacklist from backup", "file", b.filename, "backup", recovered)
+	}
+
+	err = b.replay()
+	if err != nil {
+		return err
+	}
+
+	if version < Schema.Version() {
+		err = schema.Backup(b.filename, version)
+		if err != nil {
+			return err
+		}
+		slog.Default().Info("migrating blacklist", "file", b.filename, "from", version, "to", Schema.Version())
+		return b.save()
+	}
+	return nil
+}
+
+func assignDefaultList(data any) (any, error) {
+	if data == nil {
+		return data, nil
+	}
+
+	entries, ok := data.(map[string]any)
+	if !ok {
+		return nil, errors.New("blacklist is not an object")
+	}
+	for _, entry := range entries {
+		player, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		if list, _ := player["list"].(string); list == "" {
+			player["list"] = DefaultList
+		}
+	}
+	return entries, nil
 }
 
 func (b *Blacklist) Create(
@@ -75,18 +260,100 @@ func (b *Blacklist) Create(
 	if player.ID == uuid.Nil {
 		player.ID = uuid.New()
 	}
+	if player.List == "" {
+		player.List = DefaultList
+	}
+	if _, exists := b.blacklist[player.ID]; exists {
+		return nil, fmt.Errorf("%w: id %s is taken", ErrDuplicate, player.ID)
+	}
 
-	b.blacklist[player.ID] = player
+	if err := b.validate(player); err != nil {
+		return nil, err
+	}
+
+	b.blacklist[player.ID] = player.Clone()
 	if err := b.save(); err != nil {
 		return nil, err
 	}
 	return player, nil
 }
 
+func (b *Blacklist) GetByID(ctx context.Context, id uuid.UUID) (*model.BlacklistPlayers, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	player, exists := b.blacklist[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return player.Clone(), nil
+}
+
+func (b *Blacklist) Update(ctx context.Context, player *model.BlacklistPlayers) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.blacklist[player.ID]; !exists {
+		return ErrNotFound
+	}
+	if player.List == "" {
+		player.List = DefaultList
+	}
+
+	if err := b.validate(player); err != nil {
+		return err
+	}
+
+	b.blacklist[player.ID] = player.Clone()
+	return b.save()
+}
+
+// Edit applies the user editable fields of the given entry (name, list,
+// server, aliases and Steam IDs) to the stored one and returns the result.
+// Sightings and scraped values are kept, even if recorded meanwhile.
+func (b *Blacklist) Edit(ctx context.Context, edit *model.BlacklistPlayers) (*model.BlacklistPlayers, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	player, exists := b.blacklist[edit.ID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	updated := player.Clone()
+	ApplyEdit(updated, edit.Clone())
+	if err := b.validate(updated); err != nil {
+		return nil, err
+	}
+
+	b.blacklist[updated.ID] = updated
+	if err := b.save(); err != nil {
+		return nil, err
+	}
+	return updated.Clone(), nil
+}
+
+// ApplyEdit copies the user editable fields of edit to player. The stores
+// use it to implement Edit.
+func ApplyEdit(player *model.BlacklistPlayers, edit *model.BlacklistPlayers) {
+	player.Name = edit.Name
+	player.List = edit.List
+	if player.List == "" {
+		player.List = DefaultList
+	}
+	player.Server = edit.Server
+	player.Aliases = edit.Aliases
+	player.SteamIDs = edit.SteamIDs
+}
+
 func (b *Blacklist) Delete(ctx context.Context, id uuid.UUID) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if _, exists := b.blacklist[id]; !exists {
+		return ErrNotFound
+	}
+
 	delete(b.blacklist, id)
 	if err := b.save(); err != nil {
 		return err
@@ -94,6 +361,98 @@ func (b *Blacklist) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// validate checks the entry against the current blacklist. The caller must
+// hold b.mu.
+func (b *Blacklist) validate(player *model.BlacklistPlayers) error {
+	existing := make([]*model.BlacklistPlayers, 0, len(b.blacklist))
+	for _, entry := range b.blacklist {
+		existing = append(existing, entry)
+	}
+	return Validate(player, existing)
+}
+
+// Validate checks the entry for an empty name and for another entry on the
+// same list sharing one of its names or aliases.
+func Validate(player *model.BlacklistPlayers, existing []*model.BlacklistPlayers) error {
+	if player.Name == "" {
+		return ErrEmptyName
+	}
+
+	names := make(map[string]bool)
+	for _, name := range player.Names() {
+		names[name] = true
+	}
+
+	for _, entry := range existing {
+		if entry.ID == player.ID || entry.List != player.List {
+			continue
+		}
+		for _, name := range entry.Names() {
+			if names[name] {
+				return ErrDuplicate
+			}
+		}
+	}
+	return nil
+}
+
+// RecordSighting adds a sighting to the history of the tracked person. A
+// sighting with a zero Left time opens a new entry, otherwise the latest
+// open entry for the same alias and server is closed. The sighting is
+// appended to the log, the blacklist file is not rewritten.
+func (b *Blacklist) RecordSighting(ctx context.Context, id uuid.UUID, sighting model.Sighting) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	player, exists := b.blacklist[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	player.Sightings = recordSighting(player.Sightings, sighting)
+	return b.log(id, sighting)
+}
+
+// hasSighting reports whether sightings already contain the join or leave
+// described by sighting.
+func hasSighting(sightings []*model.Sighting, sighting model.Sighting) bool {
+	for _, existing := range sightings {
+		if existing.Alias != sighting.Alias || existing.Server != sighting.Server {
+			continue
+		}
+		if sighting.Left.IsZero() && existing.Joined.Equal(sighting.Joined) {
+			return true
+		}
+		if !sighting.Left.IsZero() && existing.Left.Equal(sighting.Left) {
+			return true
+		}
+	}
+	return false
+}
+
+func recordSighting(sightings []*model.Sighting, sighting model.Sighting) []*model.Sighting {
+	result := make([]*model.Sighting, 0, len(sightings)+1)
+	result = append(result, sightings...)
+
+	if !sighting.Left.IsZero() {
+		for i := len(result) - 1; i >= 0; i-- {
+			open := result[i]
+			if open.Alias == sighting.Alias && open.Server == sighting.Server && open.Left.IsZero() {
+				closed := *open
+				closed.Left = sighting.Left
+				result[i] = &closed
+				return result
+			}
+		}
+	}
+
+	result = append(result, &sighting)
+	if len(result) > MaxSightings {
+		result = result[len(result)-MaxSightings:]
+	}
+	return result
+}
+
 func (b *Blacklist) List(ctx context.Context) []*model.BlacklistPlayers {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -101,7 +460,25 @@ func (b *Blacklist) List(ctx context.Context) []*model.BlacklistPlayers {
 	blacklist := make([]*model.BlacklistPlayers, 0, len(b.blacklist))
 
 	for _, player := range b.blacklist {
-		blacklist = append(blacklist, player)
+		blacklist = append(blacklist, player.Clone())
 	}
 	return blacklist
 }
+
+// Lists returns the sorted names of all watchlists referenced by the given
+// entries. The default list is always part of the result.
+func Lists(players []*model.BlacklistPlayers) []string {
+	seen := map[string]bool{DefaultList: true}
+	lists := []string{DefaultList}
+
+	for _, player := range players {
+		if player.List == "" || seen[player.List] {
+			continue
+		}
+		seen[player.List] = true
+		lists = append(lists, player.List)
+	}
+
+	sort.Strings(lists)
+	return lists
+}
@@ -5,9 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
+	"github.com/led0nk/ark-overseer/pkg/schema"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -101,3 +104,324 @@ func TestBlacklistCRUD(t *testing.T) {
 		})
 	}
 }
+
+func TestBlacklistUpdate(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	bl, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	player, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Test Player"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultList, player.List)
+
+	err = bl.Update(ctx, &model.BlacklistPlayers{ID: player.ID, Name: "Renamed Player", List: "enemies"})
+	assert.NoError(t, err)
+
+	updated, err := bl.GetByID(ctx, player.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed Player", updated.Name)
+	assert.Equal(t, "enemies", updated.List)
+
+	reloaded, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	persisted, err := reloaded.GetByID(ctx, player.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed Player", persisted.Name)
+}
+
+func TestBlacklistErrors(t *testing.T) {
+	ctx := context.Background()
+	unknownID := uuid.MustParse("0b0f6a3e-1d6b-4a53-9a0f-2b8e3f7a9c11")
+
+	tests := []struct {
+		name        string
+		run         func(bl *Blacklist, existing *model.BlacklistPlayers) error
+		expectedErr error
+	}{
+		{
+			name: "duplicate name on same list",
+			run: func(bl *Blacklist, _ *model.BlacklistPlayers) error {
+				_, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Test Player", List: "enemies"})
+				return err
+			},
+			expectedErr: ErrDuplicate,
+		},
+		{
+			name: "same name on another list",
+			run: func(bl *Blacklist, _ *model.BlacklistPlayers) error {
+				_, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Test Player", List: "friends"})
+				return err
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "duplicate id",
+			run: func(bl *Blacklist, existing *model.BlacklistPlayers) error {
+				_, err := bl.Create(ctx, &model.BlacklistPlayers{ID: existing.ID, Name: "Other Player", List: "friends"})
+				return err
+			},
+			expectedErr: ErrDuplicate,
+		},
+		{
+			name: "empty name",
+			run: func(bl *Blacklist, _ *model.BlacklistPlayers) error {
+				_, err := bl.Create(ctx, &model.BlacklistPlayers{})
+				return err
+			},
+			expectedErr: ErrEmptyName,
+		},
+		{
+			name: "update to duplicate name",
+			run: func(bl *Blacklist, existing *model.BlacklistPlayers) error {
+				_, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Test Player", List: "friends"})
+				if err != nil {
+					return err
+				}
+				return bl.Update(ctx, &model.BlacklistPlayers{ID: existing.ID, Name: "Test Player", List: "friends"})
+			},
+			expectedErr: ErrDuplicate,
+		},
+		{
+			name: "update unknown entry",
+			run: func(bl *Blacklist, _ *model.BlacklistPlayers) error {
+				return bl.Update(ctx, &model.BlacklistPlayers{ID: unknownID, Name: "Ghost"})
+			},
+			expectedErr: ErrNotFound,
+		},
+		{
+			name: "get unknown entry",
+			run: func(bl *Blacklist, _ *model.BlacklistPlayers) error {
+				_, err := bl.GetByID(ctx, unknownID)
+				return err
+			},
+			expectedErr: ErrNotFound,
+		},
+		{
+			name: "delete unknown entry",
+			run: func(bl *Blacklist, _ *model.BlacklistPlayers) error {
+				return bl.Delete(ctx, unknownID)
+			},
+			expectedErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createTempDir(t)
+			defer cleanupTempDir(t, dir)
+
+			bl, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+			assert.NoError(t, err)
+			existing, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Test Player", List: "enemies"})
+			assert.NoError(t, err)
+
+			err = tt.run(bl, existing)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestBlacklistAliases(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	bl, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123", "Human"}})
+	assert.NoError(t, err)
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "Human"})
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "Other", Aliases: []string{"123"}})
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "Human", List: "friends"})
+	assert.NoError(t, err)
+}
+
+func TestBlacklistRecordSighting(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	bl, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	person, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}})
+	assert.NoError(t, err)
+
+	joined := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	left := joined.Add(time.Hour)
+
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "123", Server: "Island", Joined: joined})
+	assert.NoError(t, err)
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "123", Server: "Island", Left: left})
+	assert.NoError(t, err)
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "Griefer", Server: "Ragnarok", Joined: left})
+	assert.NoError(t, err)
+
+	err = bl.RecordSighting(ctx, uuid.New(), model.Sighting{Alias: "123"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	reloaded, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	persisted, err := reloaded.GetByID(ctx, person.ID)
+	assert.NoError(t, err)
+	assert.Len(t, persisted.Sightings, 2)
+	assert.Equal(t, "123", persisted.Sightings[0].Alias)
+	assert.True(t, joined.Equal(persisted.Sightings[0].Joined))
+	assert.True(t, left.Equal(persisted.Sightings[0].Left))
+	assert.Equal(t, "Ragnarok", persisted.Sightings[1].Server)
+	assert.True(t, persisted.Sightings[1].Left.IsZero())
+}
+
+func TestBlacklistEdit(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	bl, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	person, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}, Score: 5})
+	assert.NoError(t, err)
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "Raider"})
+	assert.NoError(t, err)
+
+	// recorded after the edit form was loaded
+	joined := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "123", Server: "Island", Joined: joined})
+	assert.NoError(t, err)
+
+	edited, err := bl.Edit(ctx, &model.BlacklistPlayers{ID: person.ID, Name: "Renamed", List: "enemies", Aliases: []string{"456"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", edited.Name)
+	assert.Equal(t, "enemies", edited.List)
+	assert.Equal(t, []string{"456"}, edited.Aliases)
+	assert.Equal(t, 5, edited.Score)
+	assert.Len(t, edited.Sightings, 1)
+
+	retrieved, err := bl.GetByID(ctx, person.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, edited, retrieved)
+
+	_, err = bl.Edit(ctx, &model.BlacklistPlayers{ID: person.ID, Name: "Raider"})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	_, err = bl.Edit(ctx, &model.BlacklistPlayers{ID: uuid.New(), Name: "Ghost"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBlacklistSightingsSkipBackups(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "blacklist.json")
+	bl, err := NewBlacklist(filename)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	person, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer"})
+	assert.NoError(t, err)
+	backups, err := atomicfile.Backups(filename)
+	assert.NoError(t, err)
+
+	joined := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		at := joined.Add(time.Duration(i) * time.Hour)
+		err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "Griefer", Server: "Island", Joined: at})
+		assert.NoError(t, err)
+		err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "Griefer", Server: "Island", Left: at.Add(time.Minute)})
+		assert.NoError(t, err)
+	}
+
+	after, err := atomicfile.Backups(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, backups, after)
+	assert.FileExists(t, filename+LogSuffix)
+
+	reloaded, err := NewBlacklist(filename)
+	assert.NoError(t, err)
+	persisted, err := reloaded.GetByID(ctx, person.ID)
+	assert.NoError(t, err)
+	assert.Len(t, persisted.Sightings, 10)
+
+	// a user edit writes the sightings into the file and empties the log
+	_, err = bl.Edit(ctx, &model.BlacklistPlayers{ID: person.ID, Name: "Renamed"})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filename+LogSuffix)
+
+	reloaded, err = NewBlacklist(filename)
+	assert.NoError(t, err)
+	persisted, err = reloaded.GetByID(ctx, person.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", persisted.Name)
+	assert.Len(t, persisted.Sightings, 10)
+}
+
+func TestBlacklistReturnsCopies(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	bl, err := NewBlacklist(filepath.Join(dir, "blacklist.json"))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	person, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}})
+	assert.NoError(t, err)
+	person.Name = "Changed"
+
+	retrieved, err := bl.GetByID(ctx, person.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Griefer", retrieved.Name)
+	retrieved.Aliases[0] = "456"
+
+	listed := bl.List(ctx)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, []string{"123"}, listed[0].Aliases)
+}
+
+func TestBlacklistMigratesLegacyFile(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "blacklist.json")
+	legacy := `{"d8e92b5e-4d1d-4f38-bdbc-d1d3f1d2e3b7": {"id": "d8e92b5e-4d1d-4f38-bdbc-d1d3f1d2e3b7", "name": "Test Player"}}`
+	err := os.WriteFile(filename, []byte(legacy), 0644)
+	assert.NoError(t, err)
+
+	bl, err := NewBlacklist(filename)
+	assert.NoError(t, err)
+
+	player, err := bl.GetByID(context.Background(), uuid.MustParse("d8e92b5e-4d1d-4f38-bdbc-d1d3f1d2e3b7"))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultList, player.List)
+
+	backup, err := os.ReadFile(schema.BackupPath(filename, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, string(backup))
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	version, steps, err := Schema.Plan(data)
+	assert.NoError(t, err)
+	assert.Equal(t, Schema.Version(), version)
+	assert.Empty(t, steps)
+}
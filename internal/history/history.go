@@ -0,0 +1,534 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
+	"github.com/led0nk/ark-overseer/pkg/schema"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/internal/history")
+
+// Schema holds the on-disk versions of history.json.
+var Schema = schema.NewRegistry(
+	"history.json",
+	schema.JSON,
+	schema.Migration{
+		From:        0,
+		Description: "wrap the series into a versioned envelope",
+		Apply:       func(data any) (any, error) { return data, nil },
+	},
+)
+
+const (
+	fiveMinutes = 5 * time.Minute
+	oneHour     = time.Hour
+
+	// LogSuffix is appended to the name of the history file to get the
+	// name of the log new samples are appended to between checkpoints.
+	LogSuffix = ".log"
+	// checkpointInterval is how often the history is compacted and
+	// written to disk as a whole, which empties the log.
+	checkpointInterval = time.Hour
+)
+
+type Aggregation string
+
+const (
+	Avg  Aggregation = "avg"
+	Min  Aggregation = "min"
+	Max  Aggregation = "max"
+	Last Aggregation = "last"
+)
+
+var ErrInvalidQuery = errors.New("invalid history query")
+
+type Recorder interface {
+	Record(context.Context, uuid.UUID, Sample) error
+	Query(context.Context, Query) ([]Point, error)
+	Delete(context.Context, uuid.UUID) error
+	Save() error
+}
+
+// Sample is a single observation of a server.
+type Sample struct {
+	Time    time.Time     `json:"time"`
+	Players int           `json:"players"`
+	Status  bool          `json:"status"`
+	Latency time.Duration `json:"latency"`
+}
+
+// Retention configures how long samples are kept in each resolution. Raw
+// samples older than Raw are folded into 5-minute rollups, those older than
+// FiveMinute into hourly rollups, which are dropped after Hourly. Interval
+// is the minimum time between two raw samples of the same server.
+type Retention struct {
+	Interval   time.Duration
+	Raw        time.Duration
+	FiveMinute time.Duration
+	Hourly     time.Duration
+}
+
+func DefaultRetention() Retention {
+	return Retention{
+		Interval:   time.Minute,
+		Raw:        48 * time.Hour,
+		FiveMinute: 30 * 24 * time.Hour,
+		Hourly:     365 * 24 * time.Hour,
+	}
+}
+
+// Query selects the samples of a server between From and To, grouped into
+// buckets of Step and combined with Aggregation.
+type Query struct {
+	ServerID    uuid.UUID
+	From        time.Time
+	To          time.Time
+	Step        time.Duration
+	Aggregation Aggregation
+}
+
+// Point is one bucket of a query result. Players holds the aggregated
+// player count, Uptime the share of samples the server was online.
+type Point struct {
+	Time    time.Time     `json:"time"`
+	Players float64       `json:"players"`
+	Uptime  float64       `json:"uptime"`
+	Latency time.Duration `json:"latency"`
+	Samples int           `json:"samples"`
+}
+
+// rollup summarizes all samples of one time bucket.
+type rollup struct {
+	Start       time.Time     `json:"start"`
+	Count       int           `json:"count"`
+	SumPlayers  int           `json:"sumPlayers"`
+	MinPlayers  int           `json:"minPlayers"`
+	MaxPlayers  int           `json:"maxPlayers"`
+	LastPlayers int           `json:"lastPlayers"`
+	Online      int           `json:"online"`
+	SumLatency  time.Duration `json:"sumLatency"`
+}
+
+type series struct {
+	Raw        []Sample  `json:"raw"`
+	FiveMinute []*rollup `json:"fiveMinute"`
+	Hourly     []*rollup `json:"hourly"`
+}
+
+// logEntry is a line of the log.
+type logEntry struct {
+	ServerID uuid.UUID `json:"serverID"`
+	Sample
+}
+
+// History keeps the samples in memory. New samples are appended to a log
+// every minute, the whole history is only written once an hour after it was
+// compacted, on Delete and on Save. Loading replays the log on top of the
+// last written history.
+type History struct {
+	filename     string
+	retention    Retention
+	series       map[uuid.UUID]*series
+	pending      []logEntry
+	checkpointed time.Time
+	mu           sync.Mutex
+	logger       *slog.Logger
+}
+
+func NewHistory(ctx context.Context, filename string, retention Retention) (*History, error) {
+	history := &History{
+		filename:  filename,
+		retention: retention,
+		series:    make(map[uuid.UUID]*series),
+		logger:    slog.Default().WithGroup("history"),
+	}
+	if err := history.load(); err != nil {
+		return nil, err
+	}
+
+	go history.maintain(ctx)
+
+	return history, nil
+}
+
+// Save writes the whole history to disk and empties the log.
+func (h *History) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.checkpoint()
+}
+
+// save writes the history to disk. The caller must hold h.mu.
+func (h *History) save() error {
+	as_json, err := Schema.Encode(h.series)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(h.filename, as_json, 0644, atomicfile.DefaultBackups)
+}
+
+// checkpoint writes the history to disk and removes the log, whose samples
+// are part of it now. The caller must hold h.mu.
+func (h *History) checkpoint() error {
+	err := h.save()
+	if err != nil {
+		return err
+	}
+	h.pending = nil
+	h.checkpointed = time.Now()
+
+	err = os.Remove(h.filename + LogSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// flush appends the samples recorded since the last flush to the log. The
+// caller must hold h.mu.
+func (h *History) flush() error {
+	if len(h.pending) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(h.filename+LogSuffix, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, entry := range h.pending {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	h.pending = h.pending[:0]
+	return file.Sync()
+}
+
+func (h *History) load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkpointed = time.Now()
+	if _, err := os.Stat(h.filename); os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(h.filename), 0777)
+		if err != nil {
+			return err
+		}
+		backups, err := atomicfile.Backups(h.filename)
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			err = h.save()
+			if err != nil {
+				return err
+			}
+			return h.replay()
+		}
+	}
+
+	recovered, err := atomicfile.ReadFile(h.filename, func(data []byte) error {
+		series := make(map[uuid.UUID]*series)
+		_, err := Schema.Decode(data, &series)
+		if err != nil {
+			return err
+		}
+		h.series = series
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if recovered != "" {
+		h.logger.Warn("recovered history from backup", "file", h.filename, "backup", recovered)
+	}
+	return h.replay()
+}
+
+// replay records the samples of the log. Samples that are already part of
+// the history, because the log was not removed after the last checkpoint,
+// are too close to the last raw sample and dropped by record. The caller
+// must hold h.mu.
+func (h *History) replay() error {
+	file, err := os.Open(h.filename + LogSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry logEntry
+		// a partially written last line after a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		h.record(entry.ServerID, entry.Sample)
+	}
+	return scanner.Err()
+}
+
+// maintain periodically appends new samples to the log. Once per
+// checkpointInterval it downsamples the history and writes it to disk
+// instead.
+func (h *History) maintain(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.mu.Lock()
+			var err error
+			if now.Sub(h.checkpointed) >= checkpointInterval {
+				h.compact(now)
+				err = h.checkpoint()
+			} else {
+				err = h.flush()
+			}
+			h.mu.Unlock()
+			if err != nil {
+				h.logger.ErrorContext(ctx, "failed to save history", "error", err)
+			}
+		}
+	}
+}
+
+// Record adds a sample for the server. Samples arriving less than
+// Retention.Interval after the previous one are dropped.
+func (h *History) Record(ctx context.Context, id uuid.UUID, sample Sample) error {
+	_, span := tracer.Start(ctx, "Record")
+	defer span.End()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.record(id, sample) {
+		h.pending = append(h.pending, logEntry{ServerID: id, Sample: sample})
+	}
+	return nil
+}
+
+// record adds sample to the raw samples of the server and reports whether
+// it was kept. The caller must hold h.mu.
+func (h *History) record(id uuid.UUID, sample Sample) bool {
+	s, exists := h.series[id]
+	if !exists {
+		s = &series{}
+		h.series[id] = s
+	}
+
+	if n := len(s.Raw); n > 0 && sample.Time.Sub(s.Raw[n-1].Time) < h.retention.Interval {
+		return false
+	}
+	s.Raw = append(s.Raw, sample)
+	return true
+}
+
+// Delete removes the history of the server. The history is written to disk
+// right away, so the samples in the log do not bring it back.
+func (h *History) Delete(ctx context.Context, id uuid.UUID) error {
+	_, span := tracer.Start(ctx, "Delete")
+	defer span.End()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.series, id)
+	return h.checkpoint()
+}
+
+func (h *History) Query(ctx context.Context, q Query) ([]Point, error) {
+	_, span := tracer.Start(ctx, "Query")
+	defer span.End()
+
+	if q.Aggregation == "" {
+		q.Aggregation = Avg
+	}
+	switch q.Aggregation {
+	case Avg, Min, Max, Last:
+	default:
+		return nil, fmt.Errorf("%w: unknown aggregation %q", ErrInvalidQuery, q.Aggregation)
+	}
+	if q.Step <= 0 || !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: step must be positive and from before to", ErrInvalidQuery)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, exists := h.series[q.ServerID]
+	if !exists {
+		return []Point{}, nil
+	}
+
+	buckets := make(map[int64]*rollup)
+	add := func(r *rollup) {
+		if r.Start.Before(q.From) || !r.Start.Before(q.To) {
+			return
+		}
+		index := int64(r.Start.Sub(q.From) / q.Step)
+		bucket, exists := buckets[index]
+		if !exists {
+			bucket = &rollup{Start: q.From.Add(time.Duration(index) * q.Step)}
+			buckets[index] = bucket
+		}
+		bucket.merge(r)
+	}
+
+	for _, r := range s.Hourly {
+		add(r)
+	}
+	for _, r := range s.FiveMinute {
+		add(r)
+	}
+	for _, sample := range s.Raw {
+		add(newRollup(sample.Time, sample))
+	}
+
+	points := make([]Point, 0, len(buckets))
+	for _, bucket := range buckets {
+		points = append(points, bucket.point(q.Aggregation))
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// compact moves expired samples into coarser rollups and drops rollups past
+// their retention. The caller must hold h.mu.
+func (h *History) compact(now time.Time) {
+	rawCutoff := now.Add(-h.retention.Raw).Truncate(fiveMinutes)
+	fiveMinuteCutoff := now.Add(-h.retention.FiveMinute).Truncate(oneHour)
+	hourlyCutoff := now.Add(-h.retention.Hourly)
+
+	for id, s := range h.series {
+		keep := 0
+		for _, sample := range s.Raw {
+			if sample.Time.Before(rawCutoff) {
+				s.FiveMinute = mergeInto(s.FiveMinute, newRollup(sample.Time.Truncate(fiveMinutes), sample))
+				continue
+			}
+			s.Raw[keep] = sample
+			keep++
+		}
+		s.Raw = s.Raw[:keep]
+
+		keepRollups := s.FiveMinute[:0]
+		for _, r := range s.FiveMinute {
+			if r.Start.Before(fiveMinuteCutoff) {
+				hourly := *r
+				hourly.Start = r.Start.Truncate(oneHour)
+				s.Hourly = mergeInto(s.Hourly, &hourly)
+				continue
+			}
+			keepRollups = append(keepRollups, r)
+		}
+		s.FiveMinute = keepRollups
+
+		keepRollups = s.Hourly[:0]
+		for _, r := range s.Hourly {
+			if r.Start.Before(hourlyCutoff) {
+				continue
+			}
+			keepRollups = append(keepRollups, r)
+		}
+		s.Hourly = keepRollups
+
+		if len(s.Raw) == 0 && len(s.FiveMinute) == 0 && len(s.Hourly) == 0 {
+			delete(h.series, id)
+		}
+	}
+}
+
+func newRollup(start time.Time, sample Sample) *rollup {
+	r := &rollup{
+		Start:       start,
+		Count:       1,
+		SumPlayers:  sample.Players,
+		MinPlayers:  sample.Players,
+		MaxPlayers:  sample.Players,
+		LastPlayers: sample.Players,
+		SumLatency:  sample.Latency,
+	}
+	if sample.Status {
+		r.Online = 1
+	}
+	return r
+}
+
+// mergeInto merges r into the rollup with the same start, which is expected
+// to be the last one since samples are compacted in order.
+func mergeInto(rollups []*rollup, r *rollup) []*rollup {
+	if n := len(rollups); n > 0 && rollups[n-1].Start.Equal(r.Start) {
+		rollups[n-1].merge(r)
+		return rollups
+	}
+	return append(rollups, r)
+}
+
+func (r *rollup) merge(other *rollup) {
+	if r.Count == 0 || other.MinPlayers < r.MinPlayers {
+		r.MinPlayers = other.MinPlayers
+	}
+	if r.Count == 0 || other.MaxPlayers > r.MaxPlayers {
+		r.MaxPlayers = other.MaxPlayers
+	}
+	r.Count += other.Count
+	r.SumPlayers += other.SumPlayers
+	r.LastPlayers = other.LastPlayers
+	r.Online += other.Online
+	r.SumLatency += other.SumLatency
+}
+
+func (r *rollup) point(aggregation Aggregation) Point {
+	point := Point{
+		Time:    r.Start,
+		Samples: r.Count,
+	}
+	if r.Count == 0 {
+		return point
+	}
+
+	switch aggregation {
+	case Min:
+		point.Players = float64(r.MinPlayers)
+	case Max:
+		point.Players = float64(r.MaxPlayers)
+	case Last:
+		point.Players = float64(r.LastPlayers)
+	default:
+		point.Players = float64(r.SumPlayers) / float64(r.Count)
+	}
+	point.Uptime = float64(r.Online) / float64(r.Count)
+	point.Latency = r.SumLatency / time.Duration(r.Count)
+	return point
+}
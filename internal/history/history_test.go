@@ -0,0 +1,219 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTempDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "history_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	return dir
+}
+
+func cleanupTempDir(t *testing.T, dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("Failed to remove temp dir: %s", err)
+	}
+}
+
+var (
+	serverID = uuid.MustParse("64dfb157-37b8-41de-b24d-14f304e15402")
+	start    = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func newTestHistory(t *testing.T, dir string) *History {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h, err := NewHistory(ctx, filepath.Join(dir, "history.json"), DefaultRetention())
+	assert.NoError(t, err)
+	return h
+}
+
+func TestRecordAndQuery(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	h := newTestHistory(t, dir)
+
+	players := []int{2, 4, 6, 8, 10, 12}
+	for i, p := range players {
+		err := h.Record(ctx, serverID, Sample{
+			Time:    start.Add(time.Duration(i) * time.Minute),
+			Players: p,
+			Status:  i != 0,
+			Latency: 10 * time.Millisecond,
+		})
+		assert.NoError(t, err)
+	}
+
+	err := h.Record(ctx, serverID, Sample{Time: start.Add(5*time.Minute + time.Second), Players: 100})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		aggregation Aggregation
+		expected    []float64
+	}{
+		{name: "average", aggregation: Avg, expected: []float64{6, 12}},
+		{name: "minimum", aggregation: Min, expected: []float64{2, 12}},
+		{name: "maximum", aggregation: Max, expected: []float64{10, 12}},
+		{name: "last", aggregation: Last, expected: []float64{10, 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := h.Query(ctx, Query{
+				ServerID:    serverID,
+				From:        start,
+				To:          start.Add(time.Hour),
+				Step:        5 * time.Minute,
+				Aggregation: tt.aggregation,
+			})
+			assert.NoError(t, err)
+			assert.Len(t, points, len(tt.expected))
+			for i, point := range points {
+				assert.Equal(t, tt.expected[i], point.Players)
+			}
+		})
+	}
+
+	points, err := h.Query(ctx, Query{ServerID: serverID, From: start, To: start.Add(time.Hour), Step: 5 * time.Minute})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, points[0].Samples)
+	assert.Equal(t, 0.8, points[0].Uptime)
+	assert.Equal(t, 10*time.Millisecond, points[0].Latency)
+}
+
+func TestQueryValidation(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	h := newTestHistory(t, dir)
+
+	_, err := h.Query(ctx, Query{ServerID: serverID, From: start, To: start.Add(time.Hour), Step: time.Minute, Aggregation: "median"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	_, err = h.Query(ctx, Query{ServerID: serverID, From: start, To: start, Step: time.Minute})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	points, err := h.Query(ctx, Query{ServerID: uuid.New(), From: start, To: start.Add(time.Hour), Step: time.Minute})
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+}
+
+func TestCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	h := newTestHistory(t, dir)
+
+	for i := 0; i < 120; i++ {
+		err := h.Record(ctx, serverID, Sample{
+			Time:    start.Add(time.Duration(i) * time.Minute),
+			Players: i % 10,
+			Status:  true,
+		})
+		assert.NoError(t, err)
+	}
+
+	h.compact(start.Add(h.retention.Raw + 3*time.Hour))
+	s := h.series[serverID]
+	assert.Empty(t, s.Raw)
+	assert.Len(t, s.FiveMinute, 24)
+	assert.Empty(t, s.Hourly)
+
+	before, err := h.Query(ctx, Query{ServerID: serverID, From: start, To: start.Add(2 * time.Hour), Step: time.Hour, Aggregation: Max})
+	assert.NoError(t, err)
+
+	h.compact(start.Add(h.retention.FiveMinute + 3*time.Hour))
+	assert.Empty(t, s.FiveMinute)
+	assert.Len(t, s.Hourly, 2)
+
+	after, err := h.Query(ctx, Query{ServerID: serverID, From: start, To: start.Add(2 * time.Hour), Step: time.Hour, Aggregation: Max})
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+	assert.Equal(t, 60, after[0].Samples)
+
+	h.compact(start.Add(h.retention.Hourly + 3*time.Hour))
+	assert.NotContains(t, h.series, serverID)
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	h := newTestHistory(t, dir)
+	err := h.Record(ctx, serverID, Sample{Time: start, Players: 7, Status: true})
+	assert.NoError(t, err)
+	assert.NoError(t, h.Save())
+
+	loaded := newTestHistory(t, dir)
+	points, err := loaded.Query(ctx, Query{ServerID: serverID, From: start, To: start.Add(time.Minute), Step: time.Minute})
+	assert.NoError(t, err)
+	assert.Len(t, points, 1)
+	assert.Equal(t, float64(7), points[0].Players)
+}
+
+func TestFlushAppendsToLog(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	h := newTestHistory(t, dir)
+	snapshot, err := os.ReadFile(h.filename)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		err := h.Record(ctx, serverID, Sample{Time: start.Add(time.Duration(i) * time.Minute), Players: i, Status: true})
+		assert.NoError(t, err)
+		h.mu.Lock()
+		assert.NoError(t, h.flush())
+		h.mu.Unlock()
+	}
+
+	unchanged, err := os.ReadFile(h.filename)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot, unchanged, "flush must not rewrite the history")
+
+	// the loaded history replays the log, samples in both are kept once
+	assert.NoError(t, h.save())
+	loaded := newTestHistory(t, dir)
+	assert.Len(t, loaded.series[serverID].Raw, 3)
+
+	assert.NoError(t, loaded.Save())
+	_, err = os.Stat(h.filename + LogSuffix)
+	assert.True(t, os.IsNotExist(err), "checkpoint must remove the log")
+	loaded = newTestHistory(t, dir)
+	assert.Len(t, loaded.series[serverID].Raw, 3)
+}
+
+func TestDeleteDropsLoggedSamples(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	h := newTestHistory(t, dir)
+	assert.NoError(t, h.Record(ctx, serverID, Sample{Time: start, Players: 7, Status: true}))
+	h.mu.Lock()
+	assert.NoError(t, h.flush())
+	h.mu.Unlock()
+	assert.NoError(t, h.Delete(ctx, serverID))
+
+	loaded := newTestHistory(t, dir)
+	assert.NotContains(t, loaded.series, serverID)
+}
@@ -0,0 +1,328 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/internal/journal")
+
+// Filename is the name of the active journal file, rotated files get a
+// numeric suffix with .1 being the most recent one.
+const Filename = "events.jsonl"
+
+// SubscriberName is the name the journal subscribes to the EventManager
+// with, replays to it are refused as they would duplicate entries.
+const SubscriberName = "journal"
+
+var ErrInvalidQuery = errors.New("invalid journal query")
+
+type Journal interface {
+	Query(context.Context, Query) ([]Entry, error)
+	Replay(context.Context, Query, string) (int, error)
+	Subscribers() []string
+}
+
+// Entry is one published event as it is written to the journal.
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Type     string          `json:"type"`
+	ServerID uuid.UUID       `json:"serverID"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Query selects entries between From and To. Empty Types and a nil ServerID
+// match every entry, Limit keeps only the most recent entries.
+type Query struct {
+	Types    []string
+	ServerID uuid.UUID
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+func (q Query) matches(entry Entry) bool {
+	if len(q.Types) > 0 && !slices.Contains(q.Types, entry.Type) {
+		return false
+	}
+	if q.ServerID != uuid.Nil && q.ServerID != entry.ServerID {
+		return false
+	}
+	if !q.From.IsZero() && entry.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && entry.Time.After(q.To) {
+		return false
+	}
+	return true
+}
+
+// Rotation configures when the journal file is rotated. MaxSize is the size
+// in bytes after which a new file is started, MaxFiles the number of rotated
+// files that are kept.
+type Rotation struct {
+	MaxSize  int64
+	MaxFiles int
+}
+
+func DefaultRotation() Rotation {
+	return Rotation{
+		MaxSize:  10 << 20,
+		MaxFiles: 5,
+	}
+}
+
+// FileJournal appends every event it handles to a rotating JSON lines file.
+type FileJournal struct {
+	filename string
+	rotation Rotation
+	file     *os.File
+	size     int64
+	em       *events.EventManager
+	logger   *slog.Logger
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+func NewFileJournal(dir string, rotation Rotation, em *events.EventManager) (*FileJournal, error) {
+	if rotation.MaxSize <= 0 || rotation.MaxFiles < 0 {
+		return nil, fmt.Errorf("invalid journal rotation: %+v", rotation)
+	}
+
+	j := &FileJournal{
+		filename: filepath.Join(dir, Filename),
+		rotation: rotation,
+		em:       em,
+		logger:   slog.Default().WithGroup("journal"),
+		now:      time.Now,
+	}
+	err := j.open()
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *FileJournal) open() error {
+	file, err := os.OpenFile(j.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file = file
+	j.size = info.Size()
+	return nil
+}
+
+// HandleEvent writes event to the journal.
+func (j *FileJournal) HandleEvent(ctx context.Context, event events.EventMessage) {
+	err := j.Append(ctx, event)
+	if err != nil {
+		j.logger.ErrorContext(ctx, "failed to append event", "error", err, "type", event.Type)
+	}
+}
+
+func (j *FileJournal) Append(ctx context.Context, event events.EventMessage) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(Entry{
+		Time:     j.now(),
+		Type:     event.Type,
+		ServerID: events.ServerOf(event.Payload),
+		Payload:  payload,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return os.ErrClosed
+	}
+	if j.size > 0 && j.size+int64(len(line)) > j.rotation.MaxSize {
+		err = j.rotate()
+		if err != nil {
+			return fmt.Errorf("failed to rotate journal: %w", err)
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files by one, moves the active file to .1 and
+// starts a new one. The oldest file is removed once MaxFiles is reached.
+func (j *FileJournal) rotate() error {
+	err := j.file.Close()
+	if err != nil {
+		return err
+	}
+	j.file = nil
+
+	err = os.Remove(j.rotated(j.rotation.MaxFiles))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := j.rotation.MaxFiles - 1; i >= 0; i-- {
+		err = os.Rename(j.rotated(i), j.rotated(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return j.open()
+}
+
+// rotated returns the name of the i-th rotated file, 0 is the active one.
+func (j *FileJournal) rotated(i int) string {
+	if i == 0 {
+		return j.filename
+	}
+	return fmt.Sprintf("%s.%d", j.filename, i)
+}
+
+// Query returns the matching entries in the order they were written.
+func (j *FileJournal) Query(ctx context.Context, query Query) ([]Entry, error) {
+	_, span := tracer.Start(ctx, "Query")
+	defer span.End()
+
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return nil, fmt.Errorf("%w: to before from", ErrInvalidQuery)
+	}
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var entries []Entry
+	for i := j.rotation.MaxFiles; i >= 0; i-- {
+		err := readEntries(j.rotated(i), func(entry Entry) {
+			if !query.matches(entry) {
+				return
+			}
+			entries = append(entries, entry)
+			if query.Limit > 0 && len(entries) > query.Limit {
+				entries = entries[1:]
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func readEntries(filename string, fn func(Entry)) error {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var entry Entry
+		// a partially written last line after a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
+
+// CanReplayTo reports whether events may be replayed to the subscriber
+// registered under name. Only notifier instances qualify, the built-in
+// subscribers such as the observer and the journal would act on the old
+// events again, e.g. delete the scrapers and the history of a server.
+func CanReplayTo(name string) bool {
+	return config.CheckInstanceName(name) == nil
+}
+
+// Replay publishes the replayable events matching query again, but only to
+// the notifier instance registered under name. It returns the number of
+// replayed events.
+func (j *FileJournal) Replay(ctx context.Context, query Query, name string) (int, error) {
+	ctx, span := tracer.Start(ctx, "Replay")
+	defer span.End()
+
+	if !CanReplayTo(name) {
+		return 0, fmt.Errorf("%w: cannot replay to %q, only to notifiers", ErrInvalidQuery, name)
+	}
+
+	entries, err := j.Query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var replayed int
+	for _, entry := range entries {
+		event, err := events.Decode(entry.Type, entry.Payload)
+		if errors.Is(err, events.ErrNotReplayable) {
+			continue
+		}
+		if err != nil {
+			j.logger.WarnContext(ctx, "failed to decode journal entry", "error", err, "type", entry.Type)
+			continue
+		}
+		err = j.em.PublishTo(ctx, name, event)
+		if err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	j.logger.InfoContext(ctx, "replayed events", "subscriber", name, "count", replayed)
+	return replayed, nil
+}
+
+// Subscribers returns the names replay can target.
+func (j *FileJournal) Subscribers() []string {
+	var names []string
+	for _, name := range j.em.Subscribers() {
+		if CanReplayTo(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,151 @@
+package journal
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	serverID = uuid.MustParse("64dfb157-37b8-41de-b24d-14f304e15402")
+	otherID  = uuid.MustParse("0b9a8f55-36f4-4c4e-a0c4-4ff5c3c2a0a1")
+	start    = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func newTestJournal(t *testing.T, rotation Rotation, em *events.EventManager) *FileJournal {
+	j, err := NewFileJournal(t.TempDir(), rotation, em)
+	assert.NoError(t, err)
+	t.Cleanup(func() { j.Close() })
+
+	now := start
+	j.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	return j
+}
+
+func appendEvent(t *testing.T, j *FileJournal, event events.Event) {
+	err := j.Append(context.Background(), events.EventMessage{Type: event.Topic(), Payload: event})
+	assert.NoError(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	j := newTestJournal(t, DefaultRotation(), events.NewEventManager())
+
+	appendEvent(t, j, events.PlayerJoined{ServerID: serverID, Name: "Alice"})
+	appendEvent(t, j, events.ServerStatusChanged{Server: &model.Server{
+		ID:          otherID,
+		ServerState: model.ServerState{ServerInfo: &model.ServerInfo{Name: "Island"}},
+	}})
+	appendEvent(t, j, events.PlayerLeft{ServerID: serverID, Name: "Alice"})
+	appendEvent(t, j, events.ConfigChanged{Section: "notification-service", Key: "discord", Values: map[interface{}]interface{}{"token": "secret"}})
+
+	all, err := j.Query(ctx, Query{})
+	assert.NoError(t, err)
+	assert.Len(t, all, 4)
+	assert.Equal(t, "player.joined", all[0].Type)
+	assert.Equal(t, serverID, all[0].ServerID)
+	assert.Equal(t, start.Add(time.Minute), all[0].Time.UTC())
+	assert.NotContains(t, string(all[3].Payload), "secret")
+
+	byType, err := j.Query(ctx, Query{Types: []string{"player.joined", "player.left"}})
+	assert.NoError(t, err)
+	assert.Len(t, byType, 2)
+
+	byServer, err := j.Query(ctx, Query{ServerID: otherID})
+	assert.NoError(t, err)
+	assert.Len(t, byServer, 1)
+	assert.Equal(t, "server.offline", byServer[0].Type)
+	assert.Contains(t, string(byServer[0].Payload), `"serverinfo":{"protocol":0,"name":"Island"`)
+
+	byTime, err := j.Query(ctx, Query{From: start.Add(2 * time.Minute), To: start.Add(3 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Len(t, byTime, 2)
+
+	limited, err := j.Query(ctx, Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, limited, 1)
+	assert.Equal(t, "config.changed", limited[0].Type)
+
+	_, err = j.Query(ctx, Query{From: start.Add(time.Hour), To: start})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	j := newTestJournal(t, Rotation{MaxSize: 200, MaxFiles: 2}, events.NewEventManager())
+
+	for i := 0; i < 10; i++ {
+		appendEvent(t, j, events.PlayerJoined{ServerID: serverID, Name: "Alice"})
+	}
+
+	_, err := os.Stat(j.rotated(1))
+	assert.NoError(t, err)
+	_, err = os.Stat(j.rotated(2))
+	assert.NoError(t, err)
+	_, err = os.Stat(j.rotated(3))
+	assert.True(t, os.IsNotExist(err), "only MaxFiles rotated files are kept")
+
+	entries, err := j.Query(ctx, Query{})
+	assert.NoError(t, err)
+	assert.Less(t, len(entries), 10)
+	for i := 1; i < len(entries); i++ {
+		assert.True(t, entries[i-1].Time.Before(entries[i].Time), "entries are in order across files")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	em := events.NewEventManager()
+	j := newTestJournal(t, DefaultRotation(), em)
+
+	appendEvent(t, j, events.PlayerJoined{ServerID: serverID, Name: "Alice"})
+	appendEvent(t, j, events.ConfigChanged{Section: "notification-service"})
+	appendEvent(t, j, events.PlayerLeft{ServerID: serverID, Name: "Alice"})
+
+	_, other := em.Subscribe("other")
+	id, ch := em.Subscribe("discord", events.WithPolicy(events.Unbounded))
+	defer em.Unsubscribe(id, "discord")
+
+	replayed, err := j.Replay(ctx, Query{}, "discord")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+
+	assert.Equal(t, events.PlayerJoined{ServerID: serverID, Name: "Alice"}, (<-ch).Payload)
+	assert.Equal(t, events.PlayerLeft{ServerID: serverID, Name: "Alice"}, (<-ch).Payload)
+	assert.Len(t, other, 0)
+
+	_, err = j.Replay(ctx, Query{}, "unknown")
+	assert.ErrorIs(t, err, events.ErrUnknownSubscriber)
+}
+
+func TestReplayRefusesBuiltInSubscribers(t *testing.T) {
+	ctx := context.Background()
+	em := events.NewEventManager()
+	j := newTestJournal(t, DefaultRotation(), em)
+
+	appendEvent(t, j, events.ServerDeleted{ServerID: serverID})
+
+	id, observer := em.Subscribe("observer", events.WithPolicy(events.Unbounded))
+	defer em.Unsubscribe(id, "observer")
+	id, _ = em.Subscribe("serviceManager")
+	defer em.Unsubscribe(id, "serviceManager")
+	id, _ = em.Subscribe("discord")
+	defer em.Unsubscribe(id, "discord")
+
+	for _, name := range []string{"observer", "serviceManager", SubscriberName} {
+		replayed, err := j.Replay(ctx, Query{}, name)
+		assert.ErrorIs(t, err, ErrInvalidQuery, name)
+		assert.Equal(t, 0, replayed)
+	}
+	assert.Len(t, observer, 0)
+	assert.Equal(t, []string{"discord"}, j.Subscribers())
+}
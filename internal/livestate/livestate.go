@@ -0,0 +1,62 @@
+package livestate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/internal/livestate")
+
+// Store keeps the scraped state of every server in memory. It is never
+// persisted, a restart starts with empty states until the next scrape.
+type Store interface {
+	GetState(context.Context, uuid.UUID) (model.ServerState, bool)
+	SetState(context.Context, uuid.UUID, model.ServerState)
+	DeleteState(context.Context, uuid.UUID)
+}
+
+type MemoryStore struct {
+	states map[uuid.UUID]model.ServerState
+	mu     sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[uuid.UUID]model.ServerState),
+	}
+}
+
+func (m *MemoryStore) GetState(ctx context.Context, id uuid.UUID) (model.ServerState, bool) {
+	_, span := tracer.Start(ctx, "GetState")
+	defer span.End()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, ok := m.states[id]
+	return state, ok
+}
+
+func (m *MemoryStore) SetState(ctx context.Context, id uuid.UUID, state model.ServerState) {
+	_, span := tracer.Start(ctx, "SetState")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.states[id] = state
+}
+
+func (m *MemoryStore) DeleteState(ctx context.Context, id uuid.UUID) {
+	_, span := tracer.Start(ctx, "DeleteState")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, id)
+}
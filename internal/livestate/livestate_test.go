@@ -0,0 +1,29 @@
+package livestate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	id := uuid.New()
+
+	_, ok := store.GetState(ctx, id)
+	assert.False(t, ok)
+
+	store.SetState(ctx, id, model.ServerState{Status: true, ServerInfo: &model.ServerInfo{Players: 3}})
+	state, ok := store.GetState(ctx, id)
+	assert.True(t, ok)
+	assert.True(t, state.Status)
+	assert.Equal(t, 3, state.ServerInfo.Players)
+
+	store.DeleteState(ctx, id)
+	_, ok = store.GetState(ctx, id)
+	assert.False(t, ok)
+}
@@ -1,19 +1,115 @@
 package model
 
 import (
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/FlowingSPDG/go-steam"
 	"github.com/google/uuid"
 )
 
+// Server is a server definition combined with its live state. Only the
+// definition (ID, Name, Addr) is persisted, the embedded ServerState is
+// scraped by the observer and kept in memory. It is still part of the JSON
+// encoding, e.g. of event payloads.
 type Server struct {
-	ID          uuid.UUID    `json:"id" form:"-"`
-	Name        string       `json:"name" form:"-"`
-	Addr        string       `json:"addr" form:"-"`
-	Status      bool         `json:"status" form:"-"`
-	ServerInfo  *ServerInfo  `json:"serverinfo" form:"-"`
-	PlayersInfo *PlayersInfo `json:"playersinfo" form:"-"`
+	ID          uuid.UUID `json:"id" form:"-"`
+	Name        string    `json:"name" form:"-"`
+	Addr        string    `json:"addr" form:"-"`
+	ServerState `form:"-"`
+}
+
+// Definition returns a copy of the server without its live state.
+func (s *Server) Definition() *Server {
+	return &Server{
+		ID:   s.ID,
+		Name: s.Name,
+		Addr: s.Addr,
+	}
+}
+
+// ConnectAddr returns the address players connect to. Addr is the query
+// port, the game port is taken from the last scrape if it reported one.
+func (s *Server) ConnectAddr() string {
+	if s.ServerInfo == nil || s.ServerInfo.Port == 0 {
+		return s.Addr
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return s.Addr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(s.ServerInfo.Port))
+}
+
+// PlayerCount returns the number of players online and the slots of the
+// server as seen by the last scrape, max is 0 if unknown.
+func (s *Server) PlayerCount() (players int, max int) {
+	if s.ServerInfo != nil {
+		return s.ServerInfo.Players, s.ServerInfo.MaxPlayers
+	}
+	if s.PlayersInfo != nil {
+		return len(s.PlayersInfo.Players), 0
+	}
+	return 0, 0
+}
+
+// ServerState is the volatile data of a server as seen by the last scrape.
+type ServerState struct {
+	Status      bool          `json:"status" form:"-"`
+	Latency     time.Duration `json:"latency" form:"-"`
+	ServerInfo  *ServerInfo   `json:"serverinfo" form:"-"`
+	PlayersInfo *PlayersInfo  `json:"playersinfo" form:"-"`
+	Updated     time.Time     `json:"updated" form:"-"`
+}
+
+// Clone returns a deep copy of the state, which shares no memory with s.
+func (s ServerState) Clone() ServerState {
+	if s.ServerInfo != nil {
+		info := *s.ServerInfo
+		s.ServerInfo = &info
+	}
+	if s.PlayersInfo != nil {
+		players := make([]*Players, 0, len(s.PlayersInfo.Players))
+		for _, player := range s.PlayersInfo.Players {
+			if player == nil {
+				continue
+			}
+			copied := *player
+			players = append(players, &copied)
+		}
+		s.PlayersInfo = &PlayersInfo{Players: players}
+	}
+	return s
+}
+
+// SameAs reports whether two states show the same thing. Values that change
+// on every scrape (latency, play time and the scrape time) are ignored.
+func (s ServerState) SameAs(other ServerState) bool {
+	if s.Status != other.Status {
+		return false
+	}
+	if (s.ServerInfo == nil) != (other.ServerInfo == nil) {
+		return false
+	}
+	if s.ServerInfo != nil && *s.ServerInfo != *other.ServerInfo {
+		return false
+	}
+	if (s.PlayersInfo == nil) != (other.PlayersInfo == nil) {
+		return false
+	}
+	if s.PlayersInfo == nil {
+		return true
+	}
+	if len(s.PlayersInfo.Players) != len(other.PlayersInfo.Players) {
+		return false
+	}
+	for i, player := range s.PlayersInfo.Players {
+		if player.Name != other.PlayersInfo.Players[i].Name || player.Score != other.PlayersInfo.Players[i].Score {
+			return false
+		}
+	}
+	return true
 }
 
 type ServerInfo struct {
@@ -50,8 +146,67 @@ type Players struct {
 }
 
 type BlacklistPlayers struct {
-	ID       uuid.UUID     `json:"id" form:"-"`
-	Name     string        `json:"name" form:"-"`
-	Score    int           `json:"score" form:"-"`
-	Duration time.Duration `json:"duration" form:"-"`
+	ID        uuid.UUID     `json:"id" form:"-"`
+	Name      string        `json:"name" form:"-"`
+	List      string        `json:"list" form:"-"`
+	Server    string        `json:"server" form:"-"`
+	Aliases   []string      `json:"aliases" form:"-"`
+	SteamIDs  []string      `json:"steamids" form:"-"`
+	Sightings []*Sighting   `json:"sightings" form:"-"`
+	Score     int           `json:"score" form:"-"`
+	Duration  time.Duration `json:"duration" form:"-"`
+}
+
+// Names returns the primary name of the tracked person followed by all of
+// their aliases.
+func (b *BlacklistPlayers) Names() []string {
+	names := make([]string, 0, len(b.Aliases)+1)
+	names = append(names, b.Name)
+	return append(names, b.Aliases...)
+}
+
+// Identify returns the name of the tracked person and the name the player
+// is currently using, alias is empty if it is the primary name. b may be nil
+// for a player without an entry.
+func (b *BlacklistPlayers) Identify(name string) (person string, alias string) {
+	if b == nil || b.Name == name {
+		return name, ""
+	}
+	return b.Name, name
+}
+
+// Describe names the tracked person and, if it differs, the alias they are
+// currently using, e.g. "Bob (as bob_1)".
+func (b *BlacklistPlayers) Describe(name string) string {
+	person, alias := b.Identify(name)
+	if alias == "" {
+		return person
+	}
+	return person + " (as " + alias + ")"
+}
+
+// Clone returns a deep copy of the entry, which shares no memory with b.
+func (b *BlacklistPlayers) Clone() *BlacklistPlayers {
+	clone := *b
+	if b.Aliases != nil {
+		clone.Aliases = append([]string{}, b.Aliases...)
+	}
+	if b.SteamIDs != nil {
+		clone.SteamIDs = append([]string{}, b.SteamIDs...)
+	}
+	if b.Sightings != nil {
+		clone.Sightings = make([]*Sighting, 0, len(b.Sightings))
+		for _, sighting := range b.Sightings {
+			copied := *sighting
+			clone.Sightings = append(clone.Sightings, &copied)
+		}
+	}
+	return &clone
+}
+
+type Sighting struct {
+	Alias  string    `json:"alias" form:"-"`
+	Server string    `json:"server" form:"-"`
+	Joined time.Time `json:"joined" form:"-"`
+	Left   time.Time `json:"left" form:"-"`
 }
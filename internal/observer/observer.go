@@ -12,28 +12,54 @@ import (
 	"github.com/FlowingSPDG/go-steam"
 	"github.com/google/uuid"
 	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/history"
+	"github.com/led0nk/ark-overseer/internal/livestate"
 	"github.com/led0nk/ark-overseer/internal/model"
 	"github.com/led0nk/ark-overseer/internal/storage"
 	"github.com/led0nk/ark-overseer/pkg/events"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var meter = otel.GetMeterProvider().Meter("github.com/led0nk/ark-overseer/internal/observer")
+var (
+	meter  = otel.GetMeterProvider().Meter("github.com/led0nk/ark-overseer/internal/observer")
+	tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/internal/observer")
+)
 
 type Overseer interface {
 	HandleEvent(context.Context, events.EventMessage)
 }
 
 type Observer struct {
+	// ctx is the lifetime of the observer. Scrapers are derived from it
+	// instead of the context of the event that added them, which is done
+	// once the handler returns.
+	ctx         context.Context
 	endpoints   map[uuid.UUID]*model.Server
 	cancelFuncs map[uuid.UUID]context.CancelFunc
 	serverStore storage.Database
+	states      livestate.Store
 	blacklist   blacklist.Blacklister
+	history     history.Recorder
 	em          *events.EventManager
 	logger      *slog.Logger
 	mu          sync.Mutex
-	resultCh    map[uuid.UUID]chan *model.Server
+	resultCh    map[uuid.UUID]chan scrapeResult
+}
+
+// scrapeRetry is the pause after a failed scrape.
+const scrapeRetry = time.Second
+
+// scrapeResult is passed along the scrape, scan and update pipeline, ctx
+// holds the span of the previous stage. If the scrape failed, err is set
+// and server holds the offline state.
+type scrapeResult struct {
+	ctx    context.Context
+	server *model.Server
+	err    error
 }
 
 type NotificationStatus struct {
@@ -45,17 +71,22 @@ type NotificationStatus struct {
 func NewObserver(
 	ctx context.Context,
 	sStore storage.Database,
+	states livestate.Store,
 	blacklist blacklist.Blacklister,
+	history history.Recorder,
 	eventManager *events.EventManager,
 ) (*Observer, error) {
 	observer := &Observer{
+		ctx:         ctx,
 		endpoints:   make(map[uuid.UUID]*model.Server),
 		cancelFuncs: make(map[uuid.UUID]context.CancelFunc),
 		serverStore: sStore,
+		states:      states,
 		blacklist:   blacklist,
+		history:     history,
 		em:          eventManager,
 		logger:      slog.Default().WithGroup("observer"),
-		resultCh:    make(map[uuid.UUID]chan *model.Server),
+		resultCh:    make(map[uuid.UUID]chan scrapeResult),
 	}
 	go observer.processResults(ctx)
 	return observer, nil
@@ -73,7 +104,11 @@ func (o *Observer) readEndpoint(target *model.Server) error {
 	return nil
 }
 
-func (o *Observer) dataScraper(ctx context.Context, target *model.Server) chan *model.Server {
+// dataScraper scrapes target until ctx is done. The first scrape continues
+// the trace in ctx, e.g. the request that added the server, later scrapes
+// start traces of their own linked to it. A failed scrape reports the server
+// offline and is retried after scrapeRetry.
+func (o *Observer) dataScraper(ctx context.Context, target *model.Server) chan scrapeResult {
 	scrapesCtr, err := meter.Int64UpDownCounter(
 		"scrapeCtr",
 		metric.WithDescription("number of data scrapes from steam server"),
@@ -92,66 +127,131 @@ func (o *Observer) dataScraper(ctx context.Context, target *model.Server) chan *
 		return nil
 	}
 
-	out := make(chan *model.Server)
+	out := make(chan scrapeResult)
 	go func() {
 		defer close(out)
+		spawned := trace.SpanContextFromContext(ctx)
+		first := true
+		var last *model.Server
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
-				helpSrv, err := steam.Connect(target.Addr)
-				if err != nil {
-					o.logger.ErrorContext(ctx, "error connecting to endpoint", "error", err)
-					continue
+				opts := []trace.SpanStartOption{
+					trace.WithAttributes(
+						attribute.String("server.id", target.ID.String()),
+						attribute.String("server.addr", target.Addr),
+					),
 				}
-
-				infoResponse, err := helpSrv.Info()
-				if err != nil {
-					o.logger.ErrorContext(ctx, "error fetching ServerInfo", "error", err)
-					failedScrapesCtr.Add(ctx, 1)
-					continue
+				if !first {
+					opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: spawned}))
 				}
-				scrapesCtr.Add(ctx, 1)
+				first = false
 
-				playerResponse, err := helpSrv.PlayersInfo()
+				scrapeCtx, span := tracer.Start(ctx, "scrape", opts...)
+				server, err := o.scrape(scrapeCtx, target, scrapesCtr, failedScrapesCtr)
 				if err != nil {
-					o.logger.ErrorContext(ctx, "error fetching PlayersInfo", "error", err)
-					continue
-				}
-
-				ping, err := helpSrv.Ping()
-				if err != nil {
-					o.logger.ErrorContext(ctx, "failed to ping server", "error", err)
-					continue
-				}
-
-				var status bool
-				if ping < time.Duration(5*time.Second) {
-					status = true
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+					server = offline(target, last)
+				} else {
+					last = server
 				}
+				span.End()
 
-				server := &model.Server{
-					Name:        target.Name,
-					Addr:        target.Addr,
-					ID:          target.ID,
-					Status:      status,
-					ServerInfo:  model.ToServerInfo(infoResponse),
-					PlayersInfo: model.ToPlayerInfo(playerResponse),
-				}
-				replaceNullCharsInStruct(server)
-				server = correctPlayerNum(server)
 				select {
-				case out <- server:
+				case out <- scrapeResult{ctx: scrapeCtx, server: server, err: err}:
 				default:
 				}
+
+				if err != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(scrapeRetry):
+					}
+				}
 			}
 		}
 	}()
 	return out
 }
 
-func (o *Observer) scanner(ctx context.Context, in chan *model.Server) chan *model.Server {
+// offline returns the state of target after a failed scrape. It keeps the
+// server info of the last successful scrape, so the server keeps its name
+// and slots, but has no players.
+func offline(target *model.Server, last *model.Server) *model.Server {
+	server := &model.Server{
+		Name: target.Name,
+		Addr: target.Addr,
+		ID:   target.ID,
+		ServerState: model.ServerState{
+			PlayersInfo: &model.PlayersInfo{},
+			Updated:     time.Now(),
+		},
+	}
+	if last != nil && last.ServerInfo != nil {
+		info := *last.ServerInfo
+		info.Players = 0
+		server.ServerInfo = &info
+	}
+	return server
+}
+
+func (o *Observer) scrape(
+	ctx context.Context,
+	target *model.Server,
+	scrapesCtr, failedScrapesCtr metric.Int64UpDownCounter,
+) (*model.Server, error) {
+	helpSrv, err := steam.Connect(target.Addr)
+	if err != nil {
+		o.logger.ErrorContext(ctx, "error connecting to endpoint", "error", err)
+		return nil, err
+	}
+
+	infoResponse, err := helpSrv.Info()
+	if err != nil {
+		o.logger.ErrorContext(ctx, "error fetching ServerInfo", "error", err)
+		failedScrapesCtr.Add(ctx, 1)
+		return nil, err
+	}
+	scrapesCtr.Add(ctx, 1)
+
+	playerResponse, err := helpSrv.PlayersInfo()
+	if err != nil {
+		o.logger.ErrorContext(ctx, "error fetching PlayersInfo", "error", err)
+		return nil, err
+	}
+
+	ping, err := helpSrv.Ping()
+	if err != nil {
+		o.logger.ErrorContext(ctx, "failed to ping server", "error", err)
+		return nil, err
+	}
+
+	var status bool
+	if ping < time.Duration(5*time.Second) {
+		status = true
+	}
+
+	server := &model.Server{
+		Name: target.Name,
+		Addr: target.Addr,
+		ID:   target.ID,
+		ServerState: model.ServerState{
+			Status:      status,
+			Latency:     ping,
+			ServerInfo:  model.ToServerInfo(infoResponse),
+			PlayersInfo: model.ToPlayerInfo(playerResponse),
+		},
+	}
+	replaceNullCharsInStruct(server)
+	server.Updated = time.Now()
+	return correctPlayerNum(server), nil
+}
+
+func (o *Observer) scanner(ctx context.Context, in chan scrapeResult) chan scrapeResult {
 	scanCtr, err := meter.Int64UpDownCounter(
 		"scanCtr",
 		metric.WithDescription("number of scans happened"),
@@ -160,7 +260,7 @@ func (o *Observer) scanner(ctx context.Context, in chan *model.Server) chan *mod
 		return nil
 	}
 
-	out := make(chan *model.Server)
+	out := make(chan scrapeResult)
 	go func() {
 		defer close(out)
 		previousPlayers := make(map[string]*NotificationStatus)
@@ -168,17 +268,31 @@ func (o *Observer) scanner(ctx context.Context, in chan *model.Server) chan *mod
 			select {
 			case <-ctx.Done():
 				return
-			case server, ok := <-in:
+			case result, ok := <-in:
 				if !ok {
 					return
 				}
-				blacklist := o.blacklist.List(ctx)
-				if server.PlayersInfo == nil {
+				if result.err != nil {
+					// the players of an offline server are unknown, they
+					// neither joined nor left
+					select {
+					case out <- result:
+					default:
+					}
+					continue
+				}
+				if result.server.PlayersInfo == nil {
 					continue
 				}
-				previousPlayers = o.scan(blacklist, server, previousPlayers)
+				scanCtx, span := tracer.Start(result.ctx, "scan", trace.WithAttributes(
+					attribute.String("server.id", result.server.ID.String()),
+					attribute.Int("players", len(result.server.PlayersInfo.Players)),
+				))
+				blacklist := o.blacklist.List(scanCtx)
+				previousPlayers = o.scan(scanCtx, blacklist, result.server, previousPlayers)
+				span.End()
 				select {
-				case out <- server:
+				case out <- scrapeResult{ctx: scanCtx, server: result.server}:
 					scanCtr.Add(ctx, 1)
 				default:
 				}
@@ -189,20 +303,29 @@ func (o *Observer) scanner(ctx context.Context, in chan *model.Server) chan *mod
 }
 
 func (o *Observer) scan(
+	ctx context.Context,
 	blacklist []*model.BlacklistPlayers,
 	server *model.Server,
 	previousPlayers map[string]*NotificationStatus,
 ) map[string]*NotificationStatus {
 
-	blacklistMap := make(map[string]bool)
+	blacklistMap := make(map[string]*model.BlacklistPlayers)
 	for _, blacklistedPlayer := range blacklist {
-		blacklistMap[blacklistedPlayer.Name] = true
+		for _, name := range blacklistedPlayer.Names() {
+			blacklistMap[name] = blacklistedPlayer
+		}
 	}
 
 	for _, status := range previousPlayers {
 		status.isActive = false
 	}
 
+	players, maxPlayers := server.PlayerCount()
+	var mapName string
+	if server.ServerInfo != nil {
+		mapName = server.ServerInfo.Map
+	}
+
 	for _, player := range server.PlayersInfo.Players {
 		status, exists := previousPlayers[player.Name]
 		if !exists {
@@ -211,14 +334,26 @@ func (o *Observer) scan(
 		}
 		status.isActive = true
 
-		if blacklistMap[player.Name] {
+		if person, tracked := blacklistMap[player.Name]; tracked {
 			if !status.joinedNotified {
-				o.em.Publish(
-					events.EventMessage{
-						Type:    "player.joined",
-						Payload: player.Name + " joined the server " + server.Name,
-					},
-				)
+				now := time.Now()
+				o.em.Publish(ctx, events.PlayerJoined{
+					ServerID:    server.ID,
+					ServerName:  server.Name,
+					ServerAddr:  server.Addr,
+					ConnectAddr: server.ConnectAddr(),
+					Map:         mapName,
+					Players:     players,
+					MaxPlayers:  maxPlayers,
+					Name:        player.Name,
+					Entry:       person,
+					Time:        now,
+				})
+				o.recordSighting(ctx, person, model.Sighting{
+					Alias:  player.Name,
+					Server: server.Name,
+					Joined: now,
+				})
 				status.joinedNotified = true
 				status.leftNotified = false
 			}
@@ -226,13 +361,26 @@ func (o *Observer) scan(
 	}
 
 	for playerName, status := range previousPlayers {
-		if blacklistMap[playerName] && !status.isActive && !status.leftNotified {
-			o.em.Publish(
-				events.EventMessage{
-					Type:    "player.left",
-					Payload: playerName + " left the server " + server.Name,
-				},
-			)
+		person, tracked := blacklistMap[playerName]
+		if tracked && !status.isActive && !status.leftNotified {
+			now := time.Now()
+			o.em.Publish(ctx, events.PlayerLeft{
+				ServerID:    server.ID,
+				ServerName:  server.Name,
+				ServerAddr:  server.Addr,
+				ConnectAddr: server.ConnectAddr(),
+				Map:         mapName,
+				Players:     players,
+				MaxPlayers:  maxPlayers,
+				Name:        playerName,
+				Entry:       person,
+				Time:        now,
+			})
+			o.recordSighting(ctx, person, model.Sighting{
+				Alias:  playerName,
+				Server: server.Name,
+				Left:   now,
+			})
 			status.leftNotified = true
 			status.joinedNotified = false
 		}
@@ -241,6 +389,13 @@ func (o *Observer) scan(
 	return previousPlayers
 }
 
+func (o *Observer) recordSighting(ctx context.Context, person *model.BlacklistPlayers, sighting model.Sighting) {
+	err := o.blacklist.RecordSighting(ctx, person.ID, sighting)
+	if err != nil {
+		o.logger.ErrorContext(ctx, "failed to record sighting", "error", err, "person", person.Name)
+	}
+}
+
 func (o *Observer) spawnScraper(ctx context.Context) {
 	select {
 	case <-ctx.Done():
@@ -279,14 +434,11 @@ func (o *Observer) processResults(ctx context.Context) {
 				select {
 				case <-ctx.Done():
 					return
-				case result := <-ch:
-					if result == nil {
+				case result, ok := <-ch:
+					if !ok || result.server == nil {
 						continue
 					}
-					err := o.serverStore.Update(ctx, result)
-					if err != nil {
-						o.logger.Error("failed to update server info", "error", err)
-					}
+					o.update(result)
 					processCtr.Add(ctx, 1)
 				}
 			}
@@ -295,13 +447,42 @@ func (o *Observer) processResults(ctx context.Context) {
 	}
 }
 
+// update stores the scraped state and records it into the history.
+func (o *Observer) update(result scrapeResult) {
+	server := result.server
+	ctx, span := tracer.Start(result.ctx, "update", trace.WithAttributes(
+		attribute.String("server.id", server.ID.String()),
+		attribute.Bool("server.online", server.Status),
+	))
+	defer span.End()
+
+	o.states.SetState(ctx, server.ID, server.ServerState)
+	err := o.history.Record(ctx, server.ID, history.Sample{
+		Time:    server.Updated,
+		Players: len(server.PlayersInfo.Players),
+		Status:  server.Status,
+		Latency: server.Latency,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		o.logger.ErrorContext(ctx, "failed to record server history", "error", err)
+	}
+}
+
 func (o *Observer) addScraper(ctx context.Context, target *model.Server) error {
+	ctx, span := tracer.Start(ctx, "addScraper", trace.WithAttributes(
+		attribute.String("server.id", target.ID.String()),
+	))
+	defer span.End()
+
 	err := o.readEndpoint(target)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	// keep the span of ctx, so the first scrape continues its trace
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(o.ctx, span.SpanContext()))
 	o.cancelFuncs[target.ID] = cancel
 	pipeCh := o.dataScraper(ctx, target)
 	processCh := o.scanner(ctx, pipeCh)
@@ -317,7 +498,7 @@ func (o *Observer) killScraper(targetID uuid.UUID) error {
 		cancel()
 		delete(o.cancelFuncs, targetID)
 		delete(o.endpoints, targetID)
-		close(o.resultCh[targetID])
+		// the scanner closes its channel once the context is cancelled
 		delete(o.resultCh, targetID)
 		return nil
 	}
@@ -325,29 +506,25 @@ func (o *Observer) killScraper(targetID uuid.UUID) error {
 }
 
 func (o *Observer) HandleEvent(ctx context.Context, event events.EventMessage) {
-	switch event.Type {
-	case "init":
+	switch e := event.Payload.(type) {
+	case events.Init:
 		o.spawnScraper(ctx)
-	case "server.added":
-		server, ok := event.Payload.(*model.Server)
-		if !ok {
-			o.logger.ErrorContext(ctx, "invalid payload type", "error", event.Type)
-			return
-		}
-		err := o.addScraper(ctx, server)
+	case events.ServerAdded:
+		err := o.addScraper(ctx, e.Server)
 		if err != nil {
 			o.logger.ErrorContext(ctx, "failed to add scraper", "error", err)
 			return
 		}
-	case "server.deleted":
-		id, ok := event.Payload.(uuid.UUID)
-		if !ok {
-			o.logger.ErrorContext(ctx, "invalid payload type", "error", event.Type)
+	case events.ServerDeleted:
+		err := o.killScraper(e.ServerID)
+		if err != nil {
+			o.logger.ErrorContext(ctx, "failed to add scraper", "error", err)
 			return
 		}
-		err := o.killScraper(id)
+		o.states.DeleteState(ctx, e.ServerID)
+		err = o.history.Delete(ctx, e.ServerID)
 		if err != nil {
-			o.logger.ErrorContext(ctx, "failed to add scraper", "error", err)
+			o.logger.ErrorContext(ctx, "failed to delete server history", "error", err)
 			return
 		}
 	default:
@@ -368,6 +545,9 @@ func replaceNullCharsInStruct(s any) {
 func replaceNullChars(v reflect.Value) {
 	switch v.Kind() {
 	case reflect.String:
+		if !v.CanSet() {
+			return
+		}
 		str := v.Interface().(string)
 		str = strings.Trim(str, "\u0000")
 		v.SetString(str)
@@ -0,0 +1,139 @@
+package observer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/history"
+	"github.com/led0nk/ark-overseer/internal/livestate"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScraperOutlivesHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := &Observer{
+		ctx:         ctx,
+		endpoints:   make(map[uuid.UUID]*model.Server),
+		cancelFuncs: make(map[uuid.UUID]context.CancelFunc),
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		resultCh:    make(map[uuid.UUID]chan scrapeResult),
+	}
+
+	server := &model.Server{ID: uuid.New(), Name: "test", Addr: "127.0.0.1:1"}
+	handlerCtx, handlerCancel := context.WithCancel(ctx)
+	o.HandleEvent(handlerCtx, events.EventMessage{
+		Type:    events.ServerAdded{}.Topic(),
+		Payload: events.ServerAdded{Server: server},
+	})
+	// the event manager cancels the context once the handler returns
+	handlerCancel()
+
+	results := o.resultCh[server.ID]
+	assert.NotNil(t, results)
+	select {
+	case _, ok := <-results:
+		assert.True(t, ok, "scraper stopped with the handler context")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, o.killScraper(server.ID))
+	select {
+	case _, ok := <-drain(results):
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("scraper was not stopped by killScraper")
+	}
+}
+
+type recorder struct {
+	history.Recorder
+	samples []history.Sample
+	mu      sync.Mutex
+}
+
+func (r *recorder) Record(_ context.Context, _ uuid.UUID, sample history.Sample) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, sample)
+	return nil
+}
+
+func (r *recorder) last() (history.Sample, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) == 0 {
+		return history.Sample{}, false
+	}
+	return r.samples[len(r.samples)-1], true
+}
+
+func TestFailedScrapeReportsOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	states := livestate.NewMemoryStore()
+	history := &recorder{}
+	o := &Observer{
+		ctx:         ctx,
+		endpoints:   make(map[uuid.UUID]*model.Server),
+		cancelFuncs: make(map[uuid.UUID]context.CancelFunc),
+		states:      states,
+		history:     history,
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		resultCh:    make(map[uuid.UUID]chan scrapeResult),
+	}
+
+	server := &model.Server{ID: uuid.New(), Name: "test", Addr: "127.0.0.1:1"}
+	assert.NoError(t, o.addScraper(ctx, server))
+	go o.processResults(ctx)
+
+	// update sets the state before it records the sample
+	assert.Eventually(t, func() bool {
+		_, ok := history.last()
+		return ok
+	}, 3*time.Second, 10*time.Millisecond)
+	state, _ := states.GetState(ctx, server.ID)
+	assert.False(t, state.Status)
+	assert.NotNil(t, state.PlayersInfo)
+
+	sample, ok := history.last()
+	assert.True(t, ok)
+	assert.False(t, sample.Status)
+	assert.Equal(t, 0, sample.Players)
+}
+
+func TestOffline(t *testing.T) {
+	target := &model.Server{ID: uuid.New(), Name: "test", Addr: "127.0.0.1:27015"}
+	server := offline(target, nil)
+	assert.False(t, server.Status)
+	assert.Nil(t, server.ServerInfo)
+	assert.Empty(t, server.PlayersInfo.Players)
+
+	last := &model.Server{ServerState: model.ServerState{
+		Status:     true,
+		ServerInfo: &model.ServerInfo{Name: "The Island", Players: 3, MaxPlayers: 70},
+	}}
+	server = offline(target, last)
+	assert.Equal(t, &model.ServerInfo{Name: "The Island", MaxPlayers: 70}, server.ServerInfo)
+	assert.Equal(t, 3, last.ServerInfo.Players, "the last scrape must not change")
+}
+
+// drain discards results until the channel is closed.
+func drain(results chan scrapeResult) chan scrapeResult {
+	done := make(chan scrapeResult)
+	go func() {
+		for range results {
+		}
+		close(done)
+	}()
+	return done
+}
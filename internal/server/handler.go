@@ -3,17 +3,27 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/a-h/templ"
 	"github.com/google/uuid"
 	"github.com/led0nk/ark-overseer/cmd/web"
+	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/history"
+	"github.com/led0nk/ark-overseer/internal/journal"
 	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -67,7 +77,8 @@ func (s *Server) showPlayers(w http.ResponseWriter, r *http.Request) {
 		s.logger.ErrorContext(ctx, "failed to get server", "error", err)
 		return
 	}
-	err = web.Render(ctx, w, web.PlayerTable(server))
+	lists := blacklist.Lists(s.blacklist.List(ctx))
+	err = web.Render(ctx, w, web.PlayerTable(server, lists))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -76,129 +87,384 @@ func (s *Server) showPlayers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// sseServerUpdate streams the status and player counter of a server. It
+// only writes when the scraped state of the server changes.
 func (s *Server) sseServerUpdate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	ctx, span := tracer.Start(ctx, "sseServerUpdate")
+	defer span.End()
 
-	type event struct {
-		Type string
-		Data any
+	updates, err := s.watchServer(ctx, w, r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
 	}
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	dataCh := make(chan event)
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case event := <-dataCh:
-				fmt.Fprintf(w, "event: %s\n", event.Type)
-				fmt.Fprintf(w, "data: %s\n\n", event.Data)
-				w.(http.Flusher).Flush()
+
+	for srv := range updates {
+		if srv.ServerInfo == nil {
+			continue
+		}
+		players := srv.ServerInfo.Players
+		status := `<span class="inline-flex items-center gap-1 rounded-full dark:bg-[#0D1117] bg-green-50 px-2 py-1 text-xs font-semibold text-green-600"><span class="h-1.5 w-1.5 rounded-full bg-green-600"></span>online</span>`
+		if !srv.Status {
+			players = 0
+			status = `<span class="inline-flex items-center gap-1 rounded-full dark:bg-[#0D1117] bg-red-50 px-2 py-1 text-xs font-semibold text-red-600"><span class="h-1.5 w-1.5 rounded-full bg-red-600"></span>offline</span>`
+		}
+		playerInfo := strconv.Itoa(players) + "/" + strconv.Itoa(srv.ServerInfo.MaxPlayers)
+		writeEvent(w, "PlayerCounter", playerInfo)
+		writeEvent(w, "ServerStatus", status)
+	}
+}
+
+// ssePlayerInfo streams the player rows of a server whenever its player
+// list changes.
+func (s *Server) ssePlayerInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "ssePlayerInfo")
+	defer span.End()
+
+	updates, err := s.watchServer(ctx, w, r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	for data := range updates {
+		if data.PlayersInfo == nil {
+			continue
+		}
+		tracked := make(map[string]bool)
+		for _, entry := range s.blacklist.List(ctx) {
+			for _, name := range entry.Names() {
+				tracked[name] = true
 			}
 		}
-	}(ctx)
-
-	go func() {
-		defer close(dataCh)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				id, err := uuid.Parse(r.PathValue("ID"))
-				if err != nil {
-					span.RecordError(err)
-					span.SetStatus(codes.Error, err.Error())
-					s.logger.ErrorContext(ctx, "failed to parse uuid", "error", err)
-					continue
-				}
-				srv, err := s.sStore.GetByID(ctx, id)
-				if err != nil {
-					span.RecordError(err)
-					span.SetStatus(codes.Error, err.Error())
-					s.logger.ErrorContext(ctx, "failed to get server", "error", err)
-					continue
-				}
-				if srv.ServerInfo == nil {
-					span.RecordError(err)
-					span.SetStatus(codes.Error, err.Error())
-					s.logger.ErrorContext(ctx, "server not found", "error", err)
-					time.Sleep(time.Second)
-					continue
-				}
-				status := `<span class="inline-flex items-center gap-1 rounded-full dark:bg-[#0D1117] bg-green-50 px-2 py-1 text-xs font-semibold text-green-600"><span class="h-1.5 w-1.5 rounded-full bg-green-600"></span>online</span>`
-				if !srv.Status {
-					srv.ServerInfo.Players = 0
-					status = `<span class="inline-flex items-center gap-1 rounded-full dark:bg-[#0D1117] bg-red-50 px-2 py-1 text-xs font-semibold text-red-600"><span class="h-1.5 w-1.5 rounded-full bg-red-600"></span>offline</span>`
-				}
-				playerInfo := strconv.Itoa(srv.ServerInfo.Players) + "/" + strconv.Itoa(srv.ServerInfo.MaxPlayers)
-				select {
-				case dataCh <- event{Type: "PlayerCounter", Data: playerInfo}:
-				default:
-				}
-				select {
-				case dataCh <- event{Type: "ServerStatus", Data: status}:
-				default:
-				}
-				time.Sleep(5 * time.Second)
+		var buffer bytes.Buffer
+		for _, player := range data.PlayersInfo.Players {
+			err := web.PlayerRow(player, data.Name, tracked[player.Name]).Render(ctx, &buffer)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+				continue
 			}
 		}
-	}()
-	<-ctx.Done()
+		writeEvent(w, "", buffer.String())
+	}
 }
 
-func (s *Server) ssePlayerInfo(w http.ResponseWriter, r *http.Request) {
+// watchServer subscribes to the server given by the ID path value and
+// prepares w for server-sent events. On failure the error response has
+// already been written.
+func (s *Server) watchServer(ctx context.Context, w http.ResponseWriter, r *http.Request) (<-chan *model.Server, error) {
+	id, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		http.Error(w, "invalid server id", http.StatusBadRequest)
+		return nil, err
+	}
+
+	updates, err := s.watcher.Watch(ctx, id)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to watch server", "error", err)
+		http.Error(w, "server not found", http.StatusNotFound)
+		return nil, err
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	w.(http.Flusher).Flush()
+	return updates, nil
+}
+
+// writeEvent writes a single server-sent event and flushes it. An empty
+// name sends an unnamed message event.
+func writeEvent(w http.ResponseWriter, name string, data string) {
+	if name != "" {
+		fmt.Fprintf(w, "event: %s\n", name)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(data, "\n", ""))
+	w.(http.Flusher).Flush()
+}
+
+// serverHistory returns the player count history of a server as JSON. The
+// range defaults to the last 24 hours in 5 minute steps.
+func (s *Server) serverHistory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	ctx, _ = tracer.Start(ctx, "ssePlayerInfo")
-	dataCh := make(chan *model.Server)
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	go func(ctx context.Context) {
-		defer close(dataCh)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				srv, err := s.sStore.GetByID(ctx, uuid.MustParse(r.PathValue("ID")))
-				if err != nil {
-					s.logger.ErrorContext(ctx, "failed to get server", "error", err)
-				}
-				dataCh <- srv
-				time.Sleep(1 * time.Second)
-			}
+	ctx, span := tracer.Start(ctx, "serverHistory")
+	defer span.End()
+
+	id, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "invalid server id", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseHistoryQuery(id, r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, err := s.history.Query(ctx, query)
+	if errors.Is(err, history.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to query history", "error", err)
+		http.Error(w, "failed to query history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(points)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to encode history", "error", err)
+	}
+}
+
+func parseHistoryQuery(id uuid.UUID, r *http.Request) (history.Query, error) {
+	query := history.Query{
+		ServerID:    id,
+		To:          time.Now(),
+		Step:        5 * time.Minute,
+		Aggregation: history.Aggregation(r.URL.Query().Get("agg")),
+	}
+	query.From = query.To.Add(-24 * time.Hour)
+
+	var err error
+	if from := r.URL.Query().Get("from"); from != "" {
+		query.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return query, fmt.Errorf("invalid from: %w", err)
 		}
-	}(ctx)
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case data := <-dataCh:
-				var buffer bytes.Buffer
-				for _, player := range data.PlayersInfo.Players {
-					playerRow := fmt.Sprintf(`<tr class="hover:bg-gray-50 dark:hover:bg-[#21262d]/50"><td class="px-6 py-4"><div class="font-medium text-gray-700 dark:text-gray-200">%s</div></td><td class="px-6 py-4"><div class="font-medium text-gray-700 dark:text-gray-200">%s</div></td></tr>`, player.Name, player.Duration)
-					buffer.WriteString(playerRow)
-				}
-				fmt.Fprintf(w, "data: %s\n\n", buffer.String())
-				w.(http.Flusher).Flush()
-			}
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		query.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return query, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if step := r.URL.Query().Get("step"); step != "" {
+		query.Step, err = time.ParseDuration(step)
+		if err != nil {
+			return query, fmt.Errorf("invalid step: %w", err)
+		}
+	}
+	return query, nil
+}
+
+// journalPage lists the most recent journal entries matching the filter in
+// the query string.
+func (s *Server) journalPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "journalPage")
+	defer span.End()
+
+	filter := journalFilter(r)
+	query, err := parseJournalQuery(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Limit = journalPageSize
+
+	entries, err := s.journal.Query(ctx, query)
+	if errors.Is(err, journal.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to query journal", "error", err)
+		http.Error(w, "failed to query journal", http.StatusInternalServerError)
+		return
+	}
+
+	servers, err := s.sStore.List(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list servers", "error", err)
+	}
+
+	err = web.Render(ctx, w, web.Journal(entries, servers, s.journal.Subscribers(), filter))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+		return
+	}
+}
+
+// statusPage reports the health of the event subscribers as JSON. It
+// responds with 503 while any of them is unhealthy, so it can be used as a
+// health check.
+func (s *Server) statusPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "statusPage")
+	defer span.End()
+
+	status := struct {
+		Status      string          `json:"status"`
+		Subscribers []events.Health `json:"subscribers"`
+	}{
+		Status:      "ok",
+		Subscribers: s.status.Health(),
+	}
+	for _, health := range status.Subscribers {
+		if !health.Healthy {
+			status.Status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to encode status", "error", err)
+	}
+}
+
+// journalEntries returns the matching journal entries as JSON, oldest first.
+// It takes the filters of the journal page plus an optional limit.
+func (s *Server) journalEntries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "journalEntries")
+	defer span.End()
+
+	query, err := parseJournalQuery(journalFilter(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.journal.Query(ctx, query)
+	if errors.Is(err, journal.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to query journal", "error", err)
+		http.Error(w, "failed to query journal", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []journal.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to encode journal", "error", err)
+	}
+}
+
+// journalReplay re-sends the journal entries matching the form filter to a
+// single subscriber.
+func (s *Server) journalReplay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "journalReplay")
+	defer span.End()
+
+	err := r.ParseForm()
+	if err != nil {
+		s.renderError(ctx, w, fmt.Errorf("%w: %w", journal.ErrInvalidQuery, err))
+		return
+	}
+
+	query, err := parseJournalQuery(journalFilter(r))
+	if err != nil {
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	subscriber := r.FormValue("subscriber")
+	if !journal.CanReplayTo(subscriber) {
+		s.renderError(ctx, w, fmt.Errorf("%w: cannot replay to %q, only to notifiers", journal.ErrInvalidQuery, subscriber))
+		return
+	}
+
+	count, err := s.journal.Replay(ctx, query, subscriber)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to replay journal", "error", err, "subscriber", subscriber)
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	err = web.Render(ctx, w, web.ReplayResult(subscriber, count))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+	}
+}
+
+const journalPageSize = 200
+
+func journalFilter(r *http.Request) web.JournalFilter {
+	return web.JournalFilter{
+		Type:     r.FormValue("type"),
+		ServerID: r.FormValue("server"),
+		From:     r.FormValue("from"),
+		To:       r.FormValue("to"),
+	}
+}
+
+// journalTimeLayout is the format of datetime-local inputs, RFC 3339 is
+// accepted as well.
+const journalTimeLayout = "2006-01-02T15:04"
+
+func parseJournalQuery(filter web.JournalFilter) (journal.Query, error) {
+	var query journal.Query
+	if filter.Type != "" {
+		query.Types = []string{filter.Type}
+	}
+
+	var err error
+	if filter.ServerID != "" {
+		query.ServerID, err = uuid.Parse(filter.ServerID)
+		if err != nil {
+			return query, fmt.Errorf("%w: invalid server", journal.ErrInvalidQuery)
 		}
-	}()
-	<-ctx.Done()
+	}
+	query.From, err = parseJournalTime(filter.From)
+	if err != nil {
+		return query, fmt.Errorf("%w: invalid from", journal.ErrInvalidQuery)
+	}
+	query.To, err = parseJournalTime(filter.To)
+	if err != nil {
+		return query, fmt.Errorf("%w: invalid to", journal.ErrInvalidQuery)
+	}
+	return query, nil
+}
+
+func parseJournalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(journalTimeLayout, value, time.Local)
 }
 
 func (s *Server) deleteServer(w http.ResponseWriter, r *http.Request) {
@@ -251,16 +517,17 @@ func (s *Server) addServer(w http.ResponseWriter, r *http.Request) {
 		Name: html.EscapeString(r.FormValue("servername")),
 		Addr: html.EscapeString(r.FormValue("address")),
 	}
-	_, err = s.sStore.Create(ctx, newServer)
+	created, err := s.sStore.Create(ctx, newServer)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		s.logger.ErrorContext(ctx, "failed to create server", "error", err)
+		return
 	}
 
 	time.Sleep(1 * time.Second)
 
-	_, err = s.sStore.GetByID(ctx, newServer.ID)
+	_, err = s.sStore.GetByID(ctx, created.ID)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -283,11 +550,65 @@ func (s *Server) blacklistPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// notifierFields are the settings of every notifier type on the setup page.
+// Settings only set in config.yaml, like the ntfy events or webhook headers,
+// are kept when a form is saved.
+var notifierFields = map[string][]web.NotifierField{
+	config.DiscordKey: {
+		{Key: "token", Label: "Token", Type: "password", Placeholder: "Discord token..."},
+		{Key: "channelID", Label: "Channel-ID", Type: "text", Placeholder: "Channel-ID..."},
+	},
+	config.TelegramKey: {
+		{Key: "token", Label: "Bot-Token", Type: "password", Placeholder: "Telegram bot token..."},
+		{Key: "chatID", Label: "Chat-ID", Type: "text", Placeholder: "Chat-ID or @channel..."},
+	},
+	config.MatrixKey: {
+		{Key: "homeserver", Label: "Homeserver", Type: "url", Placeholder: "https://matrix.org"},
+		{Key: "accessToken", Label: "Access-Token", Type: "password", Placeholder: "Matrix access token..."},
+		{Key: "roomID", Label: "Room-ID", Type: "text", Placeholder: "!room:matrix.org"},
+	},
+	config.SMTPKey: {
+		{Key: "host", Label: "Host", Type: "text", Placeholder: "smtp.example.com"},
+		{Key: "port", Label: "Port", Type: "number", Placeholder: "587 (default of the security)"},
+		{Key: "security", Label: "Security", Type: "text", Placeholder: "starttls, tls or none"},
+		{Key: "username", Label: "Username", Type: "text", Placeholder: "Optional..."},
+		{Key: "password", Label: "Password", Type: "password", Placeholder: "Optional..."},
+		{Key: "from", Label: "From", Type: "text", Placeholder: "Ark-Overseer <ark@example.com>"},
+		{Key: "to", Label: "To", Type: "text", Placeholder: "admin@example.com, staff@example.com", List: true},
+	},
+	config.NtfyKey: {
+		{Key: "url", Label: "Topic-URL", Type: "url", Placeholder: "https://ntfy.sh/ark-alerts"},
+		{Key: "token", Label: "Access-Token", Type: "password", Placeholder: "Optional, for protected topics..."},
+	},
+	config.GotifyKey: {
+		{Key: "url", Label: "Server-URL", Type: "url", Placeholder: "https://gotify.example.com"},
+		{Key: "token", Label: "App-Token", Type: "password", Placeholder: "Gotify application token..."},
+		{Key: "priority", Label: "Priority", Type: "number", Placeholder: "5 (tracked players joining are pushed with 10)"},
+	},
+	config.WebhookKey: {
+		{Key: "url", Label: "URL", Type: "url", Placeholder: "https://example.com/hook"},
+		{Key: "secret", Label: "Secret", Type: "password", Placeholder: "Optional, signs the body..."},
+	},
+}
+
+var (
+	errUnknownNotifier   = errors.New("notifier not found")
+	errDuplicateNotifier = errors.New("notifier already exists")
+)
+
 func (s *Server) setupPage(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	ctx, span := tracer.Start(ctx, "setupPage")
+	defer span.End()
+
+	var notifiers []web.NotifierSettings
+	for _, item := range s.notifierInstances() {
+		if instance, ok := item.(map[interface{}]interface{}); ok {
+			notifiers = append(notifiers, notifierSettings(instance))
+		}
+	}
 
-	err := web.Render(ctx, w, web.Setup())
+	err := web.Render(ctx, w, web.Setup(notifiers, config.NotifierTypes))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -296,10 +617,58 @@ func (s *Server) setupPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// NOTE: possible implementation of other services
-func (s *Server) saveChanges(w http.ResponseWriter, r *http.Request) {
+// addNotifier appends an instance without settings to the notifier list
+// and renders its form.
+func (s *Server) addNotifier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "addNotifier")
+	defer span.End()
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	typ := r.FormValue("type")
+	err := config.CheckInstanceName(name)
+	if err == nil && !slices.Contains(config.NotifierTypes, typ) {
+		err = fmt.Errorf("%w: unknown type %q", config.ErrInvalidInstance, typ)
+	}
+	if err != nil {
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	instance := map[interface{}]interface{}{
+		"name":     name,
+		"type":     typ,
+		"settings": map[interface{}]interface{}{},
+	}
+	s.logger.InfoContext(ctx, "adding notifier", "name", name, "type", typ)
+	err = s.modifyNotifiers(ctx, func(instances []interface{}) ([]interface{}, error) {
+		if i, _ := findNotifier(instances, name); i >= 0 {
+			return nil, fmt.Errorf("%w: %s", errDuplicateNotifier, name)
+		}
+		return append(instances, instance), nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to update config", "error", err)
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	err = web.Render(ctx, w, web.NotifierCard(notifierSettings(instance)))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+	}
+}
+
+// saveNotifier stores the settings form of a notifier instance. Secret
+// fields left empty keep their current value, the form never renders them,
+// unless they are listed in the clear values of the form.
+func (s *Server) saveNotifier(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	ctx, span := tracer.Start(ctx, "saveChanges")
+	name := r.PathValue("name")
+	ctx, span := tracer.Start(ctx, "saveNotifier", trace.WithAttributes(attribute.String("notifier", name)))
+	defer span.End()
 
 	err := r.ParseForm()
 	if err != nil {
@@ -309,19 +678,158 @@ func (s *Server) saveChanges(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sectionMap := make(map[interface{}]interface{})
-	sectionMap["token"] = r.FormValue("token")
-	sectionMap["channelID"] = r.FormValue("channelID")
+	var saved map[interface{}]interface{}
+	err = s.modifyNotifiers(ctx, func(instances []interface{}) ([]interface{}, error) {
+		i, instance := findNotifier(instances, name)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", errUnknownNotifier, name)
+		}
+
+		typ, _ := instance["type"].(string)
+		settings, ok := instance["settings"].(map[interface{}]interface{})
+		if !ok {
+			settings = make(map[interface{}]interface{})
+		}
+		for _, field := range notifierFields[typ] {
+			value := strings.TrimSpace(r.FormValue(field.Key))
+			switch {
+			case config.IsSecret(field.Key) && slices.Contains(r.Form["clear"], field.Key):
+				delete(settings, field.Key)
+			case value == "" && config.IsSecret(field.Key):
+				continue
+			case value == "":
+				delete(settings, field.Key)
+			case field.List:
+				settings[field.Key] = configList(splitList(value))
+			default:
+				settings[field.Key] = value
+			}
+		}
+		instance["settings"] = settings
+		if topics := splitList(r.FormValue("events")); len(topics) > 0 {
+			instance["events"] = configList(topics)
+		} else {
+			delete(instance, "events")
+		}
+		s.logger.InfoContext(ctx, "updating notifier", "name", name, "settings", config.Redact(settings))
+
+		saved = instance
+		return instances, nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to update config", "error", err)
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	err = web.Render(ctx, w, web.NotifierCard(notifierSettings(saved)))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+	}
+}
+
+func (s *Server) deleteNotifier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("name")
+	ctx, span := tracer.Start(ctx, "deleteNotifier", trace.WithAttributes(attribute.String("notifier", name)))
+	defer span.End()
 
-	err = s.config.Update("notification-service", "discord", sectionMap)
+	s.logger.InfoContext(ctx, "deleting notifier", "name", name)
+	err := s.modifyNotifiers(ctx, func(instances []interface{}) ([]interface{}, error) {
+		i, _ := findNotifier(instances, name)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", errUnknownNotifier, name)
+		}
+		return slices.Delete(instances, i, i+1), nil
+	})
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		s.logger.ErrorContext(ctx, "failed to update config", "error", err)
+		s.renderError(ctx, w, err)
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusFound)
+	// an empty 200 lets htmx replace the card with nothing
+	w.WriteHeader(http.StatusOK)
+}
+
+// modifyNotifiers replaces the notifier list by the result of fn. The
+// config is locked meanwhile, so concurrent changes are not lost.
+func (s *Server) modifyNotifiers(ctx context.Context, fn func([]interface{}) ([]interface{}, error)) error {
+	return s.config.Modify(ctx, config.NotificationSection, config.InstancesKey, func(value interface{}) (interface{}, error) {
+		instances, _ := value.([]interface{})
+		return fn(instances)
+	})
+}
+
+// notifierInstances returns the decrypted notifier list of the
+// notification-service section. It is a copy and can be modified.
+func (s *Server) notifierInstances() []interface{} {
+	section, err := s.config.GetSection(config.NotificationSection)
+	if err != nil {
+		return nil
+	}
+	instances, _ := section[config.InstancesKey].([]interface{})
+	return instances
+}
+
+// findNotifier returns the index and the instance named name, the index is
+// -1 if there is none.
+func findNotifier(instances []interface{}, name string) (int, map[interface{}]interface{}) {
+	for i, item := range instances {
+		instance, ok := item.(map[interface{}]interface{})
+		if ok && instance["name"] == name {
+			return i, instance
+		}
+	}
+	return -1, nil
+}
+
+// notifierSettings fills the form of an instance from its settings.
+func notifierSettings(instance map[interface{}]interface{}) web.NotifierSettings {
+	name, _ := instance["name"].(string)
+	typ, _ := instance["type"].(string)
+	settings, _ := instance["settings"].(map[interface{}]interface{})
+
+	notifier := web.NotifierSettings{Name: name, Type: typ, Events: formValue(instance["events"])}
+	for _, field := range notifierFields[typ] {
+		value := formValue(settings[field.Key])
+		if config.IsSecret(field.Key) {
+			field.HasValue = value != ""
+			value = ""
+		}
+		field.Value = value
+		notifier.Fields = append(notifier.Fields, field)
+	}
+	return notifier
+}
+
+// formValue renders a setting as form value, lists comma-separated.
+func formValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// configList converts items to the list type of the yaml config.
+func configList(items []string) []interface{} {
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		list[i] = item
+	}
+	return list
 }
 
 func (s *Server) blacklistAdd(w http.ResponseWriter, r *http.Request) {
@@ -336,12 +844,15 @@ func (s *Server) blacklistAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	_, err = s.blacklist.Create(ctx, &model.BlacklistPlayers{
-		Name: r.FormValue("blacklistPlayer"),
+		Name:    r.FormValue("blacklistPlayer"),
+		List:    r.FormValue("list"),
+		Aliases: splitList(r.FormValue("aliases")),
 	})
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		s.logger.ErrorContext(ctx, "failed to add player to blacklist", "error", err)
+		s.renderError(ctx, w, err)
 		return
 	}
 
@@ -356,6 +867,106 @@ func (s *Server) blacklistAdd(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) blacklistPerson(w http.ResponseWriter, r *http.Request) {
+	s.renderBlacklistEntry(w, r, "blacklistPerson", func(player *model.BlacklistPlayers) templ.Component {
+		return web.BlacklistPerson(player)
+	})
+}
+
+func (s *Server) blacklistRow(w http.ResponseWriter, r *http.Request) {
+	s.renderBlacklistEntry(w, r, "blacklistRow", func(player *model.BlacklistPlayers) templ.Component {
+		return web.BlacklistTableRow(player)
+	})
+}
+
+func (s *Server) blacklistEdit(w http.ResponseWriter, r *http.Request) {
+	s.renderBlacklistEntry(w, r, "blacklistEdit", func(player *model.BlacklistPlayers) templ.Component {
+		return web.BlacklistEditRow(player)
+	})
+}
+
+func (s *Server) renderBlacklistEntry(
+	w http.ResponseWriter,
+	r *http.Request,
+	spanName string,
+	component func(*model.BlacklistPlayers) templ.Component,
+) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, spanName)
+
+	id, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to parse uuid", "error", err)
+		s.renderError(ctx, w, fmt.Errorf("%w: %w", errInvalidID, err))
+		return
+	}
+
+	player, err := s.blacklist.GetByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to get blacklist entry", "error", err)
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	err = web.Render(ctx, w, component(player))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+		return
+	}
+}
+
+func (s *Server) blacklistUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "blacklistUpdate")
+
+	id, err := uuid.Parse(r.PathValue("ID"))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to parse uuid", "error", err)
+		s.renderError(ctx, w, fmt.Errorf("%w: %w", errInvalidID, err))
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to parse form", "error", err)
+		return
+	}
+
+	updated, err := s.blacklist.Edit(ctx, &model.BlacklistPlayers{
+		ID:       id,
+		Name:     r.FormValue("name"),
+		List:     r.FormValue("list"),
+		Server:   r.FormValue("server"),
+		Aliases:  splitList(r.FormValue("aliases")),
+		SteamIDs: splitList(r.FormValue("steamids")),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to update blacklist entry", "error", err)
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	err = web.Render(ctx, w, web.BlacklistTableRow(updated))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+		return
+	}
+}
+
 func (s *Server) blacklistDelete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	ctx, span := tracer.Start(ctx, "blacklistDelete")
@@ -365,6 +976,7 @@ func (s *Server) blacklistDelete(w http.ResponseWriter, r *http.Request) {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		s.logger.ErrorContext(ctx, "failed to parse uuid", "error", err)
+		s.renderError(ctx, w, fmt.Errorf("%w: %w", errInvalidID, err))
 		return
 	}
 	err = s.blacklist.Delete(ctx, id)
@@ -372,6 +984,83 @@ func (s *Server) blacklistDelete(w http.ResponseWriter, r *http.Request) {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		s.logger.ErrorContext(ctx, "failed to delete from blacklist", "error", err)
+		s.renderError(ctx, w, err)
 		return
 	}
 }
+
+func (s *Server) blacklistTrack(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "blacklistTrack")
+	defer span.End()
+
+	err := r.ParseForm()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to parse form", "error", err)
+		return
+	}
+
+	_, err = s.blacklist.Create(ctx, &model.BlacklistPlayers{
+		Name:   r.FormValue("name"),
+		List:   r.FormValue("list"),
+		Server: r.FormValue("server"),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to track player", "error", err)
+		s.renderError(ctx, w, err)
+		return
+	}
+
+	// the player table is only streamed again when the players change, so
+	// the button is swapped for the tracked flag right away
+	err = web.Render(ctx, w, web.TrackedFlag())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+		return
+	}
+}
+
+// splitList splits a comma-separated form value and drops empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var errInvalidID = errors.New("invalid id")
+
+// renderError maps err to an HTTP status code and renders it as an htmx
+// error fragment into the page-wide error container.
+func (s *Server) renderError(ctx context.Context, w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errInvalidID), errors.Is(err, blacklist.ErrEmptyName),
+		errors.Is(err, journal.ErrInvalidQuery), errors.Is(err, config.ErrInvalidInstance):
+		status = http.StatusBadRequest
+	case errors.Is(err, blacklist.ErrNotFound), errors.Is(err, events.ErrUnknownSubscriber),
+		errors.Is(err, errUnknownNotifier):
+		status = http.StatusNotFound
+	case errors.Is(err, blacklist.ErrDuplicate), errors.Is(err, errDuplicateNotifier):
+		status = http.StatusConflict
+	}
+
+	w.Header().Set("HX-Retarget", "#errors")
+	w.Header().Set("HX-Reswap", "innerHTML")
+	w.WriteHeader(status)
+
+	err = web.Render(ctx, w, web.ErrorMessage(err.Error()))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to render templ", "error", err)
+	}
+}
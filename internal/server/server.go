@@ -6,8 +6,11 @@ import (
 	"net/http"
 
 	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/history"
+	"github.com/led0nk/ark-overseer/internal/journal"
 	"github.com/led0nk/ark-overseer/internal/storage"
 	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	sloghttp "github.com/samber/slog-http"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -19,24 +22,36 @@ type Server struct {
 	domain    string
 	logger    *slog.Logger
 	sStore    storage.Database
+	watcher   storage.Watcher
 	blacklist blacklist.Blacklister
+	history   history.Recorder
+	journal   journal.Journal
 	config    config.Configuration
+	status    events.HealthReporter
 }
 
 func NewServer(
 	address string,
 	domain string,
 	sStore storage.Database,
+	watcher storage.Watcher,
 	blacklist blacklist.Blacklister,
+	history history.Recorder,
+	journal journal.Journal,
 	config config.Configuration,
+	status events.HealthReporter,
 ) *Server {
 	return &Server{
 		addr:      address,
 		domain:    domain,
 		logger:    slog.Default().WithGroup("http"),
 		sStore:    sStore,
+		watcher:   watcher,
 		blacklist: blacklist,
+		history:   history,
+		journal:   journal,
 		config:    config,
+		status:    status,
 	}
 }
 
@@ -55,6 +70,7 @@ func (s *Server) ServeHTTP(ctx context.Context) {
 	)
 
 	r.Handle("GET /metrics", promhttp.Handler())
+	r.Handle("GET /status", http.HandlerFunc(s.statusPage))
 	r.Handle("GET /", http.HandlerFunc(s.mainPage))
 	r.Handle("POST /", http.HandlerFunc(s.showServerInput))
 	r.Handle("PUT /", http.HandlerFunc(s.addServer))
@@ -62,10 +78,21 @@ func (s *Server) ServeHTTP(ctx context.Context) {
 	r.Handle("DELETE /{ID}", http.HandlerFunc(s.deleteServer))
 	r.Handle("GET /serverdata/{ID}", http.HandlerFunc(s.sseServerUpdate))
 	r.Handle("GET /serverdata/{ID}/players", http.HandlerFunc(s.ssePlayerInfo))
+	r.Handle("GET /history/{ID}", http.HandlerFunc(s.serverHistory))
+	r.Handle("GET /journal", http.HandlerFunc(s.journalPage))
+	r.Handle("GET /journal/entries", http.HandlerFunc(s.journalEntries))
+	r.Handle("POST /journal/replay", http.HandlerFunc(s.journalReplay))
 	r.Handle("GET /settings", http.HandlerFunc(s.setupPage))
-	r.Handle("POST /settings", http.HandlerFunc(s.saveChanges))
+	r.Handle("POST /settings/notifiers", http.HandlerFunc(s.addNotifier))
+	r.Handle("POST /settings/notifiers/{name}", http.HandlerFunc(s.saveNotifier))
+	r.Handle("DELETE /settings/notifiers/{name}", http.HandlerFunc(s.deleteNotifier))
 	r.Handle("GET /blacklist", http.HandlerFunc(s.blacklistPage))
 	r.Handle("POST /blacklist", http.HandlerFunc(s.blacklistAdd))
+	r.Handle("POST /blacklist/track", http.HandlerFunc(s.blacklistTrack))
+	r.Handle("GET /blacklist/{ID}", http.HandlerFunc(s.blacklistPerson))
+	r.Handle("GET /blacklist/{ID}/row", http.HandlerFunc(s.blacklistRow))
+	r.Handle("GET /blacklist/{ID}/edit", http.HandlerFunc(s.blacklistEdit))
+	r.Handle("PUT /blacklist/{ID}", http.HandlerFunc(s.blacklistUpdate))
 	r.Handle("DELETE /blacklist/{ID}", http.HandlerFunc(s.blacklistDelete))
 
 	s.logger.Info("listen and serve", "addr", s.addr)
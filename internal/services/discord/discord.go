@@ -2,8 +2,9 @@ package discord
 
 import (
 	"context"
-	"errors"
 	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/led0nk/ark-overseer/pkg/events"
@@ -30,31 +31,123 @@ func NewDiscordNotifier(ctx context.Context, token string, channelID string) (*D
 	return discord, nil
 }
 
+// Colors of the embeds by event type.
+const (
+	colorJoined  = 0xda3633
+	colorLeft    = 0x8b949e
+	colorOnline  = 0x238636
+	colorOffline = 0xd29922
+)
+
+// Topics limits the notifier to player events. Server status changes are
+// formatted as well, if an instance subscribes to them.
+func (dn *DiscordNotifier) Topics() []string {
+	return []string{"player.*"}
+}
+
 func (dn *DiscordNotifier) HandleEvent(ctx context.Context, event events.EventMessage) {
-	switch event.Type {
-	case "player.joined":
-		msg, ok := event.Payload.(string)
-		if !ok {
-			dn.logger.ErrorContext(ctx, "invalid payload type for playerJoined event", "error", errors.New("payload not of type string"))
-			return
+	msg := embed(event.Payload, time.Now())
+	if msg == nil {
+		return
+	}
+
+	_, err := dn.session.ChannelMessageSendEmbed(dn.channelID, msg, discordgo.WithContext(ctx))
+	if err != nil {
+		dn.logger.ErrorContext(ctx, "failed to send message", "error", err)
+	}
+}
+
+// embed formats event as a Discord embed, it is nil for events that are not
+// reported. Events without a time of their own are stamped with now.
+func embed(event events.Event, now time.Time) *discordgo.MessageEmbed {
+	switch e := event.(type) {
+	case events.PlayerJoined:
+		return playerEmbed(e, "Tracked player joined", " joined the server ", colorJoined, now)
+	case events.PlayerLeft:
+		// both player events carry the same fields
+		return playerEmbed(events.PlayerJoined(e), "Tracked player left", " left the server ", colorLeft, now)
+	case events.ServerStatusChanged:
+		if e.Server == nil {
+			return nil
+		}
+		msg := &discordgo.MessageEmbed{
+			Title:       "Server offline",
+			Description: e.Server.Name + " is offline",
+			Color:       colorOffline,
+			Timestamp:   timestamp(e.Server.Updated, now),
+			Footer:      &discordgo.MessageEmbedFooter{Text: "Ark-Overseer"},
 		}
-		err := dn.Send(ctx, msg)
-		if err != nil {
-			dn.logger.ErrorContext(ctx, "failed to send message", "error", err)
+		if e.Online {
+			msg.Title, msg.Description, msg.Color = "Server online", e.Server.Name+" is online", colorOnline
 		}
-	case "player.left":
-		msg, ok := event.Payload.(string)
-		if !ok {
-			dn.logger.ErrorContext(ctx, "invalid payload type for playerLeft event", "error", errors.New("payload not of type string"))
-			return
+
+		var mapName string
+		if e.Server.ServerInfo != nil {
+			mapName = e.Server.ServerInfo.Map
 		}
-		err := dn.Send(ctx, msg)
-		if err != nil {
-			dn.logger.ErrorContext(ctx, "failed to send message", "error", err)
+		players, maxPlayers := e.Server.PlayerCount()
+		msg.Fields = serverFields(e.Server.Name, e.Server.Addr, mapName, players, maxPlayers)
+		if e.Online {
+			msg.Fields = appendConnect(msg.Fields, e.Server.ConnectAddr())
 		}
-	default:
-		return
+		return msg
+	}
+	return nil
+}
+
+func playerEmbed(e events.PlayerJoined, title string, action string, color int, now time.Time) *discordgo.MessageEmbed {
+	msg := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: e.Entry.Describe(e.Name) + action + e.ServerName,
+		Color:       color,
+		Timestamp:   timestamp(e.Time, now),
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Ark-Overseer"},
+		Fields:      serverFields(e.ServerName, e.ServerAddr, e.Map, e.Players, e.MaxPlayers),
+	}
+	if e.Entry != nil {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Tracked as", Value: e.Entry.Name, Inline: true})
+		if e.Entry.List != "" {
+			msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Watchlist", Value: e.Entry.List, Inline: true})
+		}
+	}
+	msg.Fields = appendConnect(msg.Fields, e.ConnectAddr)
+	return msg
+}
+
+// serverFields describes the server, leaving out what the scrape did not
+// report. Discord rejects empty field values.
+func serverFields(name string, addr string, mapName string, players int, maxPlayers int) []*discordgo.MessageEmbedField {
+	fields := []*discordgo.MessageEmbedField{{Name: "Server", Value: name, Inline: true}}
+	if addr != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Address", Value: addr, Inline: true})
+	}
+	if mapName != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Map", Value: mapName, Inline: true})
+	}
+	if players > 0 || maxPlayers > 0 {
+		count := strconv.Itoa(players)
+		if maxPlayers > 0 {
+			count += "/" + strconv.Itoa(maxPlayers)
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Players", Value: count, Inline: true})
+	}
+	return fields
+}
+
+// appendConnect adds the steam://connect link of addr. Discord only links
+// http URLs, so it is shown as text to be opened from the browser.
+func appendConnect(fields []*discordgo.MessageEmbedField, addr string) []*discordgo.MessageEmbedField {
+	if addr == "" {
+		return fields
+	}
+	return append(fields, &discordgo.MessageEmbedField{Name: "Connect", Value: "steam://connect/" + addr})
+}
+
+func timestamp(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		t = now
 	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 func (dn *DiscordNotifier) Connect(ctx context.Context) error {
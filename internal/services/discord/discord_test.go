@@ -1,5 +1,66 @@
 package discord
 
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 20, 15, 0, 0, time.UTC)
+	joined := events.PlayerJoined{
+		ServerName:  "The Island",
+		ServerAddr:  "192.0.2.1:27015",
+		ConnectAddr: "192.0.2.1:7777",
+		Map:         "TheIsland",
+		Players:     12,
+		MaxPlayers:  70,
+		Name:        "bob_1",
+		Entry:       &model.BlacklistPlayers{Name: "Bob", List: "raiders"},
+		Time:        time.Date(2024, 6, 1, 22, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	}
+	assert.Equal(t, &discordgo.MessageEmbed{
+		Title:       "Tracked player joined",
+		Description: "Bob (as bob_1) joined the server The Island",
+		Color:       colorJoined,
+		Timestamp:   "2024-06-01T20:00:00Z",
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Ark-Overseer"},
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Server", Value: "The Island", Inline: true},
+			{Name: "Address", Value: "192.0.2.1:27015", Inline: true},
+			{Name: "Map", Value: "TheIsland", Inline: true},
+			{Name: "Players", Value: "12/70", Inline: true},
+			{Name: "Tracked as", Value: "Bob", Inline: true},
+			{Name: "Watchlist", Value: "raiders", Inline: true},
+			{Name: "Connect", Value: "steam://connect/192.0.2.1:7777"},
+		},
+	}, embed(joined, now))
+
+	left := embed(events.PlayerLeft{ServerName: "Ragnarok", Name: "Alice"}, now)
+	assert.Equal(t, "Alice left the server Ragnarok", left.Description)
+	assert.Equal(t, colorLeft, left.Color)
+	assert.Equal(t, "2024-06-01T20:15:00Z", left.Timestamp, "events without time are stamped with now")
+	assert.Equal(t, []*discordgo.MessageEmbedField{{Name: "Server", Value: "Ragnarok", Inline: true}}, left.Fields,
+		"unknown values are left out")
+
+	server := &model.Server{Name: "Ragnarok", Addr: "192.0.2.2:27015"}
+	server.ServerInfo = &model.ServerInfo{Map: "Ragnarok", Players: 3, MaxPlayers: 50, Port: 7779}
+	online := embed(events.ServerStatusChanged{Server: server, Online: true}, now)
+	assert.Equal(t, "Server online", online.Title)
+	assert.Equal(t, colorOnline, online.Color)
+	assert.Equal(t, &discordgo.MessageEmbedField{Name: "Connect", Value: "steam://connect/192.0.2.2:7779"}, online.Fields[len(online.Fields)-1])
+
+	offline := embed(events.ServerStatusChanged{Server: &model.Server{Name: "Ragnarok", Addr: "192.0.2.2:27015"}}, now)
+	assert.Equal(t, colorOffline, offline.Color)
+	assert.Len(t, offline.Fields, 2, "offline servers have no connect link")
+
+	assert.Nil(t, embed(events.ServerAdded{Server: server}, now))
+}
+
 //TODO: setup mock server for discord
 
 //func TestDiscordMessages(t *testing.T) {
@@ -0,0 +1,335 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+	sendTimeout = 30 * time.Second
+
+	defaultSubject = `{{if .Message}}Ark-Overseer{{else}}{{.Player}} {{.Action}} {{.ServerName}}{{end}}`
+	defaultText    = `{{if .Message}}{{.Message}}{{else}}{{.Player}} {{.Action}} the server {{.ServerName}} at {{.Time.Format "2006-01-02 15:04:05 MST"}}.{{end}}
+`
+	defaultHTML = `<!DOCTYPE html>
+<html><body>
+{{if .Message}}<p>{{.Message}}</p>{{else}}<p><b>{{.Player}}</b> {{.Action}} the server <b>{{.ServerName}}</b> at {{.Time.Format "2006-01-02 15:04:05 MST"}}.</p>{{end}}
+</body></html>
+`
+)
+
+var (
+	ErrTemplate     = errors.New("invalid mail template")
+	ErrNoSTARTTLS   = errors.New("mail server does not support STARTTLS")
+	ErrNoRecipients = errors.New("no mail recipient accepted")
+)
+
+// Data is passed to the subject, text and HTML templates. Player names the
+// tracked person and the alias they are using, Action is "joined" or
+// "left". Mails sent with Send only have Type "message", Message and Time.
+type Data struct {
+	Type       string
+	Action     string
+	Player     string
+	Name       string
+	ServerID   uuid.UUID
+	ServerName string
+	Message    string
+	Time       time.Time
+}
+
+// EmailNotifier mails player events to a list of recipients. Every mail
+// has a plain text and an HTML part, a new connection to the mail server
+// is opened for each of them.
+type EmailNotifier struct {
+	logger    *slog.Logger
+	cfg       config.SMTP
+	subject   *template.Template
+	text      *template.Template
+	html      *htmltemplate.Template
+	tlsConfig *tls.Config
+	now       func() time.Time
+}
+
+func NewEmailNotifier(ctx context.Context, cfg config.SMTP) (*EmailNotifier, error) {
+	email, err := newEmailNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = email.Connect(ctx)
+	if err != nil {
+		email.logger.ErrorContext(ctx, "failed to connect email notification service", "error", err)
+		return nil, err
+	}
+	return email, nil
+}
+
+func newEmailNotifier(cfg config.SMTP) (*EmailNotifier, error) {
+	email := &EmailNotifier{
+		logger:    slog.Default().WithGroup("email"),
+		cfg:       cfg,
+		tlsConfig: &tls.Config{},
+		now:       time.Now,
+	}
+
+	var err error
+	email.subject, err = template.New("subject").Parse(orDefault(cfg.Subject, defaultSubject))
+	if err != nil {
+		return nil, fmt.Errorf("%w: subject: %w", ErrTemplate, err)
+	}
+	email.text, err = template.New("text").Parse(orDefault(cfg.Text, defaultText))
+	if err != nil {
+		return nil, fmt.Errorf("%w: textTemplate: %w", ErrTemplate, err)
+	}
+	email.html, err = htmltemplate.New("html").Parse(orDefault(cfg.HTML, defaultHTML))
+	if err != nil {
+		return nil, fmt.Errorf("%w: htmlTemplate: %w", ErrTemplate, err)
+	}
+	return email, nil
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// Topics limits the notifier to player events.
+func (en *EmailNotifier) Topics() []string {
+	return []string{"player.*"}
+}
+
+func (en *EmailNotifier) HandleEvent(ctx context.Context, event events.EventMessage) {
+	data := Data{Type: event.Type, Time: en.now()}
+	switch e := event.Payload.(type) {
+	case events.PlayerJoined:
+		data.Action = "joined"
+		data.Player = e.Entry.Describe(e.Name)
+		data.Name, data.ServerID, data.ServerName = e.Name, e.ServerID, e.ServerName
+	case events.PlayerLeft:
+		data.Action = "left"
+		data.Player = e.Entry.Describe(e.Name)
+		data.Name, data.ServerID, data.ServerName = e.Name, e.ServerID, e.ServerName
+	default:
+		return
+	}
+
+	err := en.send(ctx, data)
+	if err != nil {
+		en.logger.ErrorContext(ctx, "failed to send mail", "error", err)
+	}
+}
+
+// Connect verifies the connection to and the credentials for the mail
+// server.
+func (en *EmailNotifier) Connect(ctx context.Context) error {
+	client, err := en.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Quit()
+}
+
+func (en *EmailNotifier) Send(ctx context.Context, message string) error {
+	return en.send(ctx, Data{Type: "message", Message: message, Time: en.now()})
+}
+
+func (en *EmailNotifier) Disconnect() error {
+	return nil
+}
+
+func (en *EmailNotifier) send(ctx context.Context, data Data) error {
+	msg, err := en.message(data)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(en.cfg.From)
+	if err != nil {
+		return err
+	}
+
+	client, err := en.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = client.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	var accepted int
+	for _, to := range en.cfg.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err == nil {
+			err = client.Rcpt(rcpt.Address)
+		}
+		if err != nil {
+			en.logger.WarnContext(ctx, "recipient rejected", "error", err, "to", to)
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		return ErrNoRecipients
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects and authenticates to the mail server, honoring the
+// deadline of ctx.
+func (en *EmailNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(en.cfg.Host, strconv.Itoa(en.cfg.Port)))
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sendTimeout)
+	}
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConfig := en.tlsConfig.Clone()
+	tlsConfig.ServerName = en.cfg.Host
+	if en.cfg.Security == config.SecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, en.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if en.cfg.Security == config.SecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, ErrNoSTARTTLS
+		}
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	if en.cfg.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", en.cfg.Username, en.cfg.Password, en.cfg.Host))
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// message renders data into a multipart/alternative mail with a plain text
+// and an HTML part.
+func (en *EmailNotifier) message(data Data) ([]byte, error) {
+	var subject strings.Builder
+	err := en.subject.Execute(&subject, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: subject: %w", ErrTemplate, err)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	err = writePart(parts, "text/plain; charset=utf-8", func(w io.Writer) error {
+		return en.text.Execute(w, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: textTemplate: %w", ErrTemplate, err)
+	}
+	err = writePart(parts, "text/html; charset=utf-8", func(w io.Writer) error {
+		return en.html.Execute(w, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: htmlTemplate: %w", ErrTemplate, err)
+	}
+	err = parts.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if from, err := mail.ParseAddress(en.cfg.From); err == nil {
+		if _, host, ok := strings.Cut(from.Address, "@"); ok {
+			domain = host
+		}
+	}
+
+	var msg bytes.Buffer
+	header := []struct{ name, value string }{
+		{"From", en.cfg.From},
+		{"To", strings.Join(en.cfg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String()))},
+		{"Date", data.Time.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + uuid.NewString() + "@" + domain + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	for _, h := range header {
+		msg.WriteString(h.name + ": " + h.value + "\r\n")
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func writePart(parts *multipart.Writer, contentType string, render func(io.Writer) error) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	err = render(qp)
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,320 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type envelope struct {
+	from string
+	to   []string
+	data string
+}
+
+// sink is a minimal SMTP server recording the received mails. With a TLS
+// config it offers STARTTLS or, if created with implicit set, only accepts
+// TLS connections.
+type sink struct {
+	listener net.Listener
+	tls      *tls.Config
+	username string
+	password string
+
+	mu    sync.Mutex
+	mails []envelope
+}
+
+func newSink(t *testing.T, tlsConfig *tls.Config, implicit bool) *sink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	if implicit {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	s := &sink{listener: listener, tls: tlsConfig, username: "ark", password: "s3cret"}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *sink) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *sink) serve(conn net.Conn) {
+	defer conn.Close()
+	_, secure := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 sink ready")
+
+	var mail envelope
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			lines := []string{"250-sink", "250-AUTH PLAIN"}
+			if s.tls != nil && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			lines = append(lines, "250 8BITMIME")
+			for _, l := range lines {
+				_ = text.PrintfLine("%s", l)
+			}
+		case "STARTTLS":
+			_ = text.PrintfLine("220 go ahead")
+			tlsConn := tls.Server(conn, s.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if string(credentials) != "\x00"+s.username+"\x00"+s.password {
+				_ = text.PrintfLine("535 authentication failed")
+				continue
+			}
+			_ = text.PrintfLine("235 authenticated")
+		case "MAIL":
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			mail = envelope{from: strings.Trim(from, "<>")}
+			_ = text.PrintfLine("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if strings.HasSuffix(to, "@invalid.example") {
+				_ = text.PrintfLine("550 no such user")
+				continue
+			}
+			mail.to = append(mail.to, to)
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			_ = text.PrintfLine("250 queued")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *sink) received() []envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]envelope(nil), s.mails...)
+}
+
+// certificate returns a server config with a self-signed certificate for
+// 127.0.0.1 and a client config trusting it.
+func certificate(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sink"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+func newNotifier(t *testing.T, cfg config.SMTP, client *tls.Config) *EmailNotifier {
+	en, err := newEmailNotifier(cfg)
+	assert.NoError(t, err)
+	if client != nil {
+		en.tlsConfig = client
+	}
+	en.now = func() time.Time { return time.Date(2024, 6, 1, 20, 15, 0, 0, time.UTC) }
+	return en
+}
+
+// parts returns the subject and the bodies of the parts of a received mail
+// by content type.
+func parts(t *testing.T, data string) (string, map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	assert.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	bodies := make(map[string]string)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		// NextPart decodes quoted-printable
+		body, err := io.ReadAll(part)
+		assert.NoError(t, err)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+	return subject, bodies
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server, client := certificate(t)
+
+	tests := []struct {
+		name     string
+		security string
+		implicit bool
+	}{
+		{name: "starttls", security: config.SecuritySTARTTLS},
+		{name: "tls", security: config.SecurityTLS, implicit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newSink(t, server, tt.implicit)
+			en := newNotifier(t, config.SMTP{
+				Host:     "127.0.0.1",
+				Port:     s.port(),
+				Security: tt.security,
+				Username: "ark",
+				Password: "s3cret",
+				From:     "Ark-Overseer <ark@example.com>",
+				To:       []string{"admin@example.com", "Staff <staff@example.com>"},
+			}, client)
+			assert.NoError(t, en.Connect(ctx))
+
+			event := events.PlayerJoined{
+				ServerName: "The Island",
+				Name:       "bob_1",
+				Entry:      &model.BlacklistPlayers{Name: "Bob"},
+			}
+			en.HandleEvent(ctx, events.EventMessage{Type: event.Topic(), Payload: event})
+
+			mails := s.received()
+			assert.Len(t, mails, 1)
+			assert.Equal(t, "ark@example.com", mails[0].from)
+			assert.Equal(t, []string{"admin@example.com", "staff@example.com"}, mails[0].to)
+
+			subject, bodies := parts(t, mails[0].data)
+			assert.Equal(t, "Bob (as bob_1) joined The Island", subject)
+			assert.Equal(t, "Bob (as bob_1) joined the server The Island at 2024-06-01 20:15:00 UTC.\n", bodies["text/plain"])
+			assert.Contains(t, bodies["text/html"], "<b>Bob (as bob_1)</b> joined the server <b>The Island</b>")
+		})
+	}
+}
+
+func TestEmailNotifierTemplates(t *testing.T) {
+	ctx := context.Background()
+	s := newSink(t, nil, false)
+	en := newNotifier(t, config.SMTP{
+		Host:     "127.0.0.1",
+		Port:     s.port(),
+		Security: config.SecurityNone,
+		From:     "ark@example.com",
+		To:       []string{"admin@example.com", "nobody@invalid.example"},
+		Subject:  "[ark] {{.Name}} {{.Action}}",
+		Text:     "{{.Player}} is on {{.ServerName}}",
+		HTML:     "<i>{{.ServerName}}</i>",
+	}, nil)
+
+	event := events.PlayerLeft{ServerName: "<Ragnarök>", Name: "Alice"}
+	en.HandleEvent(ctx, events.EventMessage{Type: event.Topic(), Payload: event})
+	assert.NoError(t, en.Send(ctx, "weekly report"))
+
+	mails := s.received()
+	assert.Len(t, mails, 2)
+	assert.Equal(t, []string{"admin@example.com"}, mails[0].to, "rejected recipients are skipped")
+
+	subject, bodies := parts(t, mails[0].data)
+	assert.Equal(t, "[ark] Alice left", subject)
+	assert.Equal(t, "Alice is on <Ragnarök>", bodies["text/plain"])
+	assert.Equal(t, "<i>&lt;Ragnarök&gt;</i>", bodies["text/html"])
+
+	subject, _ = parts(t, mails[1].data)
+	assert.Equal(t, "[ark]", subject, "custom subject applies to messages as well")
+}
+
+func TestEmailNotifierErrors(t *testing.T) {
+	ctx := context.Background()
+	_, err := newEmailNotifier(config.SMTP{Text: "{{.Player"})
+	assert.ErrorIs(t, err, ErrTemplate)
+
+	s := newSink(t, nil, false)
+	cfg := config.SMTP{
+		Host:     "127.0.0.1",
+		Port:     s.port(),
+		Security: config.SecuritySTARTTLS,
+		From:     "ark@example.com",
+		To:       []string{"admin@example.com"},
+	}
+	_, err = NewEmailNotifier(ctx, cfg)
+	assert.ErrorIs(t, err, ErrNoSTARTTLS)
+
+	cfg.Security = config.SecurityNone
+	cfg.Username, cfg.Password = "ark", "wrong"
+	_, err = NewEmailNotifier(ctx, cfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "535")
+
+	cfg.Username, cfg.Password = "", ""
+	cfg.To = []string{"nobody@invalid.example"}
+	en, err := NewEmailNotifier(ctx, cfg)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, en.Send(ctx, "hello"), ErrNoRecipients)
+	assert.Empty(t, s.received())
+}
@@ -0,0 +1,143 @@
+package gotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const requestTimeout = 10 * time.Second
+
+var ErrAPI = errors.New("gotify error")
+
+// apiError is the body of failed Gotify requests.
+type apiError struct {
+	Error       string `json:"error"`
+	Description string `json:"errorDescription"`
+}
+
+type message struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// GotifyNotifier pushes player events to a Gotify server. Tracked players
+// joining are pushed with the urgent priority.
+type GotifyNotifier struct {
+	logger *slog.Logger
+	client *http.Client
+	cfg    config.Gotify
+}
+
+func NewGotifyNotifier(ctx context.Context, cfg config.Gotify) (*GotifyNotifier, error) {
+	gotify := &GotifyNotifier{
+		logger: slog.Default().WithGroup("gotify"),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		cfg: cfg,
+	}
+	err := gotify.Connect(ctx)
+	if err != nil {
+		gotify.logger.ErrorContext(ctx, "failed to connect gotify notification service", "error", err)
+		return nil, err
+	}
+	return gotify, nil
+}
+
+// Topics limits the notifier to player events.
+func (gn *GotifyNotifier) Topics() []string {
+	return []string{"player.*"}
+}
+
+func (gn *GotifyNotifier) HandleEvent(ctx context.Context, event events.EventMessage) {
+	var msg message
+	switch e := event.Payload.(type) {
+	case events.PlayerJoined:
+		msg = message{
+			Title:    "Tracked player joined",
+			Message:  e.Entry.Describe(e.Name) + " joined the server " + e.ServerName,
+			Priority: gn.cfg.UrgentPriority,
+		}
+	case events.PlayerLeft:
+		msg = message{
+			Title:    "Tracked player left",
+			Message:  e.Entry.Describe(e.Name) + " left the server " + e.ServerName,
+			Priority: gn.cfg.Priority,
+		}
+	default:
+		return
+	}
+
+	err := gn.push(ctx, msg)
+	if err != nil {
+		gn.logger.ErrorContext(ctx, "failed to push message", "error", err)
+	}
+}
+
+// Connect checks that the server is reachable. Application tokens can only
+// create messages, so they are not verified before the first push.
+func (gn *GotifyNotifier) Connect(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gn.url("/health"), nil)
+	if err != nil {
+		return err
+	}
+	return gn.do(req)
+}
+
+func (gn *GotifyNotifier) Send(ctx context.Context, text string) error {
+	return gn.push(ctx, message{Title: "Ark-Overseer", Message: text, Priority: gn.cfg.Priority})
+}
+
+func (gn *GotifyNotifier) push(ctx context.Context, msg message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gn.url("/message"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", gn.cfg.Token)
+	return gn.do(req)
+}
+
+func (gn *GotifyNotifier) url(path string) string {
+	return strings.TrimSuffix(gn.cfg.URL, "/") + path
+}
+
+func (gn *GotifyNotifier) do(req *http.Request) error {
+	resp, err := gn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var apiErr apiError
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	if err != nil || apiErr.Description == "" {
+		return fmt.Errorf("%w: %s", ErrAPI, resp.Status)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrAPI, resp.Status, apiErr.Description)
+}
+
+func (gn *GotifyNotifier) Disconnect() error {
+	gn.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,86 @@
+package gotify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "AbCdE"
+
+// server is a fake Gotify server accepting messages for testToken.
+type server struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func newServer(t *testing.T) (*server, *httptest.Server) {
+	s := &server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"health":"green","database":"green"}`))
+	})
+	mux.HandleFunc("POST /message", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gotify-Key") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Unauthorized","errorCode":401,"errorDescription":"you need to provide a valid access token or user credentials to access this api"}`))
+			return
+		}
+		var msg message
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+		_, _ = w.Write([]byte(`{"id":1}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func TestGotifyNotifier(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newServer(t)
+
+	cfg := config.DefaultGotify()
+	cfg.URL = srv.URL + "/"
+	cfg.Token = testToken
+	gn, err := NewGotifyNotifier(ctx, cfg)
+	assert.NoError(t, err)
+	defer gn.Disconnect()
+
+	joined := events.PlayerJoined{ServerName: "The Island", Name: "bob_1", Entry: &model.BlacklistPlayers{Name: "Bob"}}
+	gn.HandleEvent(ctx, events.EventMessage{Type: joined.Topic(), Payload: joined})
+	left := events.PlayerLeft{ServerName: "The Island", Name: "Alice"}
+	gn.HandleEvent(ctx, events.EventMessage{Type: left.Topic(), Payload: left})
+	assert.NoError(t, gn.Send(ctx, "hello"))
+
+	s.mu.Lock()
+	assert.Equal(t, []message{
+		{Title: "Tracked player joined", Message: "Bob (as bob_1) joined the server The Island", Priority: 10},
+		{Title: "Tracked player left", Message: "Alice left the server The Island", Priority: 5},
+		{Title: "Ark-Overseer", Message: "hello", Priority: 5},
+	}, s.messages)
+	s.mu.Unlock()
+
+	gn.cfg.Token = "wrong"
+	err = gn.Send(ctx, "hello")
+	assert.ErrorIs(t, err, ErrAPI)
+	assert.Contains(t, err.Error(), "valid access token")
+}
+
+func TestGotifyNotifierUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	_, err := NewGotifyNotifier(context.Background(), config.Gotify{URL: srv.URL, Token: testToken})
+	assert.Error(t, err)
+}
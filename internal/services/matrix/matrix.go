@@ -0,0 +1,157 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const requestTimeout = 10 * time.Second
+
+var ErrAPI = errors.New("matrix api error")
+
+// apiError is the body of failed client-server API requests.
+type apiError struct {
+	Code    string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+// message is an m.room.message event with an HTML body, Body holds the
+// plain text for clients without HTML support.
+type message struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+// MatrixNotifier posts player events into a Matrix room.
+type MatrixNotifier struct {
+	logger *slog.Logger
+	client *http.Client
+	cfg    config.Matrix
+}
+
+func NewMatrixNotifier(ctx context.Context, cfg config.Matrix) (*MatrixNotifier, error) {
+	matrix := &MatrixNotifier{
+		logger: slog.Default().WithGroup("matrix"),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		cfg: cfg,
+	}
+	err := matrix.Connect(ctx)
+	if err != nil {
+		matrix.logger.ErrorContext(ctx, "failed to connect matrix notification service", "error", err)
+		return nil, err
+	}
+	return matrix, nil
+}
+
+// Topics limits the notifier to player events.
+func (mn *MatrixNotifier) Topics() []string {
+	return []string{"player.*"}
+}
+
+func (mn *MatrixNotifier) HandleEvent(ctx context.Context, event events.EventMessage) {
+	var text, formatted string
+	switch e := event.Payload.(type) {
+	case events.PlayerJoined:
+		text = e.Entry.Describe(e.Name) + " joined the server " + e.ServerName
+		formatted = formatPlayer(e.Entry.Identify(e.Name)) + " joined the server <b>" + html.EscapeString(e.ServerName) + "</b>"
+	case events.PlayerLeft:
+		text = e.Entry.Describe(e.Name) + " left the server " + e.ServerName
+		formatted = formatPlayer(e.Entry.Identify(e.Name)) + " left the server <b>" + html.EscapeString(e.ServerName) + "</b>"
+	default:
+		return
+	}
+
+	err := mn.send(ctx, message{
+		MsgType:       "m.text",
+		Body:          text,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: formatted,
+	})
+	if err != nil {
+		mn.logger.ErrorContext(ctx, "failed to send message", "error", err)
+	}
+}
+
+// formatPlayer puts the person returned by model.BlacklistPlayers.Identify
+// in bold, followed by the alias if there is one.
+func formatPlayer(person string, alias string) string {
+	if alias == "" {
+		return "<b>" + html.EscapeString(person) + "</b>"
+	}
+	return "<b>" + html.EscapeString(person) + "</b> (as " + html.EscapeString(alias) + ")"
+}
+
+// Connect verifies the access token by asking the homeserver who it
+// belongs to.
+func (mn *MatrixNotifier) Connect(ctx context.Context) error {
+	return mn.call(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil)
+}
+
+// Send posts message as plain text.
+func (mn *MatrixNotifier) Send(ctx context.Context, text string) error {
+	return mn.send(ctx, message{MsgType: "m.text", Body: text})
+}
+
+func (mn *MatrixNotifier) send(ctx context.Context, msg message) error {
+	// the transaction ID makes retries of the same request idempotent
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(mn.cfg.RoomID) +
+		"/send/m.room.message/" + uuid.NewString()
+	return mn.call(ctx, http.MethodPut, path, msg)
+}
+
+func (mn *MatrixNotifier) call(ctx context.Context, method string, path string, params any) error {
+	var body bytes.Buffer
+	if params != nil {
+		err := json.NewEncoder(&body).Encode(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(mn.cfg.Homeserver, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+mn.cfg.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := mn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var apiErr apiError
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	if err != nil || apiErr.Code == "" {
+		return fmt.Errorf("%w: %s", ErrAPI, resp.Status)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrAPI, apiErr.Code, apiErr.Message)
+}
+
+func (mn *MatrixNotifier) Disconnect() error {
+	mn.client.CloseIdleConnections()
+	return nil
+}
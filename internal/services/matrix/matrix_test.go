@@ -0,0 +1,122 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testToken = "syt_test"
+	testRoom  = "!room:example.org"
+)
+
+// homeserver is a fake homeserver that accepts testToken and records the
+// messages sent to testRoom.
+type homeserver struct {
+	mu       sync.Mutex
+	messages []message
+	txnIDs   []string
+}
+
+func newHomeserver(t *testing.T) (*homeserver, *httptest.Server) {
+	hs := &homeserver{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_matrix/client/v3/account/whoami", func(w http.ResponseWriter, r *http.Request) {
+		if !hs.authorized(w, r) {
+			return
+		}
+		_, _ = w.Write([]byte(`{"user_id":"@ark:example.org"}`))
+	})
+	mux.HandleFunc("PUT /_matrix/client/v3/rooms/{room}/send/m.room.message/{txn}", func(w http.ResponseWriter, r *http.Request) {
+		if !hs.authorized(w, r) {
+			return
+		}
+		if r.PathValue("room") != testRoom {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"User not in room"}`))
+			return
+		}
+		var msg message
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		hs.mu.Lock()
+		hs.messages = append(hs.messages, msg)
+		hs.txnIDs = append(hs.txnIDs, r.PathValue("txn"))
+		hs.mu.Unlock()
+		_, _ = w.Write([]byte(`{"event_id":"$event"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return hs, srv
+}
+
+func (hs *homeserver) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") == "Bearer "+testToken {
+		return true
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	_, _ = w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token passed."}`))
+	return false
+}
+
+func TestMatrixNotifier(t *testing.T) {
+	ctx := context.Background()
+	hs, srv := newHomeserver(t)
+
+	_, err := NewMatrixNotifier(ctx, config.Matrix{Homeserver: srv.URL, AccessToken: "wrong", RoomID: testRoom})
+	assert.ErrorIs(t, err, ErrAPI)
+	assert.Contains(t, err.Error(), "M_UNKNOWN_TOKEN")
+
+	mn, err := NewMatrixNotifier(ctx, config.Matrix{Homeserver: srv.URL + "/", AccessToken: testToken, RoomID: testRoom})
+	assert.NoError(t, err)
+	defer mn.Disconnect()
+
+	joined := events.PlayerJoined{
+		ServerName: "<Ragnarok>",
+		Name:       "bob_1",
+		Entry:      &model.BlacklistPlayers{Name: "Bob"},
+	}
+	mn.HandleEvent(ctx, events.EventMessage{Type: joined.Topic(), Payload: joined})
+	left := events.PlayerLeft{ServerName: "The Island", Name: "Alice"}
+	mn.HandleEvent(ctx, events.EventMessage{Type: left.Topic(), Payload: left})
+	assert.NoError(t, mn.Send(ctx, "hello"))
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	assert.Equal(t, []message{
+		{
+			MsgType:       "m.text",
+			Body:          "Bob (as bob_1) joined the server <Ragnarok>",
+			Format:        "org.matrix.custom.html",
+			FormattedBody: "<b>Bob</b> (as bob_1) joined the server <b>&lt;Ragnarok&gt;</b>",
+		},
+		{
+			MsgType:       "m.text",
+			Body:          "Alice left the server The Island",
+			Format:        "org.matrix.custom.html",
+			FormattedBody: "<b>Alice</b> left the server <b>The Island</b>",
+		},
+		{MsgType: "m.text", Body: "hello"},
+	}, hs.messages)
+	assert.NotEqual(t, hs.txnIDs[0], hs.txnIDs[1], "every message has its own transaction")
+}
+
+func TestMatrixNotifierForbidden(t *testing.T) {
+	ctx := context.Background()
+	_, srv := newHomeserver(t)
+
+	mn, err := NewMatrixNotifier(ctx, config.Matrix{Homeserver: srv.URL, AccessToken: testToken, RoomID: "!other:example.org"})
+	assert.NoError(t, err)
+
+	err = mn.Send(ctx, "hello")
+	assert.ErrorIs(t, err, ErrAPI)
+	assert.Contains(t, err.Error(), "M_FORBIDDEN")
+}
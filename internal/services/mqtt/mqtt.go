@@ -0,0 +1,187 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+)
+
+const connectTimeout = 5 * time.Second
+
+var ErrNotConnected = errors.New("mqtt publisher not connected")
+
+// Publisher mirrors events to an MQTT broker. Every event is published as
+// JSON to <prefix>/<server-id>/<topic>, with the dots of the topic turned
+// into levels, e.g. ark/<server-id>/player/joined. Events not about a single
+// server go to <prefix>/<topic>. Additionally <prefix>/<server-id>/status
+// holds the retained online/offline state of every server and
+// <prefix>/status the state of the publisher itself.
+type Publisher struct {
+	logger *slog.Logger
+	mu     sync.Mutex
+	cfg    config.MQTT
+	client paho.Client
+}
+
+// NewPublisher returns a publisher for cfg, Connect has to be called before
+// events are published.
+func NewPublisher(cfg config.MQTT) *Publisher {
+	return &Publisher{
+		logger: slog.Default().WithGroup("mqtt"),
+		cfg:    cfg,
+	}
+}
+
+// Topics limits the publisher to the events worth mirroring, internal init
+// events are left out.
+func (p *Publisher) Topics() []string {
+	return []string{"server.*", "player.*", events.ConfigChanged{}.Topic()}
+}
+
+// Connect connects to the broker if the publisher is enabled. A broker that
+// is not reachable within connectTimeout is retried in the background.
+func (p *Publisher) Connect(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.cfg.Enabled {
+		return nil
+	}
+
+	statusTopic := p.cfg.TopicPrefix + "/status"
+	opts := paho.NewClientOptions().
+		AddBroker(p.cfg.Broker).
+		SetClientID(p.cfg.ClientID).
+		SetUsername(p.cfg.Username).
+		SetPassword(p.cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(statusTopic, "offline", p.cfg.QoS, true).
+		SetOnConnectHandler(func(client paho.Client) {
+			client.Publish(statusTopic, p.cfg.QoS, true, "online")
+			p.logger.Info("connected to mqtt broker", "broker", p.cfg.Broker)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			p.logger.Warn("lost connection to mqtt broker", "broker", p.cfg.Broker, "error", err)
+		})
+
+	p.client = paho.NewClient(opts)
+	token := p.client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		p.logger.WarnContext(ctx, "mqtt broker not reachable yet, retrying in background", "broker", p.cfg.Broker)
+		return nil
+	}
+	return token.Error()
+}
+
+func (p *Publisher) Disconnect() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	if p.client.IsConnected() {
+		token := p.client.Publish(p.cfg.TopicPrefix+"/status", p.cfg.QoS, true, "offline")
+		token.WaitTimeout(connectTimeout)
+	}
+	p.client.Disconnect(250)
+	p.client = nil
+	return nil
+}
+
+func (p *Publisher) HandleEvent(ctx context.Context, event events.EventMessage) {
+	if changed, ok := event.Payload.(events.ConfigChanged); ok && changed.Section == config.MQTTSection {
+		p.reconfigure(ctx, changed.Values)
+		return
+	}
+
+	err := p.publish(event)
+	if err != nil && !errors.Is(err, ErrNotConnected) {
+		p.logger.ErrorContext(ctx, "failed to publish event", "error", err, "type", event.Type)
+	}
+}
+
+func (p *Publisher) publish(event events.EventMessage) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return ErrNotConnected
+	}
+
+	serverID := events.ServerOf(event.Payload)
+	err = p.send(p.topic(serverID, event.Type), false, payload)
+	if err != nil {
+		return err
+	}
+
+	switch e := event.Payload.(type) {
+	case events.ServerStatusChanged:
+		status := "offline"
+		if e.Online {
+			status = "online"
+		}
+		return p.send(p.topic(serverID, "status"), true, []byte(status))
+	case events.ServerDeleted:
+		// an empty retained message removes the retained status
+		return p.send(p.topic(serverID, "status"), true, nil)
+	}
+	return nil
+}
+
+// send publishes payload and waits for the broker to acknowledge it when
+// QoS is above 0. The caller must hold p.mu.
+func (p *Publisher) send(topic string, retained bool, payload []byte) error {
+	token := p.client.Publish(topic, p.cfg.QoS, retained, payload)
+	if p.cfg.QoS > 0 && !token.WaitTimeout(connectTimeout) {
+		return errors.New("timed out publishing to " + topic)
+	}
+	return token.Error()
+}
+
+// topic builds the MQTT topic of an event topic like player.joined.
+func (p *Publisher) topic(serverID uuid.UUID, eventTopic string) string {
+	levels := []string{p.cfg.TopicPrefix}
+	if serverID != uuid.Nil {
+		levels = append(levels, serverID.String())
+	}
+	levels = append(levels, strings.Split(eventTopic, ".")...)
+	return strings.Join(levels, "/")
+}
+
+func (p *Publisher) reconfigure(ctx context.Context, section map[interface{}]interface{}) {
+	cfg, err := config.ParseMQTT(section)
+	if err != nil {
+		p.logger.ErrorContext(ctx, "invalid mqtt config, keeping the current one", "error", err)
+		return
+	}
+
+	err = p.Disconnect()
+	if err != nil {
+		p.logger.ErrorContext(ctx, "failed to disconnect from mqtt broker", "error", err)
+	}
+
+	p.mu.Lock()
+	p.cfg = cfg
+	p.mu.Unlock()
+
+	err = p.Connect(ctx)
+	if err != nil {
+		p.logger.ErrorContext(ctx, "failed to connect to mqtt broker", "error", err)
+	}
+}
@@ -0,0 +1,172 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct {
+	topic    string
+	payload  string
+	retained bool
+}
+
+// broker is a minimal MQTT broker that accepts every client and records the
+// published messages.
+type broker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []message
+}
+
+func newBroker(t *testing.T) *broker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	b := &broker{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *broker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *broker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.ReturnCode = packets.Accepted
+			_ = connack.Write(conn)
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			b.messages = append(b.messages, message{topic: p.TopicName, payload: string(p.Payload), retained: p.Retain})
+			b.mu.Unlock()
+			if p.Qos == 1 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				_ = puback.Write(conn)
+			}
+		case *packets.PingreqPacket:
+			_ = packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// wait returns the recorded messages once there are at least n of them.
+func (b *broker) wait(t *testing.T, n int) []message {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		if len(b.messages) >= n {
+			messages := append([]message(nil), b.messages...)
+			b.mu.Unlock()
+			return messages
+		}
+		b.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d messages", n)
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	b := newBroker(t)
+
+	p := NewPublisher(config.MQTT{
+		Enabled:     true,
+		Broker:      b.url(),
+		ClientID:    "test",
+		TopicPrefix: "ark",
+		QoS:         1,
+	})
+	assert.NoError(t, p.Connect(ctx))
+	defer p.Disconnect()
+	b.wait(t, 1)
+
+	serverID := uuid.New()
+	publish := func(event events.Event) {
+		p.HandleEvent(ctx, events.EventMessage{Type: event.Topic(), Payload: event})
+	}
+
+	publish(events.PlayerJoined{ServerID: serverID, ServerName: "The Island", Name: "Alice"})
+	publish(events.ServerStatusChanged{Server: &model.Server{ID: serverID}, Online: true})
+	publish(events.ServerDeleted{ServerID: serverID})
+	publish(events.ConfigChanged{Section: "notification-service", Key: "discord"})
+
+	messages := b.wait(t, 7)
+	assert.Equal(t, message{topic: "ark/status", payload: "online", retained: true}, messages[0])
+
+	assert.Equal(t, "ark/"+serverID.String()+"/player/joined", messages[1].topic)
+	var joined events.PlayerJoined
+	assert.NoError(t, json.Unmarshal([]byte(messages[1].payload), &joined))
+	assert.Equal(t, "Alice", joined.Name)
+	assert.False(t, messages[1].retained)
+
+	assert.Equal(t, "ark/"+serverID.String()+"/server/online", messages[2].topic)
+	assert.Equal(t, message{topic: "ark/" + serverID.String() + "/status", payload: "online", retained: true}, messages[3])
+
+	assert.Equal(t, "ark/"+serverID.String()+"/server/deleted", messages[4].topic)
+	assert.Equal(t, message{topic: "ark/" + serverID.String() + "/status", payload: "", retained: true}, messages[5])
+
+	assert.Equal(t, "ark/config/changed", messages[6].topic)
+}
+
+func TestPublisherReconfigure(t *testing.T) {
+	ctx := context.Background()
+	b := newBroker(t)
+
+	p := NewPublisher(config.DefaultMQTT())
+	assert.NoError(t, p.Connect(ctx))
+
+	event := events.PlayerLeft{ServerID: uuid.New(), Name: "Bob"}
+	err := p.publish(events.EventMessage{Type: event.Topic(), Payload: event})
+	assert.ErrorIs(t, err, ErrNotConnected, "disabled publisher does not connect")
+
+	p.HandleEvent(ctx, events.EventMessage{Type: "config.changed", Payload: events.ConfigChanged{
+		Section: config.MQTTSection,
+		Values: map[interface{}]interface{}{
+			"enabled":     true,
+			"broker":      b.url(),
+			"topicPrefix": "home",
+		},
+	}})
+	messages := b.wait(t, 1)
+	assert.Equal(t, message{topic: "home/status", payload: "online", retained: true}, messages[0])
+
+	p.HandleEvent(ctx, events.EventMessage{Type: "config.changed", Payload: events.ConfigChanged{
+		Section: config.MQTTSection,
+		Values:  map[interface{}]interface{}{"enabled": false},
+	}})
+	messages = b.wait(t, 2)
+	assert.Equal(t, message{topic: "home/status", payload: "offline", retained: true}, messages[1])
+}
@@ -0,0 +1,157 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const requestTimeout = 10 * time.Second
+
+var ErrAPI = errors.New("ntfy error")
+
+// apiError is the body of failed ntfy requests.
+type apiError struct {
+	Message string `json:"error"`
+}
+
+// NtfyNotifier pushes events to an ntfy topic, with the priority and tags
+// configured for their type.
+type NtfyNotifier struct {
+	logger *slog.Logger
+	client *http.Client
+	cfg    config.Ntfy
+}
+
+func NewNtfyNotifier(ctx context.Context, cfg config.Ntfy) (*NtfyNotifier, error) {
+	ntfy := &NtfyNotifier{
+		logger: slog.Default().WithGroup("ntfy"),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		cfg: cfg,
+	}
+	err := ntfy.Connect(ctx)
+	if err != nil {
+		ntfy.logger.ErrorContext(ctx, "failed to connect ntfy notification service", "error", err)
+		return nil, err
+	}
+	return ntfy, nil
+}
+
+// Topics subscribes to the configured event types unless the instance lists
+// its own events, those without settings are pushed with the default
+// priority.
+func (nn *NtfyNotifier) Topics() []string {
+	topics := make([]string, 0, len(nn.cfg.Events))
+	for topic := range nn.cfg.Events {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (nn *NtfyNotifier) HandleEvent(ctx context.Context, event events.EventMessage) {
+	var title, msg string
+	switch e := event.Payload.(type) {
+	case events.PlayerJoined:
+		title = "Tracked player joined"
+		msg = e.Entry.Describe(e.Name) + " joined the server " + e.ServerName
+	case events.PlayerLeft:
+		title = "Tracked player left"
+		msg = e.Entry.Describe(e.Name) + " left the server " + e.ServerName
+	case events.ServerStatusChanged:
+		if e.Server == nil {
+			return
+		}
+		title = "Server offline"
+		msg = e.Server.Name + " is offline"
+		if e.Online {
+			title = "Server online"
+			msg = e.Server.Name + " is online"
+		}
+	default:
+		return
+	}
+
+	err := nn.publish(ctx, title, msg, nn.cfg.Event(event.Type))
+	if err != nil {
+		nn.logger.ErrorContext(ctx, "failed to push message", "error", err)
+	}
+}
+
+// Connect verifies that the topic can be published to with the configured
+// credentials.
+func (nn *NtfyNotifier) Connect(ctx context.Context) error {
+	req, err := nn.request(ctx, http.MethodGet, strings.TrimSuffix(nn.cfg.URL, "/")+"/auth", "")
+	if err != nil {
+		return err
+	}
+	return nn.do(req)
+}
+
+func (nn *NtfyNotifier) Send(ctx context.Context, message string) error {
+	return nn.publish(ctx, "Ark-Overseer", message, config.NtfyEvent{Priority: 3})
+}
+
+func (nn *NtfyNotifier) publish(ctx context.Context, title string, message string, settings config.NtfyEvent) error {
+	req, err := nn.request(ctx, http.MethodPost, nn.cfg.URL, message)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", title)
+	req.Header.Set("Priority", strconv.Itoa(settings.Priority))
+	if len(settings.Tags) > 0 {
+		req.Header.Set("Tags", strings.Join(settings.Tags, ","))
+	}
+	return nn.do(req)
+}
+
+func (nn *NtfyNotifier) request(ctx context.Context, method string, url string, body string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case nn.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+nn.cfg.Token)
+	case nn.cfg.Username != "":
+		req.SetBasicAuth(nn.cfg.Username, nn.cfg.Password)
+	}
+	return req, nil
+}
+
+func (nn *NtfyNotifier) do(req *http.Request) error {
+	resp, err := nn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var apiErr apiError
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	if err != nil || apiErr.Message == "" {
+		return fmt.Errorf("%w: %s", ErrAPI, resp.Status)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrAPI, resp.Status, apiErr.Message)
+}
+
+func (nn *NtfyNotifier) Disconnect() error {
+	nn.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,117 @@
+package ntfy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type push struct {
+	title    string
+	priority string
+	tags     string
+	message  string
+}
+
+// server is a fake ntfy server with a single topic "ark" protected by the
+// token "tk_test".
+type server struct {
+	mu     sync.Mutex
+	pushes []push
+}
+
+func newServer(t *testing.T) (*server, *httptest.Server) {
+	s := &server{}
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") == "Bearer tk_test" {
+			return true
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"code":40301,"http":403,"error":"forbidden"}`))
+		return false
+	}
+	mux.HandleFunc("GET /ark/auth", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			_, _ = w.Write([]byte(`{"success":true}`))
+		}
+	})
+	mux.HandleFunc("POST /ark", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.pushes = append(s.pushes, push{
+			title:    r.Header.Get("Title"),
+			priority: r.Header.Get("Priority"),
+			tags:     r.Header.Get("Tags"),
+			message:  string(body),
+		})
+		s.mu.Unlock()
+		_, _ = w.Write([]byte(`{"id":"abc","event":"message","topic":"ark"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newServer(t)
+
+	_, err := NewNtfyNotifier(ctx, config.Ntfy{URL: srv.URL + "/ark", Token: "wrong"})
+	assert.ErrorIs(t, err, ErrAPI)
+	assert.Contains(t, err.Error(), "forbidden")
+
+	topics := config.DefaultNtfyEvents()
+	topics["server.offline"] = config.NtfyEvent{Priority: 4, Tags: []string{"warning", "skull"}}
+	nn, err := NewNtfyNotifier(ctx, config.Ntfy{URL: srv.URL + "/ark", Token: "tk_test", Events: topics})
+	assert.NoError(t, err)
+	defer nn.Disconnect()
+	assert.Equal(t, []string{"player.joined", "player.left", "server.offline"}, nn.Topics())
+
+	publish := func(event events.Event) {
+		nn.HandleEvent(ctx, events.EventMessage{Type: event.Topic(), Payload: event})
+	}
+	publish(events.PlayerJoined{ServerName: "The Island", Name: "bob_1", Entry: &model.BlacklistPlayers{Name: "Bob"}})
+	publish(events.PlayerLeft{ServerName: "The Island", Name: "Alice"})
+	publish(events.ServerStatusChanged{Server: &model.Server{Name: "Ragnarok"}, Online: false})
+	assert.NoError(t, nn.Send(ctx, "hello"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, []push{
+		{title: "Tracked player joined", priority: "5", tags: "rotating_light", message: "Bob (as bob_1) joined the server The Island"},
+		{title: "Tracked player left", priority: "3", tags: "wave", message: "Alice left the server The Island"},
+		{title: "Server offline", priority: "4", tags: "warning,skull", message: "Ragnarok is offline"},
+		{title: "Ark-Overseer", priority: "3", message: "hello"},
+	}, s.pushes)
+}
+
+func TestNtfyPushesUnconfiguredEvents(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newServer(t)
+
+	// the instance subscribed to server.online, which has no settings
+	nn, err := NewNtfyNotifier(ctx, config.Ntfy{URL: srv.URL + "/ark", Token: "tk_test", Events: config.DefaultNtfyEvents()})
+	assert.NoError(t, err)
+	defer nn.Disconnect()
+
+	event := events.ServerStatusChanged{Server: &model.Server{Name: "Ragnarok"}, Online: true}
+	nn.HandleEvent(ctx, events.EventMessage{Type: event.Topic(), Payload: event})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, []push{
+		{title: "Server online", priority: "3", message: "Ragnarok is online"},
+	}, s.pushes)
+}
@@ -7,10 +7,20 @@ import (
 	"sync"
 
 	"github.com/led0nk/ark-overseer/internal/services/discord"
+	"github.com/led0nk/ark-overseer/internal/services/email"
+	"github.com/led0nk/ark-overseer/internal/services/gotify"
+	"github.com/led0nk/ark-overseer/internal/services/matrix"
+	"github.com/led0nk/ark-overseer/internal/services/ntfy"
+	"github.com/led0nk/ark-overseer/internal/services/telegram"
+	"github.com/led0nk/ark-overseer/internal/services/webhook"
 	"github.com/led0nk/ark-overseer/pkg/config"
 	"github.com/led0nk/ark-overseer/pkg/events"
 )
 
+// notifierBufferSize is the number of events buffered per notifier before
+// Publish starts to wait for it, so a slow API does not lose alerts.
+const notifierBufferSize = 32
+
 type Notification interface {
 	Connect(context.Context) error
 	Send(context.Context, string) error
@@ -18,8 +28,17 @@ type Notification interface {
 	Disconnect() error
 }
 
+// TopicFilter is implemented by notifiers that only care about some events,
+// Topics returns the patterns passed to events.WithTopics.
+type TopicFilter interface {
+	Topics() []string
+}
+
+// ServiceManager runs a notifier for every instance in the
+// notification-service section, subscribed under the instance name.
 type ServiceManager struct {
 	services   map[string]Notification
+	topics     map[string][]string
 	cancelFunc map[string]context.CancelFunc
 	mu         sync.Mutex
 	initWg     *sync.WaitGroup
@@ -33,6 +52,7 @@ func NewServiceManager(
 ) *ServiceManager {
 	return &ServiceManager{
 		services:   make(map[string]Notification),
+		topics:     make(map[string][]string),
 		cancelFunc: make(map[string]context.CancelFunc),
 		logger:     slog.Default().WithGroup("serviceManager"),
 		em:         em,
@@ -44,39 +64,18 @@ func (sm *ServiceManager) HandleEvent(ctx context.Context, event events.EventMes
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	switch event.Type {
-	case "init.services":
+	switch e := event.Payload.(type) {
+	case events.ServicesInit:
 		defer sm.initWg.Done()
 
-		cfg, ok := event.Payload.(*config.Config)
-		if !ok {
-			sm.logger.ErrorContext(ctx, "invalid payload type", "error", event.Type)
-			return
-		}
-
-		nService, err := cfg.GetSection("notification-service")
-		if err != nil {
-			sm.logger.Error("failed to get section from config", "error", err)
-			return
-		}
-		for key, value := range nService {
-			switch key {
-			case "discord":
-				err := sm.createDiscordService(ctx, value)
-				if err != nil {
-					sm.logger.ErrorContext(ctx, "failed to create discord service", "error", err)
-					continue
-				}
-			}
-		}
+		sm.createFromSection(ctx, e.Section)
 		sm.createServices()
 
-	case "config.changed":
-		sectionMap, ok := event.Payload.(map[interface{}]interface{})
-		if !ok {
-			sm.logger.ErrorContext(ctx, "invalid payload type", "error", event.Type)
+	case events.ConfigChanged:
+		if e.Section != config.NotificationSection {
 			return
 		}
+		sm.logger.DebugContext(ctx, "notification services changed", "config", config.Redact(e.Values))
 
 		for serviceName, service := range sm.services {
 			err := service.Disconnect()
@@ -84,60 +83,171 @@ func (sm *ServiceManager) HandleEvent(ctx context.Context, event events.EventMes
 				sm.logger.ErrorContext(
 					ctx,
 					"failed to disconnect notification service",
-					"error",
+					"service",
 					serviceName,
+					"error",
+					err,
 				)
 				continue
 			}
 		}
 		sm.deleteServices()
 
-		//NOTE: range over sectionMap for notification services
-		for k, v := range sectionMap {
-			switch k {
-			case "discord":
-				err := sm.createDiscordService(ctx, v)
-				if err != nil {
-					sm.logger.ErrorContext(ctx, "failed to create discord service", "error", err)
-					continue
-				}
-			}
-		}
+		sm.createFromSection(ctx, e.Values)
 		sm.createServices()
 	}
 }
 
-func (sm *ServiceManager) createDiscordService(ctx context.Context, v interface{}) error {
+// createFromSection creates a notification service for every instance of
+// the notification-service config section.
+func (sm *ServiceManager) createFromSection(ctx context.Context, section map[interface{}]interface{}) {
+	instances, err := config.ParseInstances(section[config.InstancesKey])
+	if err != nil {
+		sm.logger.ErrorContext(ctx, "skipping invalid notification services", "error", err)
+	}
+
+	for _, instance := range instances {
+		service, err := sm.createService(ctx, instance)
+		if err != nil {
+			sm.logger.ErrorContext(ctx, "failed to create "+instance.Type+" service", "error", err, "name", instance.Name)
+			continue
+		}
+		sm.services[instance.Name] = service
+		sm.topics[instance.Name] = instance.Events
+	}
+}
+
+func (sm *ServiceManager) createService(ctx context.Context, instance config.Instance) (Notification, error) {
+	switch instance.Type {
+	case config.DiscordKey:
+		return sm.createDiscordService(ctx, instance.Settings)
+	case config.TelegramKey:
+		return sm.createTelegramService(ctx, instance.Settings)
+	case config.MatrixKey:
+		return sm.createMatrixService(ctx, instance.Settings)
+	case config.SMTPKey:
+		return sm.createEmailService(ctx, instance.Settings)
+	case config.NtfyKey:
+		return sm.createNtfyService(ctx, instance.Settings)
+	case config.GotifyKey:
+		return sm.createGotifyService(ctx, instance.Settings)
+	case config.WebhookKey:
+		return sm.createWebhookService(instance)
+	}
+	return nil, fmt.Errorf("unknown notification service type %q", instance.Type)
+}
+
+func (sm *ServiceManager) createDiscordService(ctx context.Context, v interface{}) (Notification, error) {
 
 	newConfig, ok := v.(map[interface{}]interface{})
 	if !ok {
-		return fmt.Errorf("invalid payload type")
+		return nil, fmt.Errorf("invalid payload type")
 	}
 
 	token, ok := newConfig["token"].(string)
 	if !ok {
-		return fmt.Errorf("invalid token type")
+		return nil, fmt.Errorf("invalid token type")
 	}
 
 	channelID, ok := newConfig["channelID"].(string)
 	if !ok {
-		return fmt.Errorf("invalid channelID type")
+		return nil, fmt.Errorf("invalid channelID type")
 	}
 
 	var err error
 	newDiscord, err := discord.NewDiscordNotifier(ctx, token, channelID)
 	if err != nil {
-		return fmt.Errorf("failed to create discord notifier: %w", err)
+		return nil, fmt.Errorf("failed to create discord notifier: %w", err)
+	}
+	return newDiscord, nil
+}
+
+func (sm *ServiceManager) createTelegramService(ctx context.Context, v interface{}) (Notification, error) {
+	cfg, err := config.ParseTelegram(v)
+	if err != nil {
+		return nil, err
+	}
+	newTelegram, err := telegram.NewTelegramNotifier(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telegram notifier: %w", err)
 	}
-	sm.services["discord"] = newDiscord
-	return nil
+	return newTelegram, nil
+}
+
+func (sm *ServiceManager) createMatrixService(ctx context.Context, v interface{}) (Notification, error) {
+	cfg, err := config.ParseMatrix(v)
+	if err != nil {
+		return nil, err
+	}
+	newMatrix, err := matrix.NewMatrixNotifier(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create matrix notifier: %w", err)
+	}
+	return newMatrix, nil
+}
+
+func (sm *ServiceManager) createEmailService(ctx context.Context, v interface{}) (Notification, error) {
+	cfg, err := config.ParseSMTP(v)
+	if err != nil {
+		return nil, err
+	}
+	newEmail, err := email.NewEmailNotifier(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email notifier: %w", err)
+	}
+	return newEmail, nil
+}
+
+func (sm *ServiceManager) createNtfyService(ctx context.Context, v interface{}) (Notification, error) {
+	cfg, err := config.ParseNtfy(v)
+	if err != nil {
+		return nil, err
+	}
+	newNtfy, err := ntfy.NewNtfyNotifier(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ntfy notifier: %w", err)
+	}
+	return newNtfy, nil
+}
+
+func (sm *ServiceManager) createGotifyService(ctx context.Context, v interface{}) (Notification, error) {
+	cfg, err := config.ParseGotify(v)
+	if err != nil {
+		return nil, err
+	}
+	newGotify, err := gotify.NewGotifyNotifier(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gotify notifier: %w", err)
+	}
+	return newGotify, nil
+}
+
+// createWebhookService posts the events of the instance to its URL.
+func (sm *ServiceManager) createWebhookService(instance config.Instance) (Notification, error) {
+	hook, err := config.ParseWebhook(instance.Settings)
+	if err != nil {
+		return nil, err
+	}
+	if len(instance.Events) > 0 {
+		hook.Events = instance.Events
+	}
+	return webhook.NewNotifier(hook), nil
 }
 
 func (sm *ServiceManager) createServices() {
 	for serviceName, service := range sm.services {
 		ctx, cancel := context.WithCancel(context.Background())
 		sm.cancelFunc[serviceName] = cancel
-		go sm.em.StartListening(ctx, service, serviceName, func() {})
+		opts := []events.SubscribeOption{
+			events.WithPolicy(events.Block),
+			events.WithBufferSize(notifierBufferSize),
+		}
+		if topics := sm.topics[serviceName]; len(topics) > 0 {
+			opts = append(opts, events.WithTopics(topics...))
+		} else if filter, ok := service.(TopicFilter); ok {
+			opts = append(opts, events.WithTopics(filter.Topics()...))
+		}
+		go sm.em.StartListening(ctx, service, serviceName, func() {}, opts...)
 	}
 }
 
@@ -146,5 +256,6 @@ func (sm *ServiceManager) deleteServices() {
 		cancel()
 		delete(sm.cancelFunc, serviceName)
 		delete(sm.services, serviceName)
+		delete(sm.topics, serviceName)
 	}
 }
@@ -0,0 +1,168 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const requestTimeout = 10 * time.Second
+
+var ErrAPI = errors.New("telegram bot api error")
+
+// response is the envelope of every Bot API response.
+type response struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+type message struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// TelegramNotifier sends player events through a Telegram bot, formatted
+// as MarkdownV2.
+type TelegramNotifier struct {
+	logger *slog.Logger
+	client *http.Client
+	cfg    config.Telegram
+}
+
+func NewTelegramNotifier(ctx context.Context, cfg config.Telegram) (*TelegramNotifier, error) {
+	telegram := &TelegramNotifier{
+		logger: slog.Default().WithGroup("telegram"),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		cfg: cfg,
+	}
+	err := telegram.Connect(ctx)
+	if err != nil {
+		telegram.logger.ErrorContext(ctx, "failed to connect telegram notification service", "error", err)
+		return nil, err
+	}
+	return telegram, nil
+}
+
+// Topics limits the notifier to player events.
+func (tn *TelegramNotifier) Topics() []string {
+	return []string{"player.*"}
+}
+
+func (tn *TelegramNotifier) HandleEvent(ctx context.Context, event events.EventMessage) {
+	var msg string
+	switch e := event.Payload.(type) {
+	case events.PlayerJoined:
+		msg = formatPlayer(e.Entry.Identify(e.Name)) + " joined the server *" + Escape(e.ServerName) + "*"
+	case events.PlayerLeft:
+		msg = formatPlayer(e.Entry.Identify(e.Name)) + " left the server *" + Escape(e.ServerName) + "*"
+	default:
+		return
+	}
+
+	err := tn.send(ctx, msg)
+	if err != nil {
+		tn.logger.ErrorContext(ctx, "failed to send message", "error", err)
+	}
+}
+
+// formatPlayer puts the person returned by model.BlacklistPlayers.Identify
+// in bold, followed by the alias if there is one.
+func formatPlayer(person string, alias string) string {
+	if alias == "" {
+		return "*" + Escape(person) + "*"
+	}
+	return "*" + Escape(person) + "* \\(as " + Escape(alias) + "\\)"
+}
+
+// Connect verifies the token by asking the Bot API for the bot.
+func (tn *TelegramNotifier) Connect(ctx context.Context) error {
+	return tn.call(ctx, "getMe", nil)
+}
+
+// Send sends message as plain text, Markdown characters are escaped.
+func (tn *TelegramNotifier) Send(ctx context.Context, message string) error {
+	return tn.send(ctx, Escape(message))
+}
+
+func (tn *TelegramNotifier) send(ctx context.Context, markdown string) error {
+	return tn.call(ctx, "sendMessage", message{
+		ChatID:                tn.cfg.ChatID,
+		Text:                  markdown,
+		ParseMode:             "MarkdownV2",
+		DisableWebPagePreview: true,
+	})
+}
+
+// call invokes method of the Bot API with params as JSON body.
+func (tn *TelegramNotifier) call(ctx context.Context, method string, params any) error {
+	var body bytes.Buffer
+	if params != nil {
+		err := json.NewEncoder(&body).Encode(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	endpoint := strings.TrimSuffix(tn.cfg.APIURL, "/") + "/bot" + tn.cfg.Token + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := tn.client.Do(req)
+	if err != nil {
+		// the error contains the URL and with it the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var result response
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrAPI, method, resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("%w: %s: %s", ErrAPI, method, result.Description)
+	}
+	return nil
+}
+
+func (tn *TelegramNotifier) Disconnect() error {
+	tn.client.CloseIdleConnections()
+	return nil
+}
+
+// markdownEscaper escapes the characters reserved by MarkdownV2.
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(",
+	")", "\\)", "~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+",
+	"-", "\\-", "=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.",
+	"!", "\\!",
+)
+
+// Escape returns text with all MarkdownV2 characters escaped, so it is
+// shown as is.
+func Escape(text string) string {
+	return markdownEscaper.Replace(text)
+}
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "123:abc"
+
+// botAPI is a fake Bot API that accepts testToken and records the sent
+// messages.
+type botAPI struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func (b *botAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if token != testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+		return
+	}
+
+	switch method {
+	case "getMe":
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":123,"is_bot":true,"username":"ark_bot"}}`))
+	case "sendMessage":
+		var msg message
+		err := json.NewDecoder(r.Body).Decode(&msg)
+		if err != nil || msg.ChatID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		b.mu.Lock()
+		b.messages = append(b.messages, msg)
+		b.mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":404,"description":"Not Found"}`))
+	}
+}
+
+func (b *botAPI) sent() []message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]message(nil), b.messages...)
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	ctx := context.Background()
+	api := &botAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	_, err := NewTelegramNotifier(ctx, config.Telegram{Token: "wrong", ChatID: "42", APIURL: srv.URL})
+	assert.ErrorIs(t, err, ErrAPI)
+	assert.NotContains(t, err.Error(), "wrong", "errors do not leak the token")
+
+	tn, err := NewTelegramNotifier(ctx, config.Telegram{Token: testToken, ChatID: "42", APIURL: srv.URL})
+	assert.NoError(t, err)
+	defer tn.Disconnect()
+
+	event := events.PlayerJoined{
+		ServerName: "The Island (PvP)",
+		Name:       "bob_1",
+		Entry:      &model.BlacklistPlayers{Name: "Bob"},
+	}
+	tn.HandleEvent(ctx, events.EventMessage{Type: event.Topic(), Payload: event})
+	left := events.PlayerLeft{ServerName: "Ragnarok", Name: "Alice"}
+	tn.HandleEvent(ctx, events.EventMessage{Type: left.Topic(), Payload: left})
+	assert.NoError(t, tn.Send(ctx, "2 players online."))
+
+	messages := api.sent()
+	assert.Len(t, messages, 3)
+	assert.Equal(t, message{
+		ChatID:                "42",
+		Text:                  `*Bob* \(as bob\_1\) joined the server *The Island \(PvP\)*`,
+		ParseMode:             "MarkdownV2",
+		DisableWebPagePreview: true,
+	}, messages[0])
+	assert.Equal(t, `*Alice* left the server *Ragnarok*`, messages[1].Text)
+	assert.Equal(t, `2 players online\.`, messages[2].Text)
+
+	tn.cfg.ChatID = ""
+	err = tn.Send(ctx, "lost")
+	assert.ErrorIs(t, err, ErrAPI)
+	assert.Contains(t, err.Error(), "chat not found")
+}
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	// EventHeader holds the topic of the event, e.g. player.joined.
+	EventHeader = "X-Ark-Overseer-Event"
+	// SignatureHeader holds "sha256=" followed by the hex encoded
+	// HMAC-SHA256 of the body, keyed with the secret of the webhook.
+	SignatureHeader = "X-Ark-Overseer-Signature"
+
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	requestTimeout = 10 * time.Second
+	// retryBudget limits the time spent on one event or message including
+	// all retries, so the handler returns before the event manager gives
+	// up on it.
+	retryBudget = events.DefaultHandlerTimeout - 5*time.Second
+)
+
+var ErrRejected = errors.New("webhook rejected request")
+
+// Payload is the JSON body POSTed to the webhooks. Messages sent with Send
+// have the type "message" and no event. The watchlist entry of player
+// events is sent without its sightings.
+type Payload struct {
+	Type    string       `json:"type"`
+	Time    time.Time    `json:"time"`
+	Event   events.Event `json:"event,omitempty"`
+	Message string       `json:"message,omitempty"`
+}
+
+// Notifier POSTs events to a webhook. Requests failing with a
+// network error or a 5xx status are retried with an exponential backoff
+// until the retryBudget is used up, other 4xx responses are not retried.
+type Notifier struct {
+	logger  *slog.Logger
+	client  *http.Client
+	hook    config.Webhook
+	retries int
+	backoff time.Duration
+}
+
+func NewNotifier(hook config.Webhook) *Notifier {
+	return &Notifier{
+		logger: slog.Default().WithGroup("webhook"),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		hook:    hook,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+	}
+}
+
+// Topics returns the event patterns of the webhook.
+func (n *Notifier) Topics() []string {
+	return n.hook.Events
+}
+
+func (n *Notifier) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (n *Notifier) Disconnect() error {
+	n.client.CloseIdleConnections()
+	return nil
+}
+
+func (n *Notifier) HandleEvent(ctx context.Context, event events.EventMessage) {
+	body, err := json.Marshal(Payload{Type: event.Type, Time: time.Now().UTC(), Event: trim(event.Payload)})
+	if err != nil {
+		n.logger.ErrorContext(ctx, "failed to encode event", "error", err, "type", event.Type)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, retryBudget)
+	defer cancel()
+
+	err = n.post(ctx, event.Type, body)
+	if err != nil {
+		n.logger.ErrorContext(ctx, "failed to call webhook", "error", err, "url", n.hook.URL, "type", event.Type)
+	}
+}
+
+// Send posts message to the webhook regardless of its events.
+func (n *Notifier) Send(ctx context.Context, message string) error {
+	body, err := json.Marshal(Payload{Type: "message", Time: time.Now().UTC(), Message: message})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, retryBudget)
+	defer cancel()
+
+	return n.post(ctx, "message", body)
+}
+
+// trim drops the sightings from the watchlist entry of player events, the
+// whole history of the entry does not belong into every notification.
+func trim(event events.Event) events.Event {
+	switch e := event.(type) {
+	case events.PlayerJoined:
+		e.Entry = withoutSightings(e.Entry)
+		return e
+	case events.PlayerLeft:
+		e.Entry = withoutSightings(e.Entry)
+		return e
+	}
+	return event
+}
+
+func withoutSightings(entry *model.BlacklistPlayers) *model.BlacklistPlayers {
+	if entry == nil {
+		return nil
+	}
+	trimmed := *entry
+	trimmed.Sightings = nil
+	return &trimmed
+}
+
+// post sends body to the webhook, retrying network errors and 5xx responses as
+// long as the deadline of ctx leaves time for the backoff.
+func (n *Notifier) post(ctx context.Context, topic string, body []byte) error {
+	for attempt := 0; ; attempt++ {
+		err := n.do(ctx, topic, body)
+		if err == nil || errors.Is(err, ErrRejected) || attempt == n.retries {
+			return err
+		}
+
+		backoff := n.backoff << attempt
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return err
+		}
+		n.logger.WarnContext(ctx, "webhook failed, retrying", "error", err, "url", n.hook.URL, "backoff", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func (n *Notifier) do(ctx context.Context, topic string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	for name, value := range n.hook.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, topic)
+	if n.hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.hook.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%w: %s", ErrRejected, resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the value of the SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/config"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver records the requests and answers with the given status codes in
+// turn, the last one is repeated.
+type receiver struct {
+	mu       sync.Mutex
+	requests []request
+	statuses []int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, request{header: r.Header, body: body})
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []request {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]request(nil), rc.requests...)
+}
+
+func newNotifier(hook config.Webhook) *Notifier {
+	n := NewNotifier(hook)
+	n.backoff = time.Millisecond
+	return n
+}
+
+func handle(n *Notifier, event events.Event) {
+	n.HandleEvent(context.Background(), events.EventMessage{Type: event.Topic(), Payload: event})
+}
+
+func TestHandleEvent(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusNoContent}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(config.Webhook{
+		URL:     srv.URL,
+		Secret:  "s3cret",
+		Headers: map[string]string{"Authorization": "Bearer abc"},
+		Events:  []string{"player.joined"},
+	})
+	assert.Equal(t, []string{"player.joined"}, n.Topics())
+
+	serverID := uuid.New()
+	entry := &model.BlacklistPlayers{Name: "Alice", Sightings: []*model.Sighting{{Alias: "Alice", Server: "The Island"}}}
+	handle(n, events.PlayerJoined{ServerID: serverID, ServerName: "The Island", Name: "Alice", Entry: entry})
+
+	requests := rc.received()
+	assert.Len(t, requests, 1)
+	req := requests[0]
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer abc", req.header.Get("Authorization"))
+	assert.Equal(t, "player.joined", req.header.Get(EventHeader))
+	assert.Equal(t, Sign("s3cret", req.body), req.header.Get(SignatureHeader))
+
+	var payload struct {
+		Type  string              `json:"type"`
+		Event events.PlayerJoined `json:"event"`
+	}
+	assert.NoError(t, json.Unmarshal(req.body, &payload))
+	assert.Equal(t, "player.joined", payload.Type)
+	assert.Equal(t, serverID, payload.Event.ServerID)
+	assert.Equal(t, "Alice", payload.Event.Name)
+	assert.Equal(t, "Alice", payload.Event.Entry.Name)
+	assert.Empty(t, payload.Event.Entry.Sightings, "sightings are not sent")
+	assert.Len(t, entry.Sightings, 1, "the published entry must not change")
+}
+
+func TestHandleEventUnsigned(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(config.Webhook{URL: srv.URL, Events: []string{"player.*"}})
+	handle(n, events.PlayerLeft{Name: "Bob"})
+
+	requests := rc.received()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "player.left", requests[0].header.Get(EventHeader))
+	assert.Empty(t, requests[0].header.Get(SignatureHeader), "unsigned without secret")
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{name: "success after 5xx", statuses: []int{500, 502, 200}, requests: 3},
+		{name: "gives up after retries", statuses: []int{503}, requests: defaultRetries + 1, wantErr: true},
+		{name: "4xx is not retried", statuses: []int{400}, requests: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+
+			n := newNotifier(config.Webhook{URL: srv.URL, Events: config.DefaultWebhookEvents})
+			err := n.Send(context.Background(), "hello")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, rc.received(), tt.requests)
+		})
+	}
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(config.Webhook{URL: srv.URL, Events: config.DefaultWebhookEvents})
+	n.backoff = 100 * time.Millisecond
+
+	// the second backoff of 200ms does not fit into the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := n.Send(ctx, "hello")
+	assert.Error(t, err)
+	assert.Len(t, rc.received(), 2)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+}
@@ -0,0 +1,403 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/model"
+)
+
+// Blacklist implements blacklist.Blacklister on top of SQLite.
+type Blacklist struct {
+	db     *DB
+	logger *slog.Logger
+}
+
+func NewBlacklist(db *DB) *Blacklist {
+	return &Blacklist{
+		db:     db,
+		logger: slog.Default().WithGroup("sqlite"),
+	}
+}
+
+func (b *Blacklist) Create(
+	ctx context.Context,
+	player *model.BlacklistPlayers,
+) (*model.BlacklistPlayers, error) {
+	ctx, span := tracer.Start(ctx, "Blacklist.Create")
+	defer span.End()
+
+	if player.ID == uuid.Nil {
+		player.ID = uuid.New()
+	}
+	if player.List == "" {
+		player.List = blacklist.DefaultList
+	}
+
+	err := b.db.withTx(ctx, func(tx *sql.Tx) error {
+		taken, err := exists(ctx, tx, player.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return fmt.Errorf("%w: id %s is taken", blacklist.ErrDuplicate, player.ID)
+		}
+		err = validateTx(ctx, tx, player)
+		if err != nil {
+			return err
+		}
+		return insertPlayer(ctx, tx, player)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return player, nil
+}
+
+func (b *Blacklist) GetByID(ctx context.Context, id uuid.UUID) (*model.BlacklistPlayers, error) {
+	ctx, span := tracer.Start(ctx, "Blacklist.GetByID")
+	defer span.End()
+
+	row := b.db.db.QueryRowContext(ctx, `SELECT id, name, list, server, aliases, steamids, score, duration
+		FROM blacklist WHERE id = ?`, id.String())
+	player, err := scanPlayer(row)
+	if err != nil {
+		return nil, err
+	}
+
+	player.Sightings, err = b.sightings(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return player, nil
+}
+
+func (b *Blacklist) Update(ctx context.Context, player *model.BlacklistPlayers) error {
+	ctx, span := tracer.Start(ctx, "Blacklist.Update")
+	defer span.End()
+
+	if player.List == "" {
+		player.List = blacklist.DefaultList
+	}
+
+	return b.db.withTx(ctx, func(tx *sql.Tx) error {
+		err := requireExists(ctx, tx, player.ID)
+		if err != nil {
+			return err
+		}
+		err = validateTx(ctx, tx, player)
+		if err != nil {
+			return err
+		}
+
+		aliases, err := json.Marshal(player.Aliases)
+		if err != nil {
+			return err
+		}
+		steamIDs, err := json.Marshal(player.SteamIDs)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `UPDATE blacklist
+			SET name = ?, list = ?, server = ?, aliases = ?, steamids = ?, score = ?, duration = ?
+			WHERE id = ?`,
+			player.Name, player.List, player.Server, string(aliases), string(steamIDs),
+			player.Score, int64(player.Duration), player.ID.String(),
+		)
+		if err != nil {
+			return err
+		}
+		return requireAffected(result)
+	})
+}
+
+// Edit applies the user editable fields of the given entry to the stored
+// one in a single transaction, so sightings recorded meanwhile are kept.
+func (b *Blacklist) Edit(ctx context.Context, edit *model.BlacklistPlayers) (*model.BlacklistPlayers, error) {
+	ctx, span := tracer.Start(ctx, "Blacklist.Edit")
+	defer span.End()
+
+	err := b.db.withTx(ctx, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `SELECT id, name, list, server, aliases, steamids, score, duration
+			FROM blacklist WHERE id = ?`, edit.ID.String())
+		player, err := scanPlayer(row)
+		if err != nil {
+			return err
+		}
+		blacklist.ApplyEdit(player, edit)
+		err = validateTx(ctx, tx, player)
+		if err != nil {
+			return err
+		}
+
+		aliases, err := json.Marshal(player.Aliases)
+		if err != nil {
+			return err
+		}
+		steamIDs, err := json.Marshal(player.SteamIDs)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `UPDATE blacklist
+			SET name = ?, list = ?, server = ?, aliases = ?, steamids = ?
+			WHERE id = ?`,
+			player.Name, player.List, player.Server, string(aliases), string(steamIDs), player.ID.String(),
+		)
+		if err != nil {
+			return err
+		}
+		return requireAffected(result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.GetByID(ctx, edit.ID)
+}
+
+func (b *Blacklist) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "Blacklist.Delete")
+	defer span.End()
+
+	result, err := b.db.db.ExecContext(ctx, `DELETE FROM blacklist WHERE id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// List returns all entries without their sighting history, which is only
+// loaded by GetByID.
+func (b *Blacklist) List(ctx context.Context) []*model.BlacklistPlayers {
+	ctx, span := tracer.Start(ctx, "Blacklist.List")
+	defer span.End()
+
+	players, err := listPlayers(ctx, b.db.db)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "failed to list blacklist", "error", err)
+		return []*model.BlacklistPlayers{}
+	}
+	return players
+}
+
+// RecordSighting follows the semantics of blacklist.Blacklist.RecordSighting.
+func (b *Blacklist) RecordSighting(ctx context.Context, id uuid.UUID, sighting model.Sighting) error {
+	ctx, span := tracer.Start(ctx, "Blacklist.RecordSighting")
+	defer span.End()
+
+	return b.db.withTx(ctx, func(tx *sql.Tx) error {
+		err := requireExists(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if !sighting.Left.IsZero() {
+			result, err := tx.ExecContext(ctx, `UPDATE sightings SET left_at = ?
+				WHERE id = (
+					SELECT id FROM sightings
+					WHERE player_id = ? AND alias = ? AND server = ? AND left_at IS NULL
+					ORDER BY id DESC LIMIT 1
+				)`,
+				unixNano(sighting.Left), id.String(), sighting.Alias, sighting.Server,
+			)
+			if err != nil {
+				return err
+			}
+			if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+				return err
+			}
+		}
+
+		err = insertSighting(ctx, tx, id, &sighting)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM sightings
+			WHERE player_id = ? AND id NOT IN (
+				SELECT id FROM sightings WHERE player_id = ? ORDER BY id DESC LIMIT ?
+			)`,
+			id.String(), id.String(), blacklist.MaxSightings,
+		)
+		return err
+	})
+}
+
+func (b *Blacklist) sightings(ctx context.Context, id uuid.UUID) ([]*model.Sighting, error) {
+	rows, err := b.db.db.QueryContext(ctx, `SELECT alias, server, joined_at, left_at
+		FROM sightings WHERE player_id = ? ORDER BY id`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sightings []*model.Sighting
+	for rows.Next() {
+		var (
+			sighting     model.Sighting
+			joined, left sql.NullInt64
+		)
+		err := rows.Scan(&sighting.Alias, &sighting.Server, &joined, &left)
+		if err != nil {
+			return nil, err
+		}
+		sighting.Joined = fromUnixNano(joined)
+		sighting.Left = fromUnixNano(left)
+		sightings = append(sightings, &sighting)
+	}
+	return sightings, rows.Err()
+}
+
+type querier interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}
+
+func listPlayers(ctx context.Context, db querier) ([]*model.BlacklistPlayers, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, name, list, server, aliases, steamids, score, duration
+		FROM blacklist ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	players := make([]*model.BlacklistPlayers, 0)
+	for rows.Next() {
+		player, err := scanPlayer(rows)
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, player)
+	}
+	return players, rows.Err()
+}
+
+func validateTx(ctx context.Context, tx *sql.Tx, player *model.BlacklistPlayers) error {
+	existing, err := listPlayers(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return blacklist.Validate(player, existing)
+}
+
+func insertPlayer(ctx context.Context, tx *sql.Tx, player *model.BlacklistPlayers) error {
+	aliases, err := json.Marshal(player.Aliases)
+	if err != nil {
+		return err
+	}
+	steamIDs, err := json.Marshal(player.SteamIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO blacklist (id, name, list, server, aliases, steamids, score, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		player.ID.String(), player.Name, player.List, player.Server, string(aliases), string(steamIDs),
+		player.Score, int64(player.Duration),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, sighting := range player.Sightings {
+		err = insertSighting(ctx, tx, player.ID, sighting)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertSighting(ctx context.Context, tx *sql.Tx, id uuid.UUID, sighting *model.Sighting) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO sightings (player_id, alias, server, joined_at, left_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		id.String(), sighting.Alias, sighting.Server, unixNano(sighting.Joined), unixNano(sighting.Left),
+	)
+	return err
+}
+
+func scanPlayer(row scanner) (*model.BlacklistPlayers, error) {
+	var (
+		player   model.BlacklistPlayers
+		id       string
+		aliases  string
+		steamIDs string
+		duration int64
+	)
+
+	err := row.Scan(&id, &player.Name, &player.List, &player.Server, &aliases, &steamIDs, &player.Score, &duration)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, blacklist.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	player.ID, err = uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	player.Duration = time.Duration(duration)
+
+	err = json.Unmarshal([]byte(aliases), &player.Aliases)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(steamIDs), &player.SteamIDs)
+	if err != nil {
+		return nil, err
+	}
+	return &player, nil
+}
+
+func requireExists(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	found, err := exists(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return blacklist.ErrNotFound
+	}
+	return nil
+}
+
+func exists(ctx context.Context, tx *sql.Tx, id uuid.UUID) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM blacklist WHERE id = ?`, id.String()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return blacklist.ErrNotFound
+	}
+	return nil
+}
+
+func unixNano(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func fromUnixNano(n sql.NullInt64) time.Time {
+	if !n.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, n.Int64)
+}
@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/internal/storage"
+	"github.com/led0nk/ark-overseer/pkg/schema"
+)
+
+const importedKey = "json_imported"
+
+// ImportJSON copies the servers and blacklist entries of the JSON file
+// stores into the database, files of older schema versions are upgraded on
+// the fly. The import runs only once per database, later
+// calls return false without touching the data. Missing files are skipped.
+func (d *DB) ImportJSON(ctx context.Context, clusterFile string, blacklistFile string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "ImportJSON")
+	defer span.End()
+
+	var imported bool
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		var value string
+		err := tx.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = ?`, importedKey).Scan(&value)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		servers := make(map[uuid.UUID]*model.Server)
+		err = readFile(clusterFile, storage.Schema, &servers)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", clusterFile, err)
+		}
+
+		players := make(map[uuid.UUID]*model.BlacklistPlayers)
+		err = readFile(blacklistFile, blacklist.Schema, &players)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", blacklistFile, err)
+		}
+
+		for _, server := range servers {
+			err = insertServer(ctx, tx, server)
+			if err != nil {
+				return fmt.Errorf("failed to import server %s: %w", server.ID, err)
+			}
+		}
+
+		for _, player := range players {
+			if player.List == "" {
+				player.List = blacklist.DefaultList
+			}
+			err = insertPlayer(ctx, tx, player)
+			if err != nil {
+				return fmt.Errorf("failed to import blacklist entry %s: %w", player.ID, err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO meta (key, value) VALUES (?, ?)`,
+			importedKey, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		imported = true
+		return nil
+	})
+	return imported, err
+}
+
+func readFile(filename string, registry *schema.Registry, v any) error {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = registry.Decode(data, v)
+	return err
+}
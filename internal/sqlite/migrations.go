@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations holds the schema changes in the order they are applied. The
+// position in the slice is the schema version, so existing entries must
+// never be changed or reordered, only appended.
+var migrations = []string{
+	`CREATE TABLE servers (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		addr        TEXT NOT NULL,
+		status      INTEGER NOT NULL DEFAULT 0,
+		serverinfo  TEXT,
+		playersinfo TEXT
+	)`,
+	`CREATE TABLE blacklist (
+		id       TEXT PRIMARY KEY,
+		name     TEXT NOT NULL,
+		list     TEXT NOT NULL,
+		server   TEXT NOT NULL DEFAULT '',
+		aliases  TEXT NOT NULL DEFAULT '[]',
+		steamids TEXT NOT NULL DEFAULT '[]',
+		score    INTEGER NOT NULL DEFAULT 0,
+		duration INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE sightings (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		player_id TEXT NOT NULL REFERENCES blacklist(id) ON DELETE CASCADE,
+		alias     TEXT NOT NULL,
+		server    TEXT NOT NULL,
+		joined_at INTEGER,
+		left_at   INTEGER
+	)`,
+	`CREATE INDEX sightings_player_id ON sightings(player_id)`,
+	`CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`ALTER TABLE servers DROP COLUMN status`,
+	`ALTER TABLE servers DROP COLUMN serverinfo`,
+	`ALTER TABLE servers DROP COLUMN playersinfo`,
+}
+
+func (d *DB) migrate(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := d.withTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, migrations[i])
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, i+1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (d *DB) withTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
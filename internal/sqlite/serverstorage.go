@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/internal/storage"
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ServerStorage implements storage.Database on top of SQLite.
+type ServerStorage struct {
+	db *DB
+}
+
+func NewServerStorage(db *DB) *ServerStorage {
+	return &ServerStorage{db: db}
+}
+
+func init() {
+	storage.Register("sqlite", openStorage)
+}
+
+// openStorage opens the database of a sqlite:///path/to/overseer.db URL.
+func openStorage(ctx context.Context, u *url.URL) (storage.Database, error) {
+	path := storage.Path(u)
+	if path == "" {
+		return nil, errors.New("sqlite storage requires a file, e.g. sqlite:///etc/ark-overseer/overseer.db")
+	}
+
+	db, err := Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return NewServerStorage(db), nil
+}
+
+// DB returns the database the storage is backed by, e.g. to share it with
+// the blacklist.
+func (s *ServerStorage) DB() *DB {
+	return s.db
+}
+
+// Save is a no-op, every change is written to the database immediately.
+func (s *ServerStorage) Save() error {
+	return nil
+}
+
+func (s *ServerStorage) Create(ctx context.Context, server *model.Server) (*model.Server, error) {
+	ctx, span := tracer.Start(ctx, "Create")
+	defer span.End()
+
+	if server.ID == uuid.Nil {
+		server.ID = uuid.New()
+	}
+
+	definition := server.Definition()
+	err := insertServer(ctx, s.db.db, definition)
+	if err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+func (s *ServerStorage) Update(ctx context.Context, server *model.Server) error {
+	ctx, span := tracer.Start(ctx, "Update")
+	defer span.End()
+
+	result, err := s.db.db.ExecContext(ctx, `UPDATE servers SET name = ?, addr = ? WHERE id = ?`,
+		server.Name, server.Addr, server.ID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	return requireServer(result)
+}
+
+func (s *ServerStorage) GetByName(ctx context.Context, name string) (*model.Server, error) {
+	ctx, span := tracer.Start(ctx, "GetByName")
+	defer span.End()
+
+	if name == "" {
+		return nil, errors.New("empty name")
+	}
+
+	row := s.db.db.QueryRowContext(ctx, `SELECT id, name, addr
+		FROM servers WHERE name = ? LIMIT 1`, name)
+	return scanServer(row)
+}
+
+func (s *ServerStorage) GetByID(ctx context.Context, id uuid.UUID) (*model.Server, error) {
+	ctx, span := tracer.Start(ctx, "GetByID")
+	defer span.End()
+
+	if id == uuid.Nil {
+		return nil, errors.New("empty uuid")
+	}
+
+	row := s.db.db.QueryRowContext(ctx, `SELECT id, name, addr
+		FROM servers WHERE id = ?`, id.String())
+	return scanServer(row)
+}
+
+func (s *ServerStorage) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "Delete")
+	defer span.End()
+
+	if id == uuid.Nil {
+		return errors.New("requires server ID")
+	}
+
+	result, err := s.db.db.ExecContext(ctx, `DELETE FROM servers WHERE id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	return requireServer(result)
+}
+
+func (s *ServerStorage) List(ctx context.Context) ([]*model.Server, error) {
+	ctx, span := tracer.Start(ctx, "List")
+	defer span.End()
+
+	rows, err := s.db.db.QueryContext(ctx, `SELECT id, name, addr
+		FROM servers ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serverlist := make([]*model.Server, 0)
+	for rows.Next() {
+		server, err := scanServer(rows)
+		if err != nil {
+			return nil, err
+		}
+		serverlist = append(serverlist, server)
+	}
+	return serverlist, rows.Err()
+}
+
+func insertServer(ctx context.Context, exec execer, server *model.Server) error {
+	_, err := exec.ExecContext(ctx, `INSERT INTO servers (id, name, addr) VALUES (?, ?, ?)`,
+		server.ID.String(), server.Name, server.Addr,
+	)
+	var sqliteErr *driver.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return fmt.Errorf("%w: id %s is taken", storage.ErrDuplicate, server.ID)
+	}
+	return err
+}
+
+func requireServer(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}
+
+type scanner interface {
+	Scan(...any) error
+}
+
+func scanServer(row scanner) (*model.Server, error) {
+	var (
+		server model.Server
+		id     string
+	)
+
+	err := row.Scan(&id, &server.Name, &server.Addr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	server.ID, err = uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	_ "modernc.org/sqlite"
+)
+
+var tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/internal/sqlite")
+
+// DB is a SQLite database holding the server storage and the blacklist.
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the SQLite database at dsn and applies all pending schema
+// migrations. Both a plain file path and a file: URI are accepted as dsn,
+// the directory of the file is created if it does not exist yet.
+func Open(ctx context.Context, dsn string) (*DB, error) {
+	if dir := filepath.Dir(dsnPath(dsn)); dir != "." {
+		err := os.MkdirAll(dir, 0777)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// NOTE: sqlite allows a single writer only, sharing one connection
+	// avoids SQLITE_BUSY errors between the observer and the http handlers
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA foreign_keys = ON",
+		"PRAGMA busy_timeout = 5000",
+	} {
+		_, err = db.ExecContext(ctx, pragma)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set %q: %w", pragma, err)
+		}
+	}
+
+	store := &DB{db: db}
+	err = store.migrate(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite database: %w", err)
+	}
+
+	return store, nil
+}
+
+// dsnPath returns the file path of dsn without the file: prefix and the
+// query of a URI, it is empty for in-memory databases.
+func dsnPath(dsn string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	if !strings.HasPrefix(path, "file:") {
+		return path
+	}
+	path = strings.TrimPrefix(path, "file:")
+	if path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return ""
+	}
+	// file:///abs/path has an empty authority
+	return strings.TrimPrefix(path, "//")
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/blacklist"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/internal/storage"
+	"github.com/led0nk/ark-overseer/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTempDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	return dir
+}
+
+func cleanupTempDir(t *testing.T, dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("Failed to remove temp dir: %s", err)
+	}
+}
+
+func openTestDB(t *testing.T, dir string) *DB {
+	db, err := Open(context.Background(), filepath.Join(dir, "overseer.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %s", err)
+	}
+	return db
+}
+
+func TestServerStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Database {
+		db, err := storage.Open(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), "overseer.db"))
+		assert.NoError(t, err)
+		t.Cleanup(func() { db.(*ServerStorage).DB().Close() })
+		return db
+	})
+}
+
+func TestOpenMigratesOnce(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	db := openTestDB(t, dir)
+	assert.NoError(t, db.Close())
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+
+	var version int
+	err := db.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+}
+
+func TestOpenURI(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	path := filepath.Join(dir, "data", "overseer.db")
+	db, err := Open(context.Background(), "file:"+path+"?_pragma=busy_timeout(1000)")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestDSNPath(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"data/ark.db":                           "data/ark.db",
+		"file:data/ark.db?_pragma=foreign_keys": "data/ark.db",
+		"file:///var/lib/ark.db":                "/var/lib/ark.db",
+		"file::memory:?cache=shared":            "",
+		"file:ark?mode=memory&cache=shared":     "",
+	} {
+		assert.Equal(t, want, dsnPath(dsn), dsn)
+	}
+}
+
+func TestServerStorageCRUD(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	db := openTestDB(t, dir)
+	defer db.Close()
+
+	var store storage.Database = NewServerStorage(db)
+
+	server := &model.Server{
+		ID:   uuid.MustParse("64dfb157-37b8-41de-b24d-14f304e15402"),
+		Name: "test server",
+		Addr: "127.0.0.1:27015",
+	}
+	server.ServerInfo = &model.ServerInfo{Name: "Island", MaxPlayers: 70}
+
+	_, err := store.Create(ctx, server)
+	assert.NoError(t, err)
+
+	retrieved, err := store.GetByID(ctx, server.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, server.Name, retrieved.Name)
+	assert.Nil(t, retrieved.ServerInfo)
+
+	server.Name = "updated server"
+	err = store.Update(ctx, server)
+	assert.NoError(t, err)
+
+	retrieved, err = store.GetByName(ctx, "updated server")
+	assert.NoError(t, err)
+	assert.Equal(t, server.ID, retrieved.ID)
+
+	err = store.Update(ctx, &model.Server{ID: uuid.New(), Name: "ghost server"})
+	assert.Error(t, err)
+
+	list, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	err = store.Delete(ctx, server.ID)
+	assert.NoError(t, err)
+
+	retrieved, err = store.GetByID(ctx, server.ID)
+	assert.Error(t, err)
+	assert.Nil(t, retrieved)
+
+	err = store.Delete(ctx, server.ID)
+	assert.Error(t, err)
+}
+
+func TestBlacklistCRUD(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	db := openTestDB(t, dir)
+	defer db.Close()
+
+	var bl blacklist.Blacklister = NewBlacklist(db)
+
+	player, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}})
+	assert.NoError(t, err)
+	assert.Equal(t, blacklist.DefaultList, player.List)
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "123"})
+	assert.ErrorIs(t, err, blacklist.ErrDuplicate)
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{ID: player.ID, Name: "Other", List: "friends"})
+	assert.ErrorIs(t, err, blacklist.ErrDuplicate)
+
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{})
+	assert.ErrorIs(t, err, blacklist.ErrEmptyName)
+
+	player.Name = "Renamed"
+	player.SteamIDs = []string{"76561198000000000"}
+	err = bl.Update(ctx, player)
+	assert.NoError(t, err)
+
+	retrieved, err := bl.GetByID(ctx, player.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", retrieved.Name)
+	assert.Equal(t, []string{"123"}, retrieved.Aliases)
+	assert.Equal(t, []string{"76561198000000000"}, retrieved.SteamIDs)
+
+	assert.Len(t, bl.List(ctx), 1)
+
+	unknownID := uuid.MustParse("0b0f6a3e-1d6b-4a53-9a0f-2b8e3f7a9c11")
+	_, err = bl.GetByID(ctx, unknownID)
+	assert.ErrorIs(t, err, blacklist.ErrNotFound)
+	err = bl.Update(ctx, &model.BlacklistPlayers{ID: unknownID, Name: "Ghost"})
+	assert.ErrorIs(t, err, blacklist.ErrNotFound)
+	err = bl.Delete(ctx, unknownID)
+	assert.ErrorIs(t, err, blacklist.ErrNotFound)
+
+	err = bl.Delete(ctx, player.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, bl.List(ctx))
+}
+
+func TestBlacklistRecordSighting(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	db := openTestDB(t, dir)
+	defer db.Close()
+
+	bl := NewBlacklist(db)
+
+	person, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}})
+	assert.NoError(t, err)
+
+	joined := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	left := joined.Add(time.Hour)
+
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "123", Server: "Island", Joined: joined})
+	assert.NoError(t, err)
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "123", Server: "Island", Left: left})
+	assert.NoError(t, err)
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "Griefer", Server: "Ragnarok", Joined: left})
+	assert.NoError(t, err)
+
+	err = bl.RecordSighting(ctx, uuid.New(), model.Sighting{Alias: "123"})
+	assert.ErrorIs(t, err, blacklist.ErrNotFound)
+
+	retrieved, err := bl.GetByID(ctx, person.ID)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved.Sightings, 2)
+	assert.True(t, joined.Equal(retrieved.Sightings[0].Joined))
+	assert.True(t, left.Equal(retrieved.Sightings[0].Left))
+	assert.Equal(t, "Ragnarok", retrieved.Sightings[1].Server)
+	assert.True(t, retrieved.Sightings[1].Left.IsZero())
+}
+
+func TestBlacklistEdit(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	db := openTestDB(t, dir)
+	defer db.Close()
+
+	bl := NewBlacklist(db)
+
+	person, err := bl.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}, Score: 5})
+	assert.NoError(t, err)
+	_, err = bl.Create(ctx, &model.BlacklistPlayers{Name: "Raider"})
+	assert.NoError(t, err)
+
+	// recorded after the edit form was loaded
+	joined := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	err = bl.RecordSighting(ctx, person.ID, model.Sighting{Alias: "123", Server: "Island", Joined: joined})
+	assert.NoError(t, err)
+
+	edited, err := bl.Edit(ctx, &model.BlacklistPlayers{ID: person.ID, Name: "Renamed", List: "enemies", Aliases: []string{"456"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", edited.Name)
+	assert.Equal(t, "enemies", edited.List)
+	assert.Equal(t, []string{"456"}, edited.Aliases)
+	assert.Equal(t, 5, edited.Score)
+	assert.Len(t, edited.Sightings, 1)
+	assert.True(t, joined.Equal(edited.Sightings[0].Joined))
+
+	_, err = bl.Edit(ctx, &model.BlacklistPlayers{ID: person.ID, Name: "Raider"})
+	assert.ErrorIs(t, err, blacklist.ErrDuplicate)
+	_, err = bl.Edit(ctx, &model.BlacklistPlayers{ID: uuid.New(), Name: "Ghost"})
+	assert.ErrorIs(t, err, blacklist.ErrNotFound)
+}
+
+func TestImportJSON(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	clusterFile := filepath.Join(dir, "cluster.json")
+	blacklistFile := filepath.Join(dir, "blacklist.json")
+
+	fileStore, err := storage.NewServerStorage(ctx, clusterFile)
+	assert.NoError(t, err)
+	_, err = fileStore.Create(ctx, &model.Server{Name: "Island", Addr: "127.0.0.1:27015"})
+	assert.NoError(t, err)
+
+	fileBlacklist, err := blacklist.NewBlacklist(blacklistFile)
+	assert.NoError(t, err)
+	_, err = fileBlacklist.Create(ctx, &model.BlacklistPlayers{Name: "Griefer", Aliases: []string{"123"}})
+	assert.NoError(t, err)
+
+	db := openTestDB(t, dir)
+	defer db.Close()
+
+	imported, err := db.ImportJSON(ctx, clusterFile, blacklistFile)
+	assert.NoError(t, err)
+	assert.True(t, imported)
+
+	servers, err := NewServerStorage(db).List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, servers, 1)
+	assert.Equal(t, "Island", servers[0].Name)
+
+	players := NewBlacklist(db).List(ctx)
+	assert.Len(t, players, 1)
+	assert.Equal(t, []string{"123"}, players[0].Aliases)
+
+	imported, err = db.ImportJSON(ctx, clusterFile, blacklistFile)
+	assert.NoError(t, err)
+	assert.False(t, imported)
+
+	players = NewBlacklist(db).List(ctx)
+	assert.Len(t, players, 1)
+}
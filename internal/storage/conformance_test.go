@@ -0,0 +1,44 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/led0nk/ark-overseer/internal/storage"
+	"github.com/led0nk/ark-overseer/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConformance(t *testing.T) {
+	drivers := map[string]func(t *testing.T) string{
+		"file":   func(t *testing.T) string { return "file://" + t.TempDir() },
+		"path":   func(t *testing.T) string { return t.TempDir() },
+		"memory": func(t *testing.T) string { return "memory://" },
+	}
+
+	for name, url := range drivers {
+		t.Run(name, func(t *testing.T) {
+			storagetest.Run(t, func(t *testing.T) storage.Database {
+				db, err := storage.Open(context.Background(), url(t))
+				assert.NoError(t, err)
+				return db
+			})
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := storage.Open(ctx, "mongodb://localhost")
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	db, err := storage.Open(ctx, "file://"+dir)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.ServerStorage{}, db)
+	assert.FileExists(t, filepath.Join(dir, "cluster.json"))
+
+	assert.Equal(t, []string{"file", "memory"}, storage.Drivers())
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Driver opens a Database from a URL whose scheme it was registered for.
+type Driver func(ctx context.Context, u *url.URL) (Database, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+func init() {
+	Register("file", openFile)
+	Register("memory", openMemory)
+}
+
+// Register makes a driver available under the URL scheme. It panics if
+// driver is nil or the scheme is already taken.
+func Register(scheme string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		panic("storage: Register driver is nil")
+	}
+	if _, exists := drivers[scheme]; exists {
+		panic("storage: Register called twice for scheme " + scheme)
+	}
+	drivers[scheme] = driver
+}
+
+// Drivers returns the sorted schemes of all registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	schemes := make([]string, 0, len(drivers))
+	for scheme := range drivers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open opens the Database described by rawURL, e.g. file:///etc/ark-overseer,
+// memory:// or sqlite:///etc/ark-overseer/overseer.db. A plain path without a
+// scheme is treated as a file URL.
+func Open(ctx context.Context, rawURL string) (Database, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	driversMu.RLock()
+	driver, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage driver %q (available: %s)", u.Scheme, strings.Join(Drivers(), ", "))
+	}
+	return driver(ctx, u)
+}
+
+// ParseURL parses a storage URL. A plain path without a scheme becomes a
+// file URL.
+func ParseURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		return &url.URL{Scheme: "file", Path: rawURL}, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage url: %w", err)
+	}
+	return u, nil
+}
+
+// Path returns the file system path of a storage URL. Relative paths such as
+// file://testdata are parsed as host by net/url and joined back here.
+func Path(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Host + u.Path
+}
+
+func openFile(ctx context.Context, u *url.URL) (Database, error) {
+	dir := Path(u)
+	if dir == "" {
+		return nil, errors.New("file storage requires a directory, e.g. file:///etc/ark-overseer")
+	}
+	return NewServerStorage(ctx, filepath.Join(dir, "cluster.json"))
+}
+
+func openMemory(ctx context.Context, u *url.URL) (Database, error) {
+	return NewMemoryStorage(), nil
+}
@@ -2,21 +2,48 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
+	"github.com/led0nk/ark-overseer/pkg/schema"
 	"go.opentelemetry.io/otel"
 )
 
 var tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/internal/storage")
 
+// Schema holds the on-disk versions of cluster.json.
+var Schema = schema.NewRegistry(
+	"cluster.json",
+	schema.JSON,
+	schema.Migration{
+		From:        0,
+		Description: "wrap the servers into a versioned envelope",
+		Apply:       func(data any) (any, error) { return data, nil },
+	},
+	schema.Migration{
+		From:        1,
+		Description: "drop scraped state, it is no longer persisted",
+		Apply:       dropServerState,
+	},
+)
+
+var (
+	// ErrNotFound is returned by every Database if the requested server
+	// does not exist.
+	ErrNotFound = errors.New("server not found")
+	// ErrDuplicate is returned by every Database on Create if a server with
+	// the same ID already exists.
+	ErrDuplicate = errors.New("server already exists")
+)
+
 type Database interface {
 	Create(context.Context, *model.Server) (*model.Server, error)
 	List(context.Context) ([]*model.Server, error)
@@ -27,12 +54,36 @@ type Database interface {
 	Save() error
 }
 
+// Watcher streams changes of servers. Watch sends the current server first
+// and then every change of it, the channel is closed once the server is
+// deleted or ctx is done. WatchAll reports changes of all servers.
+type Watcher interface {
+	Watch(context.Context, uuid.UUID) (<-chan *model.Server, error)
+	WatchAll(context.Context) <-chan Change
+}
+
+// Change describes a changed server. Server is nil if it was deleted.
+type Change struct {
+	ID     uuid.UUID
+	Server *model.Server
+}
+
+// definition is the persisted part of a server, its live state is never
+// written to disk.
+type definition struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Addr string    `json:"addr"`
+}
+
 type ServerStorage struct {
 	filename string
 	server   map[uuid.UUID]*model.Server
 	mu       sync.Mutex
 }
 
+// NewServerStorage loads the server definitions from filename. Changes are
+// written back immediately, scraped state is never stored here.
 func NewServerStorage(ctx context.Context, filename string) (*ServerStorage, error) {
 	store := &ServerStorage{
 		filename: filename,
@@ -42,57 +93,112 @@ func NewServerStorage(ctx context.Context, filename string) (*ServerStorage, err
 		return nil, err
 	}
 
-	go store.autoSave(ctx)
-
 	return store, nil
 }
 
+// NewMemoryStorage returns a ServerStorage that is never written to disk,
+// for demos and ephemeral containers.
+func NewMemoryStorage() *ServerStorage {
+	return &ServerStorage{
+		server: make(map[uuid.UUID]*model.Server),
+	}
+}
+
 func (s *ServerStorage) Save() error {
-	as_json, err := json.MarshalIndent(s.server, "", "\t")
-	if err != nil {
-		return err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save()
+}
+
+// save writes the storage to disk. The caller must hold s.mu.
+func (s *ServerStorage) save() error {
+	if s.filename == "" {
+		return nil
+	}
+
+	definitions := make(map[uuid.UUID]definition, len(s.server))
+	for id, server := range s.server {
+		definitions[id] = definition{ID: server.ID, Name: server.Name, Addr: server.Addr}
 	}
 
-	err = os.WriteFile(s.filename, as_json, 0644)
+	as_json, err := Schema.Encode(definitions)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-func (s *ServerStorage) autoSave(ctx context.Context) {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			err := s.Save()
-			if err != nil {
-				return
-			}
-		}
-	}
+	return atomicfile.WriteFile(s.filename, as_json, 0644, atomicfile.DefaultBackups)
 }
 
 func (s *ServerStorage) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if _, err := os.Stat(s.filename); os.IsNotExist(err) {
 		err = os.MkdirAll(filepath.Dir(s.filename), 0777)
 		if err != nil {
 			return err
 		}
-		err = s.Save()
+		backups, err := atomicfile.Backups(s.filename)
 		if err != nil {
 			return err
 		}
+		if len(backups) == 0 {
+			err = s.save()
+			if err != nil {
+				return err
+			}
+		}
 	}
-	data, err := os.ReadFile(s.filename)
+
+	var version int
+	recovered, err := atomicfile.ReadFile(s.filename, func(data []byte) error {
+		server := make(map[uuid.UUID]*model.Server)
+		v, err := Schema.Decode(data, &server)
+		if err != nil {
+			return err
+		}
+		s.server = server
+		version = v
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, &s.server)
+	if recovered != "" {
+		slog.Default().Warn("recovered server storage from backup", "file", s.filename, "backup", recovered)
+	}
+
+	if version < Schema.Version() {
+		err = schema.Backup(s.filename, version)
+		if err != nil {
+			return err
+		}
+		slog.Default().Info("migrating server storage", "file", s.filename, "from", version, "to", Schema.Version())
+		return s.save()
+	}
+	return nil
+}
+
+func dropServerState(data any) (any, error) {
+	if data == nil {
+		return data, nil
+	}
+
+	servers, ok := data.(map[string]any)
+	if !ok {
+		return nil, errors.New("servers are not an object")
+	}
+	for _, entry := range servers {
+		server, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"status", "latency", "serverinfo", "playersinfo"} {
+			delete(server, key)
+		}
+	}
+	return servers, nil
 }
 
 func (s *ServerStorage) Create(ctx context.Context, server *model.Server) (*model.Server, error) {
@@ -108,13 +214,17 @@ func (s *ServerStorage) Create(ctx context.Context, server *model.Server) (*mode
 	if server.ID == uuid.Nil {
 		server.ID = uuid.New()
 	}
+	if _, exists := s.server[server.ID]; exists {
+		return nil, fmt.Errorf("%w: id %s is taken", ErrDuplicate, server.ID)
+	}
 
-	s.server[server.ID] = server
-	if err := s.Save(); err != nil {
+	definition := server.Definition()
+	s.server[server.ID] = definition
+	if err := s.save(); err != nil {
 		return nil, err
 	}
 
-	return server, nil
+	return definition, nil
 }
 
 func (s *ServerStorage) Update(ctx context.Context, server *model.Server) error {
@@ -131,8 +241,11 @@ func (s *ServerStorage) Update(ctx context.Context, server *model.Server) error
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		s.server[server.ID] = server
-		return nil
+		if _, exists := s.server[server.ID]; !exists {
+			return ErrNotFound
+		}
+		s.server[server.ID] = server.Definition()
+		return s.save()
 	}
 }
 
@@ -150,13 +263,12 @@ func (s *ServerStorage) GetByName(ctx context.Context, name string) (*model.Serv
 		return nil, errors.New("empty name")
 	}
 
-	fetchedServer := &model.Server{}
 	for _, server := range s.server {
 		if server.Name == name {
-			fetchedServer = server
+			return server, nil
 		}
 	}
-	return fetchedServer, nil
+	return nil, ErrNotFound
 }
 
 func (s *ServerStorage) GetByID(ctx context.Context, id uuid.UUID) (*model.Server, error) {
@@ -178,7 +290,7 @@ func (s *ServerStorage) GetByID(ctx context.Context, id uuid.UUID) (*model.Serve
 			return server, nil
 		}
 	}
-	return nil, errors.New("server not found")
+	return nil, ErrNotFound
 }
 
 func (s *ServerStorage) Delete(ctx context.Context, ID uuid.UUID) error {
@@ -196,12 +308,12 @@ func (s *ServerStorage) Delete(ctx context.Context, ID uuid.UUID) error {
 	}
 
 	if _, exists := s.server[ID]; !exists {
-		return errors.New("server doesn't exist")
+		return ErrNotFound
 	}
 
 	delete(s.server, ID)
 
-	return nil
+	return s.save()
 }
 
 func (s *ServerStorage) List(ctx context.Context) ([]*model.Server, error) {
@@ -119,3 +119,75 @@ func TestServerStorageCRUD(t *testing.T) {
 		})
 	}
 }
+
+func TestServerStorageRecoversFromBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+	storage, err := NewServerStorage(ctx, filename)
+	assert.NoError(t, err)
+
+	server := &model.Server{
+		ID:   uuid.MustParse("64dfb157-37b8-41de-b24d-14f304e15402"),
+		Name: "test server",
+		Addr: "127.0.0.1:27015",
+	}
+	_, err = storage.Create(ctx, server)
+	assert.NoError(t, err)
+
+	_, err = storage.Create(ctx, &model.Server{Name: "second server", Addr: "127.0.0.1:27016"})
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filename, []byte(`{"64dfb157-`), 0644)
+	assert.NoError(t, err)
+
+	recovered, err := NewServerStorage(ctx, filename)
+	assert.NoError(t, err)
+
+	retrieved, err := recovered.GetByID(ctx, server.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, server.Name, retrieved.Name)
+}
+
+func TestServerStorageDropsScrapedState(t *testing.T) {
+	ctx := context.Background()
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+	legacy := `{"64dfb157-37b8-41de-b24d-14f304e15402": {
+		"id": "64dfb157-37b8-41de-b24d-14f304e15402",
+		"name": "test server",
+		"addr": "127.0.0.1:27015",
+		"status": true,
+		"serverinfo": {"name": "Island", "maxplayers": 70}
+	}}`
+	err := os.WriteFile(filename, []byte(legacy), 0644)
+	assert.NoError(t, err)
+
+	storage, err := NewServerStorage(ctx, filename)
+	assert.NoError(t, err)
+
+	raw, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "serverinfo")
+
+	server, err := storage.GetByID(ctx, uuid.MustParse("64dfb157-37b8-41de-b24d-14f304e15402"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test server", server.Name)
+
+	server = server.Definition()
+	server.ServerInfo = &model.ServerInfo{Name: "Island"}
+	err = storage.Update(ctx, server)
+	assert.NoError(t, err)
+
+	raw, err = os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "serverinfo")
+	assert.NotContains(t, string(raw), "status")
+
+	err = storage.Update(ctx, &model.Server{ID: uuid.New(), Name: "ghost server"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+// Package storagetest provides a conformance suite that every
+// storage.Database implementation has to pass.
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run runs the conformance suite. open is called once per subtest and must
+// return an empty Database.
+func Run(t *testing.T, open func(t *testing.T) storage.Database) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db storage.Database)
+	}{
+		{"Create", testCreate},
+		{"GetByID", testGetByID},
+		{"GetByName", testGetByName},
+		{"List", testList},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"DefinitionOnly", testDefinitionOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+func create(t *testing.T, db storage.Database, name string) *model.Server {
+	server, err := db.Create(context.Background(), &model.Server{Name: name, Addr: "127.0.0.1:27015"})
+	if err != nil {
+		t.Fatalf("failed to create %q: %s", name, err)
+	}
+	return server
+}
+
+func testCreate(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+
+	generated := &model.Server{Name: "generated id", Addr: "127.0.0.1:27015"}
+	server, err := db.Create(ctx, generated)
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, server.ID)
+	assert.Equal(t, server.ID, generated.ID, "the new id is set on the given server")
+
+	id := uuid.MustParse("64dfb157-37b8-41de-b24d-14f304e15402")
+	server, err = db.Create(ctx, &model.Server{ID: id, Name: "given id", Addr: "127.0.0.1:27016"})
+	assert.NoError(t, err)
+	assert.Equal(t, id, server.ID)
+	assert.Equal(t, "given id", server.Name)
+	assert.Equal(t, "127.0.0.1:27016", server.Addr)
+
+	_, err = db.Create(ctx, &model.Server{ID: id, Name: "same id", Addr: "127.0.0.1:27017"})
+	assert.ErrorIs(t, err, storage.ErrDuplicate)
+	retrieved, err := db.GetByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "given id", retrieved.Name, "an existing server is never overwritten")
+	assert.NoError(t, db.Save())
+}
+
+func testGetByID(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+	server := create(t, db, "test server")
+
+	retrieved, err := db.GetByID(ctx, server.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, server.ID, retrieved.ID)
+	assert.Equal(t, "test server", retrieved.Name)
+
+	retrieved, err = db.GetByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Nil(t, retrieved)
+
+	_, err = db.GetByID(ctx, uuid.Nil)
+	assert.Error(t, err)
+}
+
+func testGetByName(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+	server := create(t, db, "test server")
+
+	retrieved, err := db.GetByName(ctx, "test server")
+	assert.NoError(t, err)
+	assert.Equal(t, server.ID, retrieved.ID)
+
+	retrieved, err = db.GetByName(ctx, "unknown server")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Nil(t, retrieved)
+
+	_, err = db.GetByName(ctx, "")
+	assert.Error(t, err)
+}
+
+func testList(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+
+	list, err := db.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	create(t, db, "b server")
+	create(t, db, "c server")
+	create(t, db, "a server")
+
+	list, err = db.List(ctx)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(list))
+	for _, server := range list {
+		names = append(names, server.Name)
+	}
+	assert.Equal(t, []string{"a server", "b server", "c server"}, names)
+}
+
+func testUpdate(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+	server := create(t, db, "test server")
+
+	err := db.Update(ctx, &model.Server{ID: server.ID, Name: "updated server", Addr: "127.0.0.1:27020"})
+	assert.NoError(t, err)
+
+	retrieved, err := db.GetByID(ctx, server.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "updated server", retrieved.Name)
+	assert.Equal(t, "127.0.0.1:27020", retrieved.Addr)
+
+	_, err = db.GetByName(ctx, "test server")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	err = db.Update(ctx, &model.Server{ID: uuid.New(), Name: "ghost server"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	list, err := db.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1, "updating an unknown server must not create it")
+}
+
+func testDelete(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+	server := create(t, db, "test server")
+
+	err := db.Delete(ctx, server.ID)
+	assert.NoError(t, err)
+
+	_, err = db.GetByID(ctx, server.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	err = db.Delete(ctx, server.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	err = db.Delete(ctx, uuid.Nil)
+	assert.Error(t, err)
+}
+
+func testDefinitionOnly(t *testing.T, db storage.Database) {
+	ctx := context.Background()
+
+	server := &model.Server{Name: "test server", Addr: "127.0.0.1:27015"}
+	server.Status = true
+	server.ServerInfo = &model.ServerInfo{Name: "Island", MaxPlayers: 70}
+	created, err := db.Create(ctx, server)
+	assert.NoError(t, err)
+
+	retrieved, err := db.GetByID(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.False(t, retrieved.Status)
+	assert.Nil(t, retrieved.ServerInfo)
+}
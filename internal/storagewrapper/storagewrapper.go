@@ -2,56 +2,274 @@ package storagewrapper
 
 import (
 	"context"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/livestate"
 	"github.com/led0nk/ark-overseer/internal/model"
 	"github.com/led0nk/ark-overseer/internal/storage"
 	"github.com/led0nk/ark-overseer/pkg/events"
 )
 
+const (
+	// watchBuffer is the number of pending changes per Watch channel. A
+	// slow reader only misses intermediate states, never the latest one.
+	watchBuffer = 1
+	// watchAllBuffer is the number of pending changes per WatchAll channel.
+	watchAllBuffer = 16
+)
+
+// StorageWrapper publishes changes of the server definitions and serves a
+// combined view of each definition and its live state. Servers returned by
+// it are copies, so readers never share memory with the stores. It also
+// implements livestate.Store and storage.Watcher, so changes of the scraped
+// state reach watchers without polling.
 type StorageWrapper struct {
-	store storage.Database
-	em    *events.EventManager
+	store    storage.Database
+	states   livestate.Store
+	em       *events.EventManager
+	watchers map[*watcher]struct{}
+	statuses map[uuid.UUID]bool
+	mu       sync.Mutex
+}
+
+type watcher struct {
+	id uuid.UUID
+	ch chan storage.Change
 }
 
 func NewStorageWrapper(
 	s storage.Database,
+	states livestate.Store,
 	eventManager *events.EventManager,
 ) *StorageWrapper {
 	return &StorageWrapper{
-		store: s,
-		em:    eventManager,
+		store:    s,
+		states:   states,
+		em:       eventManager,
+		watchers: make(map[*watcher]struct{}),
+		statuses: make(map[uuid.UUID]bool),
 	}
 }
 
 func (n *StorageWrapper) Create(ctx context.Context, srv *model.Server) (*model.Server, error) {
 	newServer, err := n.store.Create(ctx, srv)
-	n.em.Publish(events.EventMessage{Type: "server.added", Payload: newServer})
-	return newServer, err
+	if err != nil {
+		return nil, err
+	}
+	n.em.Publish(ctx, events.ServerAdded{Server: newServer})
+	n.notify(storage.Change{ID: newServer.ID, Server: n.combine(ctx, newServer)})
+	return newServer, nil
 }
 
 func (n *StorageWrapper) Delete(ctx context.Context, id uuid.UUID) error {
-	n.em.Publish(events.EventMessage{Type: "server.deleted", Payload: id})
 	err := n.store.Delete(ctx, id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	n.em.Publish(ctx, events.ServerDeleted{ServerID: id})
+	n.states.DeleteState(ctx, id)
+	n.forgetStatus(id)
+	n.notify(storage.Change{ID: id})
+	return nil
 }
 
 func (n *StorageWrapper) GetByID(ctx context.Context, id uuid.UUID) (*model.Server, error) {
-	return n.store.GetByID(ctx, id)
+	server, err := n.store.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return n.combine(ctx, server), nil
 }
 
 func (n *StorageWrapper) GetByName(ctx context.Context, name string) (*model.Server, error) {
-	return n.store.GetByName(ctx, name)
+	server, err := n.store.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return n.combine(ctx, server), nil
 }
 
 func (n *StorageWrapper) List(ctx context.Context) ([]*model.Server, error) {
-	return n.store.List(ctx)
+	servers, err := n.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	combined := make([]*model.Server, 0, len(servers))
+	for _, server := range servers {
+		combined = append(combined, n.combine(ctx, server))
+	}
+	return combined, nil
 }
 
+// Update changes the definition of a server. The live state is owned by
+// the observer and left untouched.
 func (n *StorageWrapper) Update(ctx context.Context, srv *model.Server) error {
-	return n.store.Update(ctx, srv)
+	err := n.store.Update(ctx, srv.Definition())
+	if err != nil {
+		return err
+	}
+
+	server, err := n.GetByID(ctx, srv.ID)
+	if err != nil {
+		return err
+	}
+	n.notify(storage.Change{ID: server.ID, Server: server})
+	return nil
 }
 
 func (n *StorageWrapper) Save() error {
 	return n.store.Save()
 }
+
+func (n *StorageWrapper) combine(ctx context.Context, server *model.Server) *model.Server {
+	combined := server.Definition()
+	if state, ok := n.states.GetState(ctx, server.ID); ok {
+		// the state is shared with the observer and the event subscribers
+		combined.ServerState = state.Clone()
+	}
+	return combined
+}
+
+func (n *StorageWrapper) GetState(ctx context.Context, id uuid.UUID) (model.ServerState, bool) {
+	state, ok := n.states.GetState(ctx, id)
+	return state.Clone(), ok
+}
+
+// SeedStatus sets the status that was last published for a server, e.g.
+// before a restart as found in the event journal.
+func (n *StorageWrapper) SeedStatus(id uuid.UUID, online bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.statuses[id] = online
+}
+
+// SetState stores the scraped state of a server and notifies the watchers
+// if it differs from the previous one. A status differing from the last
+// published or seeded one is published as ServerStatusChanged. The first
+// status of a server without either is only recorded, so a restart does not
+// announce every server again.
+func (n *StorageWrapper) SetState(ctx context.Context, id uuid.UUID, state model.ServerState) {
+	previous, ok := n.states.GetState(ctx, id)
+	n.states.SetState(ctx, id, state)
+	if ok && previous.SameAs(state) {
+		return
+	}
+
+	server, err := n.store.GetByID(ctx, id)
+	if err != nil {
+		return
+	}
+	n.notify(storage.Change{ID: id, Server: n.combine(ctx, server)})
+
+	if n.statusChanged(id, state.Status) {
+		// the subscribers get a copy of their own, apart from the watchers
+		n.em.Publish(ctx, events.ServerStatusChanged{Server: n.combine(ctx, server), Online: state.Status})
+	}
+}
+
+func (n *StorageWrapper) forgetStatus(id uuid.UUID) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.statuses, id)
+}
+
+// statusChanged records the status of a server and reports whether it
+// differs from a known previous one.
+func (n *StorageWrapper) statusChanged(id uuid.UUID, online bool) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	previous, known := n.statuses[id]
+	n.statuses[id] = online
+	return known && previous != online
+}
+
+func (n *StorageWrapper) DeleteState(ctx context.Context, id uuid.UUID) {
+	n.states.DeleteState(ctx, id)
+}
+
+func (n *StorageWrapper) Watch(ctx context.Context, id uuid.UUID) (<-chan *model.Server, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	changes := n.watch(ctx, id, watchBuffer)
+
+	server, err := n.GetByID(ctx, id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan *model.Server, 1)
+	out <- server
+	go func() {
+		defer cancel()
+		defer close(out)
+		for change := range changes {
+			if change.Server == nil {
+				return
+			}
+			select {
+			case out <- change.Server:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (n *StorageWrapper) WatchAll(ctx context.Context) <-chan storage.Change {
+	return n.watch(ctx, uuid.Nil, watchAllBuffer)
+}
+
+func (n *StorageWrapper) watch(ctx context.Context, id uuid.UUID, buffer int) <-chan storage.Change {
+	w := &watcher{id: id, ch: make(chan storage.Change, buffer)}
+
+	n.mu.Lock()
+	n.watchers[w] = struct{}{}
+	n.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if _, ok := n.watchers[w]; ok {
+			delete(n.watchers, w)
+			close(w.ch)
+		}
+	}()
+	return w.ch
+}
+
+// notify hands a change to every matching watcher without blocking. If a
+// watcher is full, its oldest pending change is dropped in favour of the
+// new one. Watchers of a single server are closed after its deletion.
+func (n *StorageWrapper) notify(change storage.Change) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for w := range n.watchers {
+		if w.id != uuid.Nil && w.id != change.ID {
+			continue
+		}
+		for sent := false; !sent; {
+			select {
+			case w.ch <- change:
+				sent = true
+			default:
+				select {
+				case <-w.ch:
+				default:
+				}
+			}
+		}
+		if w.id != uuid.Nil && change.Server == nil {
+			delete(n.watchers, w)
+			close(w.ch)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package storagewrapper
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/livestate"
+	"github.com/led0nk/ark-overseer/internal/model"
+	"github.com/led0nk/ark-overseer/internal/storage"
+	"github.com/led0nk/ark-overseer/internal/storage/storagetest"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWrapper(t *testing.T) *StorageWrapper {
+	store, err := storage.NewServerStorage(context.Background(), filepath.Join(t.TempDir(), "cluster.json"))
+	assert.NoError(t, err)
+	return NewStorageWrapper(store, livestate.NewMemoryStore(), events.NewEventManager())
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Database {
+		return NewStorageWrapper(storage.NewMemoryStorage(), livestate.NewMemoryStore(), events.NewEventManager())
+	})
+}
+
+func receive[T any](t *testing.T, ch <-chan T) (T, bool) {
+	select {
+	case v, ok := <-ch:
+		return v, ok
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+	var zero T
+	return zero, false
+}
+
+func assertSilent[T any](t *testing.T, ch <-chan T) {
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected change: %v", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func players(names ...string) *model.PlayersInfo {
+	info := &model.PlayersInfo{}
+	for _, name := range names {
+		info.Players = append(info.Players, &model.Players{Name: name, Duration: time.Minute})
+	}
+	return info
+}
+
+func TestWatchOnlyEmitsRealChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wrapper := newTestWrapper(t)
+	server, err := wrapper.Create(ctx, &model.Server{Name: "test server", Addr: "127.0.0.1:27015"})
+	assert.NoError(t, err)
+
+	updates, err := wrapper.Watch(ctx, server.ID)
+	assert.NoError(t, err)
+
+	current, ok := receive(t, updates)
+	assert.True(t, ok)
+	assert.Equal(t, "test server", current.Name)
+	assert.Nil(t, current.ServerInfo)
+
+	state := model.ServerState{Status: true, ServerInfo: &model.ServerInfo{Players: 1}, PlayersInfo: players("Alice")}
+	wrapper.SetState(ctx, server.ID, state)
+	current, _ = receive(t, updates)
+	assert.Equal(t, 1, current.ServerInfo.Players)
+
+	// only the latency and play time differ
+	same := state
+	same.Latency = time.Millisecond
+	same.PlayersInfo = players("Alice")
+	same.PlayersInfo.Players[0].Duration = 2 * time.Minute
+	wrapper.SetState(ctx, server.ID, same)
+	assertSilent(t, updates)
+
+	err = wrapper.Update(ctx, &model.Server{ID: server.ID, Name: "renamed server", Addr: server.Addr})
+	assert.NoError(t, err)
+	current, _ = receive(t, updates)
+	assert.Equal(t, "renamed server", current.Name)
+	assert.Equal(t, 1, current.ServerInfo.Players, "renaming must keep the live state")
+
+	err = wrapper.Delete(ctx, server.ID)
+	assert.NoError(t, err)
+	_, ok = receive(t, updates)
+	assert.False(t, ok)
+
+	_, err = wrapper.Watch(ctx, server.ID)
+	assert.Error(t, err)
+}
+
+func TestCombineCopiesState(t *testing.T) {
+	ctx := context.Background()
+
+	wrapper := newTestWrapper(t)
+	server, err := wrapper.Create(ctx, &model.Server{Name: "test server", Addr: "127.0.0.1:27015"})
+	assert.NoError(t, err)
+
+	state := model.ServerState{Status: true, ServerInfo: &model.ServerInfo{Players: 1}, PlayersInfo: players("Alice")}
+	wrapper.SetState(ctx, server.ID, state)
+
+	combined, err := wrapper.GetByID(ctx, server.ID)
+	assert.NoError(t, err)
+	combined.ServerInfo.Players = 2
+	combined.PlayersInfo.Players[0].Name = "Bob"
+
+	assert.Equal(t, 1, state.ServerInfo.Players)
+	assert.Equal(t, "Alice", state.PlayersInfo.Players[0].Name)
+	stored, _ := wrapper.GetState(ctx, server.ID)
+	assert.Equal(t, 1, stored.ServerInfo.Players)
+}
+
+func TestWatchAll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wrapper := newTestWrapper(t)
+	changes := wrapper.WatchAll(ctx)
+
+	server, err := wrapper.Create(ctx, &model.Server{Name: "test server", Addr: "127.0.0.1:27015"})
+	assert.NoError(t, err)
+	change, _ := receive(t, changes)
+	assert.Equal(t, server.ID, change.ID)
+	assert.NotNil(t, change.Server)
+
+	wrapper.SetState(ctx, server.ID, model.ServerState{Status: true})
+	change, _ = receive(t, changes)
+	assert.True(t, change.Server.Status)
+
+	err = wrapper.Delete(ctx, server.ID)
+	assert.NoError(t, err)
+	change, _ = receive(t, changes)
+	assert.Equal(t, server.ID, change.ID)
+	assert.Nil(t, change.Server)
+
+	cancel()
+	_, ok := receive(t, changes)
+	assert.False(t, ok)
+}
+
+func TestSetStatePublishesStatusChanges(t *testing.T) {
+	ctx := context.Background()
+
+	em := events.NewEventManager()
+	_, published := em.Subscribe("test", events.WithPolicy(events.Unbounded), events.WithTopics("server.online", "server.offline"))
+	wrapper := NewStorageWrapper(storage.NewMemoryStorage(), livestate.NewMemoryStore(), em)
+
+	fresh, err := wrapper.Create(ctx, &model.Server{Name: "fresh", Addr: "127.0.0.1:27015"})
+	assert.NoError(t, err)
+	wrapper.SetState(ctx, fresh.ID, model.ServerState{Status: true})
+	assertSilent(t, published)
+
+	wrapper.SetState(ctx, fresh.ID, model.ServerState{})
+	event, _ := receive(t, published)
+	assert.Equal(t, "server.offline", event.Type)
+	assert.Equal(t, fresh.ID, event.Payload.(events.ServerStatusChanged).Server.ID)
+
+	// went offline while the application was down
+	seeded, err := wrapper.Create(ctx, &model.Server{Name: "seeded", Addr: "127.0.0.1:27016"})
+	assert.NoError(t, err)
+	wrapper.SeedStatus(seeded.ID, true)
+	wrapper.SetState(ctx, seeded.ID, model.ServerState{})
+	event, _ = receive(t, published)
+	assert.Equal(t, "server.offline", event.Type)
+	assert.Equal(t, seeded.ID, event.Payload.(events.ServerStatusChanged).Server.ID)
+
+	unchanged, err := wrapper.Create(ctx, &model.Server{Name: "unchanged", Addr: "127.0.0.1:27017"})
+	assert.NoError(t, err)
+	wrapper.SeedStatus(unchanged.ID, true)
+	wrapper.SetState(ctx, unchanged.ID, model.ServerState{Status: true})
+	assertSilent(t, published)
+}
+
+func TestDeleteUnknownServer(t *testing.T) {
+	ctx := context.Background()
+
+	em := events.NewEventManager()
+	_, published := em.Subscribe("test", events.WithPolicy(events.Unbounded), events.WithTopics("server.deleted"))
+	wrapper := NewStorageWrapper(storage.NewMemoryStorage(), livestate.NewMemoryStore(), em)
+
+	err := wrapper.Delete(ctx, uuid.New())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assertSilent(t, published)
+
+	server, err := wrapper.Create(ctx, &model.Server{Name: "test server", Addr: "127.0.0.1:27015"})
+	assert.NoError(t, err)
+	err = wrapper.Delete(ctx, server.ID)
+	assert.NoError(t, err)
+	event, _ := receive(t, published)
+	assert.Equal(t, server.ID, event.Payload.(events.ServerDeleted).ServerID)
+}
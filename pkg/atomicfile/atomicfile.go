@@ -0,0 +1,169 @@
+package atomicfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultBackups is the number of backups kept next to every file.
+const DefaultBackups = 5
+
+const (
+	backupSuffix = ".bak"
+	timeLayout   = "20060102T150405.000000000"
+)
+
+// WriteFile replaces filename with data without ever leaving a partially
+// written file behind. The data is written to a temporary file in the same
+// directory, synced to disk and renamed into place. If the content changes,
+// the previous file is kept as a timestamped backup and all but the newest
+// backups are removed.
+func WriteFile(filename string, data []byte, perm os.FileMode, backups int) error {
+	dir := filepath.Dir(filename)
+
+	err := backup(filename, data, backups)
+	if err != nil {
+		return fmt.Errorf("failed to backup %s: %w", filename, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// ReadFile reads filename and hands its content to parse. If the file is
+// missing or parse fails, the backups are tried from newest to oldest. The
+// name of the backup that was used is returned, it is empty if the primary
+// file could be parsed.
+func ReadFile(filename string, parse func([]byte) error) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		err = parse(data)
+		if err == nil {
+			return "", nil
+		}
+	}
+	primaryErr := err
+
+	backups, err := Backups(filename)
+	if err != nil {
+		return "", errors.Join(primaryErr, err)
+	}
+
+	for i := len(backups) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(backups[i])
+		if err != nil {
+			continue
+		}
+		if parse(data) == nil {
+			return backups[i], nil
+		}
+	}
+	return "", primaryErr
+}
+
+// Backups returns the backups of filename sorted from oldest to newest.
+func Backups(filename string) ([]string, error) {
+	backups, err := filepath.Glob(globEscape(filename) + ".*" + backupSuffix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func backup(filename string, data []byte, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	current, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	name := filename + "." + time.Now().UTC().Format(timeLayout) + backupSuffix
+	err = os.WriteFile(name, current, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	backups, err := Backups(filename)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// NOTE: some filesystems don't support syncing directories, the rename
+	// itself already happened at this point
+	_ = d.Sync()
+	return nil
+}
+
+func globEscape(path string) string {
+	var buf bytes.Buffer
+	for _, r := range path {
+		switch r {
+		case '*', '?', '[', '\\':
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
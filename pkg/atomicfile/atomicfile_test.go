@@ -0,0 +1,110 @@
+package atomicfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTempDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "atomicfile_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	return dir
+}
+
+func cleanupTempDir(t *testing.T, dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("Failed to remove temp dir: %s", err)
+	}
+}
+
+func parseJSON(v *map[string]int) func([]byte) error {
+	return func(data []byte) error {
+		parsed := make(map[string]int)
+		err := json.Unmarshal(data, &parsed)
+		if err != nil {
+			return err
+		}
+		*v = parsed
+		return nil
+	}
+}
+
+func TestWriteFileRotatesBackups(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+
+	for i := 0; i < 5; i++ {
+		data, _ := json.Marshal(map[string]int{"version": i})
+		err := WriteFile(filename, data, 0644, 3)
+		assert.NoError(t, err)
+	}
+
+	backups, err := Backups(filename)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 3)
+
+	var newest map[string]int
+	data, err := os.ReadFile(backups[len(backups)-1])
+	assert.NoError(t, err)
+	assert.NoError(t, parseJSON(&newest)(data))
+	assert.Equal(t, 3, newest["version"])
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4, "no temporary files should be left behind")
+}
+
+func TestWriteFileSkipsUnchangedBackup(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+
+	for i := 0; i < 3; i++ {
+		err := WriteFile(filename, []byte(`{"version":1}`), 0644, DefaultBackups)
+		assert.NoError(t, err)
+	}
+
+	backups, err := Backups(filename)
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+}
+
+func TestReadFileRecoversFromBackup(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+
+	assert.NoError(t, WriteFile(filename, []byte(`{"version":1}`), 0644, DefaultBackups))
+	assert.NoError(t, WriteFile(filename, []byte(`{"version":2}`), 0644, DefaultBackups))
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"vers`), 0644))
+
+	var result map[string]int
+	recovered, err := ReadFile(filename, parseJSON(&result))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, recovered)
+	assert.Equal(t, 1, result["version"])
+}
+
+func TestReadFileFailsWithoutValidBackup(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"vers`), 0644))
+
+	var result map[string]int
+	recovered, err := ReadFile(filename, parseJSON(&result))
+	assert.Error(t, err)
+	assert.Empty(t, recovered)
+}
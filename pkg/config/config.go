@@ -1,35 +1,66 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
 	"github.com/led0nk/ark-overseer/pkg/events"
-	"gopkg.in/yaml.v2"
+	"github.com/led0nk/ark-overseer/pkg/schema"
+)
+
+// NotificationSection is the config section of the notification services.
+const NotificationSection = "notification-service"
+
+// Schema holds the on-disk versions of config.yaml.
+var Schema = schema.NewRegistry(
+	"config.yaml",
+	schema.YAML,
+	schema.Migration{
+		From:        0,
+		Description: "wrap the sections into a versioned envelope",
+		Apply:       func(data any) (any, error) { return data, nil },
+	},
+	schema.Migration{
+		From:        1,
+		Description: "turn the notification services into a list of named instances",
+		Apply:       moveIntoInstances,
+	},
 )
 
 type Configuration interface {
 	Load() error
 	Save() error
-	Update(string, string, interface{}) error
+	Update(context.Context, string, string, interface{}) error
+	Modify(context.Context, string, string, func(interface{}) (interface{}, error)) error
+	GetSection(string) (map[interface{}]interface{}, error)
 }
 
+// Config is the yaml configuration. Secret values (see IsSecret) are kept
+// encrypted in memory and on disk and only decrypted by GetSection.
 type Config struct {
 	filename string
 	mu       sync.Mutex
 	config   map[interface{}]interface{}
+	cipher   *Cipher
 	em       *events.EventManager
 }
 
+// NewConfiguration loads the configuration from filename. Without a cipher
+// secrets are stored in plaintext.
 func NewConfiguration(
 	filename string,
+	cipher *Cipher,
 	em *events.EventManager,
 ) (*Config, error) {
 	cfg := &Config{
 		filename: filename,
 		config:   make(map[interface{}]interface{}),
+		cipher:   cipher,
 		em:       em,
 	}
 
@@ -42,6 +73,9 @@ func NewConfiguration(
 }
 
 func (c *Config) Load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	_, err := os.Stat(c.filename)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -49,64 +83,221 @@ func (c *Config) Load() error {
 			if err != nil {
 				return err
 			}
-			c.config["notification-service"] = nil
-			err = c.Save()
+			backups, err := atomicfile.Backups(c.filename)
 			if err != nil {
 				return err
 			}
+			if len(backups) == 0 {
+				c.config[NotificationSection] = nil
+				c.config[MQTTSection] = defaultMQTTSection()
+				err = c.save()
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	var version int
+	recovered, err := atomicfile.ReadFile(c.filename, func(data []byte) error {
+		var config map[interface{}]interface{}
+		v, err := Schema.Decode(data, &config)
+		if err != nil {
+			return err
+		}
+		c.config = config
+		version = v
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if recovered != "" {
+		slog.Default().Warn("recovered config from backup", "file", c.filename, "backup", recovered)
+	}
+
+	if version < Schema.Version() {
+		err = schema.Backup(c.filename, version)
+		if err != nil {
+			return err
+		}
+		slog.Default().Info("migrating config", "file", c.filename, "from", version, "to", Schema.Version())
+		err = c.save()
+		if err != nil {
+			return err
 		}
 	}
 
-	data, err := os.ReadFile(c.filename)
+	return c.sealPlaintext()
+}
+
+// sealPlaintext encrypts secrets that were written to the file in
+// plaintext, e.g. by an older version or by hand. The backups and
+// pre-migration copies still holding the plaintext are removed afterwards.
+// The caller must hold c.mu.
+func (c *Config) sealPlaintext() error {
+	if c.cipher == nil {
+		return nil
+	}
+
+	var sealed int
+	config, err := transform(c.config, func(secret string) (string, error) {
+		if secret == "" || IsEncrypted(secret) {
+			return secret, nil
+		}
+		sealed++
+		return c.cipher.Encrypt(secret)
+	})
 	if err != nil {
 		return err
 	}
+	if sealed == 0 {
+		return nil
+	}
 
-	var config map[interface{}]interface{}
-	err = yaml.Unmarshal(data, &config)
+	c.config = config.(map[interface{}]interface{})
+	err = c.save()
 	if err != nil {
 		return err
 	}
-	c.config = config
 
+	backups, err := atomicfile.Backups(c.filename)
+	if err != nil {
+		return err
+	}
+	for version := 0; version < Schema.Version(); version++ {
+		backups = append(backups, schema.BackupPath(c.filename, version))
+	}
+	for _, backup := range backups {
+		err = os.Remove(backup)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	slog.Default().Info("encrypted plaintext secrets in config", "file", c.filename, "secrets", sealed, "removedBackups", len(backups))
 	return nil
 }
 
+// open returns a copy of value with all secrets decrypted.
+func (c *Config) open(value any) (any, error) {
+	return transform(value, func(secret string) (string, error) {
+		if c.cipher == nil || !IsEncrypted(secret) {
+			return secret, nil
+		}
+		return c.cipher.Decrypt(secret)
+	})
+}
+
+// seal returns a copy of value with all secrets encrypted.
+func (c *Config) seal(value any) (any, error) {
+	return transform(value, func(secret string) (string, error) {
+		if c.cipher == nil || secret == "" || IsEncrypted(secret) {
+			return secret, nil
+		}
+		return c.cipher.Encrypt(secret)
+	})
+}
+
 func (c *Config) Save() error {
-	data, err := yaml.Marshal(c.config)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.save()
+}
+
+// save writes the config to disk. The caller must hold c.mu.
+func (c *Config) save() error {
+	data, err := Schema.Encode(c.config)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(c.filename, data, 0644)
+	return atomicfile.WriteFile(c.filename, data, 0600, atomicfile.DefaultBackups)
+}
+
+func (c *Config) Update(ctx context.Context, section string, key string, value interface{}) error {
+	c.mu.Lock()
+	changed, err := c.set(section, key, value)
+	c.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
+	// subscribers may block Publish, so it must not hold c.mu
+	c.em.Publish(ctx, changed)
 	return nil
 }
 
-func (c *Config) Update(section string, key string, value interface{}) error {
+// Modify replaces the value of key in section by the result of fn, which
+// gets a decrypted copy of the current value, nil if there is none. The
+// config stays locked until the result is saved, so concurrent changes of
+// the same value are not lost. If fn fails, nothing is changed.
+func (c *Config) Modify(
+	ctx context.Context,
+	section string,
+	key string,
+	fn func(interface{}) (interface{}, error),
+) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	var current interface{}
+	if sectionMap, ok := c.config[section].(map[interface{}]interface{}); ok {
+		current = sectionMap[key]
+	}
+	opened, err := c.open(current)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	value, err := fn(opened)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	changed, err := c.set(section, key, value)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
+	c.em.Publish(ctx, changed)
+	return nil
+}
+
+// set stores value under key in section and saves the config. It returns
+// the event announcing the change with a decrypted copy of the section. The
+// caller must hold c.mu.
+func (c *Config) set(section string, key string, value interface{}) (events.ConfigChanged, error) {
 	sectionMap, ok := c.config[section].(map[interface{}]interface{})
 	if !ok {
 		sectionMap = make(map[interface{}]interface{})
 		c.config[section] = sectionMap
 	}
-	sectionMap[key] = value
+	sealed, err := c.seal(map[interface{}]interface{}{key: value})
+	if err != nil {
+		return events.ConfigChanged{}, err
+	}
+	sectionMap[key] = sealed.(map[interface{}]interface{})[key]
 
-	err := c.Save()
+	err = c.save()
 	if err != nil {
-		return err
+		return events.ConfigChanged{}, err
 	}
-	c.em.Publish(events.EventMessage{Type: "config.changed", Payload: sectionMap})
 
-	return nil
+	opened, err := c.open(sectionMap)
+	if err != nil {
+		return events.ConfigChanged{}, err
+	}
+	return events.ConfigChanged{
+		Section: section,
+		Key:     key,
+		Values:  opened.(map[interface{}]interface{}),
+	}, nil
 }
 
 func (c *Config) GetSection(section string) (map[interface{}]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	sectionMap, exists := c.config[section]
 	if !exists {
 		return nil, fmt.Errorf("section %s not found", section)
@@ -117,5 +308,9 @@ func (c *Config) GetSection(section string) (map[interface{}]interface{}, error)
 		return nil, fmt.Errorf("section %s not a valid type", section)
 	}
 
-	return sectionData, nil
+	opened, err := c.open(sectionData)
+	if err != nil {
+		return nil, fmt.Errorf("section %s: %w", section, err)
+	}
+	return opened.(map[interface{}]interface{}), nil
 }
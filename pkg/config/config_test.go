@@ -1,9 +1,13 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/led0nk/ark-overseer/pkg/events"
 	"github.com/stretchr/testify/assert"
@@ -29,7 +33,7 @@ func TestNewConfiguration(t *testing.T) {
 	defer cleanupTempDir(t, dir)
 
 	em := events.NewEventManager()
-	cfg, err := NewConfiguration(filepath.Join(dir, "config.json"), em)
+	cfg, err := NewConfiguration(filepath.Join(dir, "config.json"), nil, em)
 	assert.NoError(t, err)
 	assert.NotNil(t, cfg)
 }
@@ -39,7 +43,7 @@ func TestConfigCRUD(t *testing.T) {
 	defer cleanupTempDir(t, dir)
 
 	em := events.NewEventManager()
-	cfg, err := NewConfiguration(filepath.Join(dir, "config.json"), em)
+	cfg, err := NewConfiguration(filepath.Join(dir, "config.json"), nil, em)
 	assert.NoError(t, err)
 
 	tests := []struct {
@@ -68,7 +72,7 @@ func TestConfigCRUD(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if !tt.expectErr {
-				err := cfg.Update(tt.section, tt.key, tt.value)
+				err := cfg.Update(context.Background(), tt.section, tt.key, tt.value)
 				assert.NoError(t, err)
 
 			}
@@ -89,22 +93,409 @@ func TestSaveAndLoadConfig(t *testing.T) {
 	defer cleanupTempDir(t, dir)
 
 	em := events.NewEventManager()
-	cfg, err := NewConfiguration(filepath.Join(dir, "config.yaml"), em)
+	cfg, err := NewConfiguration(filepath.Join(dir, "config.yaml"), nil, em)
 	assert.NoError(t, err)
 
 	section := "notification-service"
 	key := "discord"
 	value := map[interface{}]interface{}{"token": "123456", "channelID": "abcdef"}
-	err = cfg.Update(section, key, value)
+	err = cfg.Update(context.Background(), section, key, value)
 	assert.NoError(t, err)
 
 	err = cfg.Save()
 	assert.NoError(t, err)
 
-	cfg, err = NewConfiguration(filepath.Join(dir, "config.yaml"), em)
+	cfg, err = NewConfiguration(filepath.Join(dir, "config.yaml"), nil, em)
 	assert.NoError(t, err)
 
 	loadedSection, err := cfg.GetSection(section)
 	assert.NoError(t, err)
 	assert.Equal(t, value, loadedSection[key])
 }
+
+func TestUpdatePublishesWithoutLock(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	em := events.NewEventManager()
+	cfg, err := NewConfiguration(filepath.Join(dir, "config.yaml"), nil, em)
+	assert.NoError(t, err)
+
+	// nobody reads ch, so Publish waits for the timeout of the subscriber
+	_, ch := em.Subscribe("stalled", events.WithPolicy(events.Block), events.WithBufferSize(0), events.WithTimeout(time.Second))
+	assert.NotNil(t, ch)
+
+	updated := make(chan error, 1)
+	go func() {
+		updated <- cfg.Update(context.Background(), "section", "key", "value")
+	}()
+
+	assert.Eventually(t, func() bool {
+		section, err := cfg.GetSection("section")
+		return err == nil && section["key"] == "value"
+	}, 500*time.Millisecond, 5*time.Millisecond, "GetSection blocked by a stalled subscriber")
+	assert.NoError(t, <-updated)
+}
+
+func TestModify(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	cfg, err := NewConfiguration(filepath.Join(dir, "config.yaml"), nil, events.NewEventManager())
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := cfg.Modify(context.Background(), "section", "list", func(value interface{}) (interface{}, error) {
+				list, _ := value.([]interface{})
+				return append(list, i), nil
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	section, err := cfg.GetSection("section")
+	assert.NoError(t, err)
+	assert.Len(t, section["list"], 10, "concurrent changes must not be lost")
+
+	failed := errors.New("failed")
+	err = cfg.Modify(context.Background(), "section", "list", func(interface{}) (interface{}, error) {
+		return nil, failed
+	})
+	assert.ErrorIs(t, err, failed)
+	section, err = cfg.GetSection("section")
+	assert.NoError(t, err)
+	assert.Len(t, section["list"], 10)
+}
+
+func TestParseMQTT(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	cfg, err := NewConfiguration(filepath.Join(dir, "config.yaml"), nil, events.NewEventManager())
+	assert.NoError(t, err)
+
+	section, err := cfg.GetSection(MQTTSection)
+	assert.NoError(t, err)
+	mqtt, err := ParseMQTT(section)
+	assert.NoError(t, err)
+	assert.False(t, mqtt.Enabled, "new configs have mqtt disabled")
+	assert.Equal(t, "ark", mqtt.TopicPrefix)
+
+	mqtt, err = ParseMQTT(map[interface{}]interface{}{
+		"enabled":     true,
+		"broker":      "tcp://broker:1883",
+		"topicPrefix": "home/ark",
+		"qos":         1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, MQTT{
+		Enabled:     true,
+		Broker:      "tcp://broker:1883",
+		ClientID:    "ark-overseer",
+		TopicPrefix: "home/ark",
+		QoS:         1,
+	}, mqtt)
+
+	_, err = ParseMQTT(map[interface{}]interface{}{"enabled": true})
+	assert.ErrorIs(t, err, ErrInvalidMQTT)
+	_, err = ParseMQTT(map[interface{}]interface{}{"qos": 3})
+	assert.ErrorIs(t, err, ErrInvalidMQTT)
+	_, err = ParseMQTT(map[interface{}]interface{}{"broker": 1883})
+	assert.ErrorIs(t, err, ErrInvalidMQTT)
+}
+
+func TestParseWebhook(t *testing.T) {
+	webhook, err := ParseWebhook(map[interface{}]interface{}{
+		"url":     "https://example.com/hook",
+		"secret":  "s3cret",
+		"headers": map[interface{}]interface{}{"X-Source": "ark"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Webhook{
+		URL:     "https://example.com/hook",
+		Secret:  "s3cret",
+		Headers: map[string]string{"X-Source": "ark"},
+		Events:  DefaultWebhookEvents,
+	}, webhook)
+
+	invalid := []interface{}{
+		"https://example.com",
+		map[interface{}]interface{}{"url": "example.com/hook"},
+		map[interface{}]interface{}{"url": "https://example.com", "headers": "X-Source"},
+	}
+	for _, value := range invalid {
+		_, err = ParseWebhook(value)
+		assert.ErrorIs(t, err, ErrInvalidWebhook, "%v", value)
+	}
+}
+
+func TestParseInstances(t *testing.T) {
+	instances, err := ParseInstances(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, instances)
+
+	instances, err = ParseInstances([]interface{}{
+		map[interface{}]interface{}{
+			"name":     "discord-alerts",
+			"type":     "discord",
+			"events":   []interface{}{"player.joined"},
+			"settings": map[interface{}]interface{}{"token": "abc", "channelID": "1"},
+		},
+		map[interface{}]interface{}{"name": "discord-staff", "type": "discord"},
+		map[interface{}]interface{}{"name": "Discord Staff", "type": "discord"},
+		map[interface{}]interface{}{"name": "discord-alerts", "type": "telegram"},
+		map[interface{}]interface{}{"name": "irc", "type": "irc"},
+		map[interface{}]interface{}{"name": "hook", "type": "webhook", "settings": "https://example.com"},
+		"discord",
+		map[interface{}]interface{}{"name": "journal", "type": "webhook"},
+	})
+	assert.Equal(t, []Instance{
+		{
+			Name:     "discord-alerts",
+			Type:     DiscordKey,
+			Events:   []string{"player.joined"},
+			Settings: map[interface{}]interface{}{"token": "abc", "channelID": "1"},
+		},
+		{Name: "discord-staff", Type: DiscordKey, Settings: map[interface{}]interface{}{}},
+	}, instances, "invalid instances are skipped")
+	assert.ErrorIs(t, err, ErrInvalidInstance)
+	for _, index := range []string{"[2]", "[3]", "[4]", "[5]", "[6]", "[7]"} {
+		assert.Contains(t, err.Error(), InstancesKey+index)
+	}
+
+	_, err = ParseInstances(map[interface{}]interface{}{})
+	assert.ErrorIs(t, err, ErrInvalidInstance)
+
+	for _, name := range ReservedNames {
+		assert.ErrorIs(t, CheckInstanceName(name), ErrInvalidInstance, name)
+	}
+}
+
+func TestMigrateIntoInstances(t *testing.T) {
+	old := `version: 1
+data:
+  mqtt:
+    enabled: false
+  notification-service:
+    discord:
+      token: enc:abc
+      channelID: "123"
+    ntfy:
+      url: https://ntfy.sh/ark
+    webhooks:
+      - url: https://example.com/hook
+        events: [player.joined]
+      - url: https://example.com/other
+`
+	var cfg map[interface{}]interface{}
+	version, err := Schema.Decode([]byte(old), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	assert.Equal(t, map[interface{}]interface{}{"enabled": false}, cfg[MQTTSection])
+	section := cfg[NotificationSection].(map[interface{}]interface{})
+	assert.Equal(t, []interface{}{
+		map[interface{}]interface{}{
+			"name":     "discord",
+			"type":     "discord",
+			"settings": map[interface{}]interface{}{"token": "enc:abc", "channelID": "123"},
+		},
+		map[interface{}]interface{}{
+			"name":     "ntfy",
+			"type":     "ntfy",
+			"settings": map[interface{}]interface{}{"url": "https://ntfy.sh/ark"},
+		},
+		map[interface{}]interface{}{
+			"name":     "webhook",
+			"type":     "webhook",
+			"events":   []interface{}{"player.joined"},
+			"settings": map[interface{}]interface{}{"url": "https://example.com/hook"},
+		},
+		map[interface{}]interface{}{
+			"name":     "webhook-2",
+			"type":     "webhook",
+			"settings": map[interface{}]interface{}{"url": "https://example.com/other"},
+		},
+	}, section[InstancesKey])
+	assert.Len(t, section, 1)
+
+	instances, err := ParseInstances(section[InstancesKey])
+	assert.NoError(t, err)
+	assert.Len(t, instances, 4)
+}
+
+func TestParseTelegram(t *testing.T) {
+	telegram, err := ParseTelegram(map[interface{}]interface{}{
+		"token":  "123:abc",
+		"chatID": -1001234,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Telegram{Token: "123:abc", ChatID: "-1001234", APIURL: DefaultTelegramAPI}, telegram)
+
+	telegram, err = ParseTelegram(map[interface{}]interface{}{
+		"token":  "123:abc",
+		"chatID": "@ark_alerts",
+		"apiURL": "http://localhost:8081",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "@ark_alerts", telegram.ChatID)
+	assert.Equal(t, "http://localhost:8081", telegram.APIURL)
+
+	_, err = ParseTelegram(nil)
+	assert.ErrorIs(t, err, ErrInvalidTelegram)
+	_, err = ParseTelegram(map[interface{}]interface{}{"token": "123:abc"})
+	assert.ErrorIs(t, err, ErrInvalidTelegram)
+	_, err = ParseTelegram(map[interface{}]interface{}{"token": 123, "chatID": "1"})
+	assert.ErrorIs(t, err, ErrInvalidTelegram)
+}
+
+func TestParseMatrix(t *testing.T) {
+	matrix, err := ParseMatrix(map[interface{}]interface{}{
+		"homeserver":  "https://matrix.example.org",
+		"accessToken": "syt_abc",
+		"roomID":      "!room:example.org",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Matrix{
+		Homeserver:  "https://matrix.example.org",
+		AccessToken: "syt_abc",
+		RoomID:      "!room:example.org",
+	}, matrix)
+
+	invalid := []map[interface{}]interface{}{
+		{"homeserver": "matrix.example.org", "accessToken": "syt_abc", "roomID": "!room:example.org"},
+		{"homeserver": "https://matrix.example.org", "roomID": "!room:example.org"},
+		{"homeserver": "https://matrix.example.org", "accessToken": "syt_abc", "roomID": "#alias:example.org"},
+		{"homeserver": "https://matrix.example.org", "accessToken": 1, "roomID": "!room:example.org"},
+	}
+	for _, section := range invalid {
+		_, err = ParseMatrix(section)
+		assert.ErrorIs(t, err, ErrInvalidMatrix, "%v", section)
+	}
+}
+
+func TestParseSMTP(t *testing.T) {
+	smtp, err := ParseSMTP(map[interface{}]interface{}{
+		"host":     "smtp.example.com",
+		"username": "ark",
+		"password": "s3cret",
+		"from":     "Ark-Overseer <ark@example.com>",
+		"to":       []interface{}{"admin@example.com", "Staff <staff@example.com>"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, SMTP{
+		Host:     "smtp.example.com",
+		Port:     587,
+		Security: SecuritySTARTTLS,
+		Username: "ark",
+		Password: "s3cret",
+		From:     "Ark-Overseer <ark@example.com>",
+		To:       []string{"admin@example.com", "Staff <staff@example.com>"},
+	}, smtp)
+
+	smtp, err = ParseSMTP(map[interface{}]interface{}{
+		"host":         "localhost",
+		"security":     SecurityTLS,
+		"from":         "ark@example.com",
+		"to":           "admin@example.com",
+		"textTemplate": "{{.Player}}",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 465, smtp.Port)
+	assert.Equal(t, []string{"admin@example.com"}, smtp.To)
+	assert.Equal(t, "{{.Player}}", smtp.Text)
+
+	smtp, err = ParseSMTP(map[interface{}]interface{}{
+		"host": "localhost", "port": 2525, "security": SecurityNone, "from": "ark@example.com", "to": "admin@example.com",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2525, smtp.Port)
+
+	valid := func() map[interface{}]interface{} {
+		return map[interface{}]interface{}{"host": "localhost", "from": "ark@example.com", "to": "admin@example.com"}
+	}
+	for key, value := range map[string]interface{}{
+		"host":     "",
+		"port":     70000,
+		"security": "ssl",
+		"from":     "not an address",
+		"to":       []interface{}{},
+	} {
+		section := valid()
+		section[key] = value
+		_, err = ParseSMTP(section)
+		assert.ErrorIs(t, err, ErrInvalidSMTP, key)
+	}
+}
+
+func TestParseNtfy(t *testing.T) {
+	ntfy, err := ParseNtfy(map[interface{}]interface{}{"url": "https://ntfy.sh/ark"})
+	assert.NoError(t, err)
+	assert.Equal(t, Ntfy{URL: "https://ntfy.sh/ark", Events: DefaultNtfyEvents()}, ntfy)
+	assert.Equal(t, 5, ntfy.Events["player.joined"].Priority, "tracked players joining are urgent")
+
+	ntfy, err = ParseNtfy(map[interface{}]interface{}{
+		"url":   "https://ntfy.example.com/ark",
+		"token": "tk_abc",
+		"events": map[interface{}]interface{}{
+			"player.joined":  map[interface{}]interface{}{"priority": "urgent", "tags": []interface{}{"skull"}},
+			"server.offline": map[interface{}]interface{}{"priority": 4, "tags": "warning"},
+			"player.left":    map[interface{}]interface{}{},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "tk_abc", ntfy.Token)
+	assert.Equal(t, map[string]NtfyEvent{
+		"player.joined":  {Priority: 5, Tags: []string{"skull"}},
+		"server.offline": {Priority: 4, Tags: []string{"warning"}},
+		"player.left":    {Priority: 3},
+	}, ntfy.Events)
+
+	invalid := []map[interface{}]interface{}{
+		{},
+		{"url": "ntfy.sh/ark"},
+		{"url": "https://ntfy.sh/ark", "events": []interface{}{"player.joined"}},
+		{"url": "https://ntfy.sh/ark", "events": map[interface{}]interface{}{"player.joined": map[interface{}]interface{}{"priority": "loud"}}},
+		{"url": "https://ntfy.sh/ark", "events": map[interface{}]interface{}{"player.joined": map[interface{}]interface{}{"priority": 6}}},
+	}
+	for _, section := range invalid {
+		_, err = ParseNtfy(section)
+		assert.ErrorIs(t, err, ErrInvalidNtfy, "%v", section)
+	}
+}
+
+func TestParseGotify(t *testing.T) {
+	gotify, err := ParseGotify(map[interface{}]interface{}{
+		"url":      "https://gotify.example.com",
+		"token":    "AbCdE",
+		"priority": "",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Gotify{URL: "https://gotify.example.com", Token: "AbCdE", Priority: 5, UrgentPriority: 10}, gotify)
+
+	gotify, err = ParseGotify(map[interface{}]interface{}{
+		"url":            "https://gotify.example.com",
+		"token":          "AbCdE",
+		"priority":       "2",
+		"urgentPriority": 8,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, gotify.Priority)
+	assert.Equal(t, 8, gotify.UrgentPriority)
+
+	invalid := []map[interface{}]interface{}{
+		{"token": "AbCdE"},
+		{"url": "https://gotify.example.com"},
+		{"url": "https://gotify.example.com", "token": "AbCdE", "priority": "high"},
+		{"url": "https://gotify.example.com", "token": "AbCdE", "priority": -1},
+	}
+	for _, section := range invalid {
+		_, err = ParseGotify(section)
+		assert.ErrorIs(t, err, ErrInvalidGotify, "%v", section)
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MatrixKey is the type of Matrix bot instances.
+const MatrixKey = "matrix"
+
+var ErrInvalidMatrix = errors.New("invalid matrix config")
+
+// Matrix configures the account that posts notifications into RoomID, the
+// internal ID of the room like !abc123:matrix.org, not one of its aliases.
+type Matrix struct {
+	Homeserver  string
+	AccessToken string
+	RoomID      string
+}
+
+// ParseMatrix reads the settings of a matrix instance.
+func ParseMatrix(value interface{}) (Matrix, error) {
+	var matrix Matrix
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return matrix, fmt.Errorf("%w: %s must be a map", ErrInvalidMatrix, MatrixKey)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "homeserver":
+			matrix.Homeserver, err = asString(ErrInvalidMatrix, key, value)
+		case "accessToken":
+			matrix.AccessToken, err = asString(ErrInvalidMatrix, key, value)
+		case "roomID":
+			matrix.RoomID, err = asString(ErrInvalidMatrix, key, value)
+		}
+		if err != nil {
+			return matrix, err
+		}
+	}
+
+	err = checkURL(matrix.Homeserver)
+	if err != nil {
+		return matrix, fmt.Errorf("%w: homeserver: %w", ErrInvalidMatrix, err)
+	}
+	if matrix.AccessToken == "" {
+		return matrix, fmt.Errorf("%w: accessToken is required", ErrInvalidMatrix)
+	}
+	if !strings.HasPrefix(matrix.RoomID, "!") || !strings.Contains(matrix.RoomID, ":") {
+		return matrix, fmt.Errorf("%w: roomID must look like !room:server", ErrInvalidMatrix)
+	}
+	return matrix, nil
+}
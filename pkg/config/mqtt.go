@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MQTTSection is the config section of the MQTT publisher.
+const MQTTSection = "mqtt"
+
+var ErrInvalidMQTT = errors.New("invalid mqtt config")
+
+// MQTT configures the publisher that mirrors events to an MQTT broker.
+// Broker is a URL like tcp://localhost:1883, events are published below
+// TopicPrefix.
+type MQTT struct {
+	Enabled     bool
+	Broker      string
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string
+	QoS         byte
+}
+
+func DefaultMQTT() MQTT {
+	return MQTT{
+		ClientID:    "ark-overseer",
+		TopicPrefix: "ark",
+	}
+}
+
+// defaultMQTTSection is written into new config files so the available
+// keys are visible.
+func defaultMQTTSection() map[interface{}]interface{} {
+	mqtt := DefaultMQTT()
+	return map[interface{}]interface{}{
+		"enabled":     mqtt.Enabled,
+		"broker":      "tcp://localhost:1883",
+		"clientID":    mqtt.ClientID,
+		"username":    "",
+		"password":    "",
+		"topicPrefix": mqtt.TopicPrefix,
+		"qos":         int(mqtt.QoS),
+	}
+}
+
+// ParseMQTT reads the mqtt section, missing keys keep their defaults. A nil
+// section yields the disabled default.
+func ParseMQTT(section map[interface{}]interface{}) (MQTT, error) {
+	mqtt := DefaultMQTT()
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "enabled":
+			mqtt.Enabled, err = asBool(ErrInvalidMQTT, key, value)
+		case "broker":
+			mqtt.Broker, err = asString(ErrInvalidMQTT, key, value)
+		case "clientID":
+			mqtt.ClientID, err = asString(ErrInvalidMQTT, key, value)
+		case "username":
+			mqtt.Username, err = asString(ErrInvalidMQTT, key, value)
+		case "password":
+			mqtt.Password, err = asString(ErrInvalidMQTT, key, value)
+		case "topicPrefix":
+			mqtt.TopicPrefix, err = asString(ErrInvalidMQTT, key, value)
+		case "qos":
+			qos, ok := value.(int)
+			if !ok || qos < 0 || qos > 2 {
+				err = fmt.Errorf("%w: qos must be 0, 1 or 2", ErrInvalidMQTT)
+			}
+			mqtt.QoS = byte(qos)
+		}
+		if err != nil {
+			return mqtt, err
+		}
+	}
+
+	if mqtt.Enabled && mqtt.Broker == "" {
+		return mqtt, fmt.Errorf("%w: broker is required", ErrInvalidMQTT)
+	}
+	return mqtt, nil
+}
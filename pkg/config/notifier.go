@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+const (
+	// InstancesKey is the key of the notifier list in the
+	// NotificationSection.
+	InstancesKey = "instances"
+	// DiscordKey is the type of Discord bot instances.
+	DiscordKey = "discord"
+)
+
+var ErrInvalidInstance = errors.New("invalid notifier instance")
+
+// NotifierTypes are the types of notifier instances in the order they are
+// offered on the setup page.
+var NotifierTypes = []string{DiscordKey, TelegramKey, MatrixKey, SMTPKey, NtfyKey, GotifyKey, WebhookKey}
+
+// instanceName keeps names usable as subscriber names and in URLs.
+var instanceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ReservedNames are the names of the built-in event subscribers. Instances
+// subscribe under their name, so they must not use one of these.
+var ReservedNames = []string{"journal", "mqtt", "observer", "servicemanager"}
+
+// Instance is a named notifier of one of the NotifierTypes. Events holds the
+// topic patterns it subscribes to, without them the defaults of the
+// notifier apply. Settings are passed to the parser of the type, e.g.
+// ParseTelegram.
+type Instance struct {
+	Name     string
+	Type     string
+	Events   []string
+	Settings map[interface{}]interface{}
+}
+
+// CheckInstanceName reports whether name can be used for an instance:
+// lower case letters, digits, dashes and underscores, but none of the
+// ReservedNames.
+func CheckInstanceName(name string) error {
+	if !instanceName.MatchString(name) {
+		return fmt.Errorf("%w: name %q must consist of lower case letters, digits, - and _", ErrInvalidInstance, name)
+	}
+	if slices.Contains(ReservedNames, name) {
+		return fmt.Errorf("%w: name %q is reserved", ErrInvalidInstance, name)
+	}
+	return nil
+}
+
+// ParseInstances reads the notifier list of the notification-service
+// section:
+//
+//	instances:
+//	  - name: discord-alerts
+//	    type: discord
+//	    events: [player.joined]
+//	    settings:
+//	      token: ...
+//	      channelID: "123456"
+//
+// Invalid instances are skipped and reported in the returned error, so a
+// broken notifier does not take down the others.
+func ParseInstances(value interface{}) ([]Instance, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be a list", ErrInvalidInstance, InstancesKey)
+	}
+
+	var errs []error
+	instances := make([]Instance, 0, len(list))
+	for i, item := range list {
+		instance, err := parseInstance(item)
+		if err == nil && slices.ContainsFunc(instances, func(other Instance) bool { return other.Name == instance.Name }) {
+			err = fmt.Errorf("%w: name %q is used twice", ErrInvalidInstance, instance.Name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d]: %w", InstancesKey, i, err))
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, errors.Join(errs...)
+}
+
+func parseInstance(value interface{}) (Instance, error) {
+	var instance Instance
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return instance, fmt.Errorf("%w: must be a map", ErrInvalidInstance)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "name":
+			instance.Name, err = asString(ErrInvalidInstance, key, value)
+		case "type":
+			instance.Type, err = asString(ErrInvalidInstance, key, value)
+		case "events":
+			instance.Events, err = asStrings(ErrInvalidInstance, key, value)
+		case "settings":
+			instance.Settings, ok = value.(map[interface{}]interface{})
+			if !ok {
+				err = fmt.Errorf("%w: settings must be a map", ErrInvalidInstance)
+			}
+		}
+		if err != nil {
+			return instance, err
+		}
+	}
+
+	err = CheckInstanceName(instance.Name)
+	if err != nil {
+		return instance, err
+	}
+	if !slices.Contains(NotifierTypes, instance.Type) {
+		return instance, fmt.Errorf("%w: %s: unknown type %q", ErrInvalidInstance, instance.Name, instance.Type)
+	}
+	if instance.Settings == nil {
+		instance.Settings = make(map[interface{}]interface{})
+	}
+	return instance, nil
+}
+
+// moveIntoInstances turns the notifiers of the notification-service
+// section, which were keyed by their type, into a list of instances named
+// after the type. Every webhook becomes an instance of its own.
+func moveIntoInstances(data any) (any, error) {
+	config, ok := data.(map[interface{}]interface{})
+	if !ok {
+		return data, nil
+	}
+	section, ok := config[NotificationSection].(map[interface{}]interface{})
+	if !ok {
+		return data, nil
+	}
+
+	var instances []interface{}
+	for _, typ := range []string{DiscordKey, TelegramKey, MatrixKey, SMTPKey, NtfyKey, GotifyKey} {
+		settings, ok := section[typ].(map[interface{}]interface{})
+		delete(section, typ)
+		if !ok {
+			continue
+		}
+		instances = append(instances, map[interface{}]interface{}{
+			"name":     typ,
+			"type":     typ,
+			"settings": settings,
+		})
+	}
+
+	webhooks, _ := section["webhooks"].([]interface{})
+	delete(section, "webhooks")
+	for i, item := range webhooks {
+		settings, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		instance := map[interface{}]interface{}{
+			"name": WebhookKey,
+			"type": WebhookKey,
+		}
+		if i > 0 {
+			instance["name"] = fmt.Sprintf("%s-%d", WebhookKey, i+1)
+		}
+		if events, ok := settings["events"]; ok {
+			instance["events"] = events
+			delete(settings, "events")
+		}
+		instance["settings"] = settings
+		instances = append(instances, instance)
+	}
+
+	section[InstancesKey] = instances
+	return config, nil
+}
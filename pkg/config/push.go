@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// NtfyKey is the type of ntfy topic instances.
+	NtfyKey = "ntfy"
+	// GotifyKey is the type of Gotify server instances.
+	GotifyKey = "gotify"
+)
+
+var (
+	ErrInvalidNtfy   = errors.New("invalid ntfy config")
+	ErrInvalidGotify = errors.New("invalid gotify config")
+)
+
+// ntfyPriorities are the names ntfy accepts for the priorities 1 to 5.
+var ntfyPriorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "urgent": 5, "max": 5}
+
+// Ntfy configures pushes to an ntfy topic. The optional Token or Username
+// and Password authenticate against protected topics. Events holds the
+// priority and tags of every pushed event type.
+type Ntfy struct {
+	URL      string
+	Token    string
+	Username string
+	Password string
+	Events   map[string]NtfyEvent
+}
+
+// NtfyEvent is the priority (1 to 5) and the tags of a pushed event type.
+type NtfyEvent struct {
+	Priority int
+	Tags     []string
+}
+
+// DefaultNtfyEvents pushes tracked players joining as urgent.
+func DefaultNtfyEvents() map[string]NtfyEvent {
+	return map[string]NtfyEvent{
+		"player.joined": {Priority: 5, Tags: []string{"rotating_light"}},
+		"player.left":   {Priority: 3, Tags: []string{"wave"}},
+	}
+}
+
+// Event returns the priority and tags of an event type, types without
+// settings are pushed with the default priority and no tags.
+func (n Ntfy) Event(topic string) NtfyEvent {
+	if event, ok := n.Events[topic]; ok {
+		return event
+	}
+	return NtfyEvent{Priority: ntfyPriorities["default"]}
+}
+
+// ParseNtfy reads the settings of an ntfy instance:
+//
+//	url: https://ntfy.sh/ark-alerts
+//	token: tk_...
+//	events:
+//	  player.joined: {priority: urgent, tags: [rotating_light]}
+//	  server.offline: {priority: high, tags: [warning]}
+func ParseNtfy(value interface{}) (Ntfy, error) {
+	var ntfy Ntfy
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return ntfy, fmt.Errorf("%w: %s must be a map", ErrInvalidNtfy, NtfyKey)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "url":
+			ntfy.URL, err = asString(ErrInvalidNtfy, key, value)
+		case "token":
+			ntfy.Token, err = asString(ErrInvalidNtfy, key, value)
+		case "username":
+			ntfy.Username, err = asString(ErrInvalidNtfy, key, value)
+		case "password":
+			ntfy.Password, err = asString(ErrInvalidNtfy, key, value)
+		case "events":
+			ntfy.Events, err = parseNtfyEvents(value)
+		}
+		if err != nil {
+			return ntfy, err
+		}
+	}
+
+	err = checkURL(ntfy.URL)
+	if err != nil {
+		return ntfy, fmt.Errorf("%w: %w", ErrInvalidNtfy, err)
+	}
+	if ntfy.Events == nil {
+		ntfy.Events = DefaultNtfyEvents()
+	}
+	return ntfy, nil
+}
+
+func parseNtfyEvents(value interface{}) (map[string]NtfyEvent, error) {
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: events must be a map", ErrInvalidNtfy)
+	}
+
+	events := make(map[string]NtfyEvent, len(section))
+	for topic, value := range section {
+		name, ok := topic.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: events must have string keys", ErrInvalidNtfy)
+		}
+		settings, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: events.%s must be a map", ErrInvalidNtfy, name)
+		}
+
+		event := NtfyEvent{Priority: ntfyPriorities["default"]}
+		var err error
+		if priority, ok := settings["priority"]; ok && priority != nil {
+			event.Priority, err = ntfyPriority(name, priority)
+		}
+		if tags, ok := settings["tags"]; ok && tags != nil && err == nil {
+			event.Tags, err = asStrings(ErrInvalidNtfy, "events."+name+".tags", tags)
+		}
+		if err != nil {
+			return nil, err
+		}
+		events[name] = event
+	}
+	return events, nil
+}
+
+// ntfyPriority accepts the priorities by name or number.
+func ntfyPriority(topic string, value interface{}) (int, error) {
+	key := "events." + topic + ".priority"
+	if name, ok := value.(string); ok {
+		if priority, ok := ntfyPriorities[strings.ToLower(name)]; ok {
+			return priority, nil
+		}
+	}
+	priority, err := asInt(ErrInvalidNtfy, key, value)
+	if err != nil || priority < 1 || priority > 5 {
+		return 0, fmt.Errorf("%w: %s must be min, low, default, high, urgent or 1 to 5", ErrInvalidNtfy, key)
+	}
+	return priority, nil
+}
+
+// Gotify configures pushes to a Gotify server with the token of an
+// application. Tracked players joining are pushed with UrgentPriority, all
+// other events with Priority.
+type Gotify struct {
+	URL            string
+	Token          string
+	Priority       int
+	UrgentPriority int
+}
+
+func DefaultGotify() Gotify {
+	return Gotify{Priority: 5, UrgentPriority: 10}
+}
+
+// ParseGotify reads the settings of a gotify instance.
+func ParseGotify(value interface{}) (Gotify, error) {
+	gotify := DefaultGotify()
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return gotify, fmt.Errorf("%w: %s must be a map", ErrInvalidGotify, GotifyKey)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil || value == "" {
+			continue
+		}
+		switch key {
+		case "url":
+			gotify.URL, err = asString(ErrInvalidGotify, key, value)
+		case "token":
+			gotify.Token, err = asString(ErrInvalidGotify, key, value)
+		case "priority":
+			gotify.Priority, err = asInt(ErrInvalidGotify, key, value)
+		case "urgentPriority":
+			gotify.UrgentPriority, err = asInt(ErrInvalidGotify, key, value)
+		}
+		if err != nil {
+			return gotify, err
+		}
+	}
+
+	err = checkURL(gotify.URL)
+	if err != nil {
+		return gotify, fmt.Errorf("%w: %w", ErrInvalidGotify, err)
+	}
+	if gotify.Token == "" {
+		return gotify, fmt.Errorf("%w: token is required", ErrInvalidGotify)
+	}
+	if gotify.Priority < 0 || gotify.UrgentPriority < 0 {
+		return gotify, fmt.Errorf("%w: priorities must not be negative", ErrInvalidGotify)
+	}
+	return gotify, nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// KeyEnv is the environment variable holding the base64 encoded key
+	// for the secrets in config.yaml. It takes precedence over the key file.
+	KeyEnv = "ARK_OVERSEER_CONFIG_KEY"
+	// KeySize is the size of the AES-256 key in bytes.
+	KeySize = 32
+
+	secretPrefix = "enc:"
+	mask         = "********"
+)
+
+var ErrInvalidKey = errors.New("config key must be 32 base64 encoded bytes")
+
+// Cipher encrypts secret config values with AES-GCM. Encrypted values are
+// stored as "enc:" followed by the base64 encoded nonce and ciphertext.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// LoadKey returns the key from the KeyEnv environment variable or, if it is
+// unset, from keyFile. A missing key file is created with a new random key.
+func LoadKey(keyFile string) ([]byte, error) {
+	if encoded, ok := os.LookupEnv(KeyEnv); ok {
+		return decodeKey(encoded)
+	}
+
+	encoded, err := os.ReadFile(keyFile)
+	if err == nil {
+		return decodeKey(string(encoded))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, KeySize)
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(keyFile), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write config key: %w", err)
+	}
+	return key, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value, wrong key?: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// IsSecret reports whether a config key holds a secret. These are all keys
+// ending in token, password or secret, regardless of case.
+func IsSecret(key any) bool {
+	name, ok := key.(string)
+	if !ok {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, suffix := range []string{"token", "password", "secret"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns a copy of value with every secret replaced by a mask, so it
+// can be logged or shown in the UI.
+func Redact(value any) any {
+	redacted, _ := transform(value, func(secret string) (string, error) {
+		if secret == "" {
+			return "", nil
+		}
+		return mask, nil
+	})
+	return redacted
+}
+
+// transform returns a deep copy of value in which fn replaced the string
+// values of all secret keys. Maps and lists are copied, other values are
+// shared.
+func transform(value any, fn func(secret string) (string, error)) (any, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(v))
+		for key, item := range v {
+			if secret, ok := item.(string); ok && IsSecret(key) {
+				replaced, err := fn(secret)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %w", key, err)
+				}
+				out[key] = replaced
+				continue
+			}
+			replaced, err := transform(item, fn)
+			if err != nil {
+				return nil, fmt.Errorf("%v.%w", key, err)
+			}
+			out[key] = replaced
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			replaced, err := transform(item, fn)
+			if err != nil {
+				return nil, fmt.Errorf("[%d].%w", i, err)
+			}
+			out[i] = replaced
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/led0nk/ark-overseer/pkg/atomicfile"
+	"github.com/led0nk/ark-overseer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCipher(t *testing.T) *Cipher {
+	cipher, err := NewCipher([]byte(strings.Repeat("k", KeySize)))
+	assert.NoError(t, err)
+	return cipher
+}
+
+func TestCipher(t *testing.T) {
+	cipher := newTestCipher(t)
+
+	encrypted, err := cipher.Encrypt("123456")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "123456")
+
+	decrypted, err := cipher.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", decrypted)
+
+	other, err := NewCipher([]byte(strings.Repeat("o", KeySize)))
+	assert.NoError(t, err)
+	_, err = other.Decrypt(encrypted)
+	assert.Error(t, err)
+
+	_, err = NewCipher([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	keyFile := filepath.Join(dir, "config.key")
+	key, err := LoadKey(keyFile)
+	assert.NoError(t, err)
+	assert.Len(t, key, KeySize)
+
+	info, err := os.Stat(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	again, err := LoadKey(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	t.Setenv(KeyEnv, "not a key")
+	_, err = LoadKey(keyFile)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestRedact(t *testing.T) {
+	section := map[interface{}]interface{}{
+		"discord": map[interface{}]interface{}{"token": "123456", "channelID": "abcdef"},
+		"webhooks": []interface{}{
+			map[interface{}]interface{}{"url": "http://localhost", "hmacSecret": "s3cret"},
+		},
+		"smtp": map[interface{}]interface{}{"password": ""},
+	}
+
+	redacted := Redact(section).(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{"token": mask, "channelID": "abcdef"}, redacted["discord"])
+	assert.Equal(t, mask, redacted["webhooks"].([]interface{})[0].(map[interface{}]interface{})["hmacSecret"])
+	assert.Equal(t, "", redacted["smtp"].(map[interface{}]interface{})["password"])
+	assert.Equal(t, "123456", section["discord"].(map[interface{}]interface{})["token"], "the original must be unchanged")
+}
+
+func TestConfigEncryptsSecrets(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	em := events.NewEventManager()
+	cfg, err := NewConfiguration(filename, newTestCipher(t), em)
+	assert.NoError(t, err)
+
+	value := map[interface{}]interface{}{"token": "123456", "channelID": "abcdef"}
+	err = cfg.Update(context.Background(), "notification-service", "discord", value)
+	assert.NoError(t, err)
+
+	raw, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "123456")
+	assert.Contains(t, string(raw), "token: enc:")
+	assert.Contains(t, string(raw), "abcdef")
+
+	info, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	section, err := cfg.GetSection("notification-service")
+	assert.NoError(t, err)
+	assert.Equal(t, value, section["discord"])
+
+	_, err = NewConfiguration(filename, nil, em)
+	assert.NoError(t, err)
+	wrongKey, err := NewCipher([]byte(strings.Repeat("o", KeySize)))
+	assert.NoError(t, err)
+	cfg, err = NewConfiguration(filename, wrongKey, em)
+	assert.NoError(t, err)
+	_, err = cfg.GetSection("notification-service")
+	assert.Error(t, err)
+}
+
+func TestConfigSealsPlaintextSecrets(t *testing.T) {
+	dir := createTempDir(t)
+	defer cleanupTempDir(t, dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	em := events.NewEventManager()
+	cfg, err := NewConfiguration(filename, nil, em)
+	assert.NoError(t, err)
+	value := map[interface{}]interface{}{"token": "123456", "channelID": "abcdef"}
+	err = cfg.Update(context.Background(), "notification-service", "discord", value)
+	assert.NoError(t, err)
+
+	raw, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "123456")
+	backups, err := atomicfile.Backups(filename)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, backups)
+
+	cfg, err = NewConfiguration(filename, newTestCipher(t), em)
+	assert.NoError(t, err)
+
+	raw, err = os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "123456")
+
+	backups, err = atomicfile.Backups(filename)
+	assert.NoError(t, err)
+	assert.Empty(t, backups, "backups with plaintext secrets must be removed")
+
+	section, err := cfg.GetSection("notification-service")
+	assert.NoError(t, err)
+	assert.Equal(t, value, section["discord"])
+}
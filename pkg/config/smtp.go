@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+)
+
+// SMTPKey is the type of mail server instances.
+const SMTPKey = "smtp"
+
+// Security of the connection to the mail server.
+const (
+	SecurityNone     = "none"
+	SecuritySTARTTLS = "starttls"
+	SecurityTLS      = "tls"
+)
+
+var ErrInvalidSMTP = errors.New("invalid smtp config")
+
+// SMTP configures the mail notifications. Port defaults to 587 for
+// STARTTLS, 465 for TLS and 25 without encryption. Subject, Text and HTML
+// are Go templates overriding the built-in ones, see the smtp service for
+// the available fields.
+type SMTP struct {
+	Host     string
+	Port     int
+	Security string
+	Username string
+	Password string
+	From     string
+	To       []string
+	Subject  string
+	Text     string
+	HTML     string
+}
+
+// ParseSMTP reads the settings of an smtp instance:
+//
+//	host: smtp.example.com
+//	security: starttls
+//	username: ark
+//	password: s3cret
+//	from: Ark-Overseer <ark@example.com>
+//	to: [admin@example.com]
+func ParseSMTP(value interface{}) (SMTP, error) {
+	smtp := SMTP{Security: SecuritySTARTTLS}
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return smtp, fmt.Errorf("%w: %s must be a map", ErrInvalidSMTP, SMTPKey)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "host":
+			smtp.Host, err = asString(ErrInvalidSMTP, key, value)
+		case "port":
+			smtp.Port, err = asInt(ErrInvalidSMTP, key, value)
+			if err != nil || smtp.Port <= 0 || smtp.Port > 65535 {
+				err = fmt.Errorf("%w: port must be a number between 1 and 65535", ErrInvalidSMTP)
+			}
+		case "security":
+			smtp.Security, err = asString(ErrInvalidSMTP, key, value)
+		case "username":
+			smtp.Username, err = asString(ErrInvalidSMTP, key, value)
+		case "password":
+			smtp.Password, err = asString(ErrInvalidSMTP, key, value)
+		case "from":
+			smtp.From, err = asString(ErrInvalidSMTP, key, value)
+		case "to":
+			smtp.To, err = asStrings(ErrInvalidSMTP, key, value)
+		case "subject":
+			smtp.Subject, err = asString(ErrInvalidSMTP, key, value)
+		case "textTemplate":
+			smtp.Text, err = asString(ErrInvalidSMTP, key, value)
+		case "htmlTemplate":
+			smtp.HTML, err = asString(ErrInvalidSMTP, key, value)
+		}
+		if err != nil {
+			return smtp, err
+		}
+	}
+
+	if smtp.Host == "" {
+		return smtp, fmt.Errorf("%w: host is required", ErrInvalidSMTP)
+	}
+	switch smtp.Security {
+	case SecurityNone:
+		smtp.Port = defaultPort(smtp.Port, 25)
+	case SecuritySTARTTLS:
+		smtp.Port = defaultPort(smtp.Port, 587)
+	case SecurityTLS:
+		smtp.Port = defaultPort(smtp.Port, 465)
+	default:
+		return smtp, fmt.Errorf("%w: security must be none, starttls or tls", ErrInvalidSMTP)
+	}
+	_, err = mail.ParseAddress(smtp.From)
+	if err != nil {
+		return smtp, fmt.Errorf("%w: from: %w", ErrInvalidSMTP, err)
+	}
+	if len(smtp.To) == 0 {
+		return smtp, fmt.Errorf("%w: at least one recipient is required", ErrInvalidSMTP)
+	}
+	for _, to := range smtp.To {
+		_, err = mail.ParseAddress(to)
+		if err != nil {
+			return smtp, fmt.Errorf("%w: to: %w", ErrInvalidSMTP, err)
+		}
+	}
+	return smtp, nil
+}
+
+func defaultPort(port int, fallback int) int {
+	if port == 0 {
+		return fallback
+	}
+	return port
+}
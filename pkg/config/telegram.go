@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TelegramKey is the type of Telegram bot instances.
+const TelegramKey = "telegram"
+
+// DefaultTelegramAPI is the URL of the public Bot API.
+const DefaultTelegramAPI = "https://api.telegram.org"
+
+var ErrInvalidTelegram = errors.New("invalid telegram config")
+
+// Telegram configures the bot that sends notifications to ChatID, which is
+// either the numeric ID of a chat or the @name of a channel. APIURL only
+// has to be set for a self-hosted Bot API server.
+type Telegram struct {
+	Token  string
+	ChatID string
+	APIURL string
+}
+
+// ParseTelegram reads the settings of a telegram instance.
+func ParseTelegram(value interface{}) (Telegram, error) {
+	telegram := Telegram{APIURL: DefaultTelegramAPI}
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return telegram, fmt.Errorf("%w: %s must be a map", ErrInvalidTelegram, TelegramKey)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "token":
+			telegram.Token, err = asString(ErrInvalidTelegram, key, value)
+		case "chatID":
+			telegram.ChatID, err = asChatID(key, value)
+		case "apiURL":
+			telegram.APIURL, err = asString(ErrInvalidTelegram, key, value)
+		}
+		if err != nil {
+			return telegram, err
+		}
+	}
+
+	if telegram.Token == "" || telegram.ChatID == "" {
+		return telegram, fmt.Errorf("%w: token and chatID are required", ErrInvalidTelegram)
+	}
+	if telegram.APIURL == "" {
+		telegram.APIURL = DefaultTelegramAPI
+	}
+	return telegram, nil
+}
+
+// asChatID accepts numeric chat IDs as YAML numbers as well, hand-written
+// configs rarely quote them.
+func asChatID(key any, value any) (string, error) {
+	if id, ok := value.(int); ok {
+		return fmt.Sprint(id), nil
+	}
+	return asString(ErrInvalidTelegram, key, value)
+}
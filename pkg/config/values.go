@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// asString returns value as a string, or invalid wrapped in an error naming
+// key.
+func asString(invalid error, key any, value any) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %v must be a string", invalid, key)
+	}
+	return s, nil
+}
+
+func asBool(invalid error, key any, value any) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %v must be true or false", invalid, key)
+	}
+	return b, nil
+}
+
+// asStrings accepts a list of strings as well as a single string.
+func asStrings(invalid error, key any, value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := asString(invalid, key, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("%w: %v must be a list of strings", invalid, key)
+	}
+}
+
+// asStringMap returns a map of strings, e.g. HTTP headers.
+func asStringMap(invalid error, key any, value any) (map[string]string, error) {
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %v must be a map", invalid, key)
+	}
+	values := make(map[string]string, len(m))
+	for k, item := range m {
+		name, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v must have string keys", invalid, key)
+		}
+		s, err := asString(invalid, fmt.Sprintf("%v.%s", key, name), item)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+// asInt accepts numbers as well as numeric strings, as submitted by the
+// settings forms.
+func asInt(invalid error, key any, value any) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %v must be a number", invalid, key)
+}
+
+// checkURL reports whether rawURL is an absolute http or https URL.
+func checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WebhookKey is the type of webhook instances.
+const WebhookKey = "webhook"
+
+var ErrInvalidWebhook = errors.New("invalid webhook config")
+
+// DefaultWebhookEvents are the topic patterns of webhooks without events.
+var DefaultWebhookEvents = []string{"server.*", "player.*"}
+
+// Webhook is an URL every matching event is POSTed to as JSON. Headers are
+// added to every request, with a Secret the body is signed with
+// HMAC-SHA256. Events holds the topic patterns, see events.MatchTopic.
+type Webhook struct {
+	URL     string
+	Secret  string
+	Headers map[string]string
+	Events  []string
+}
+
+// ParseWebhook reads the settings of a webhook instance:
+//
+//	url: https://example.com/hook
+//	secret: s3cret
+//	headers:
+//	  X-Source: ark-overseer
+//
+// Its events are those of the instance, without them DefaultWebhookEvents.
+func ParseWebhook(value interface{}) (Webhook, error) {
+	var webhook Webhook
+
+	section, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return webhook, fmt.Errorf("%w: settings must be a map", ErrInvalidWebhook)
+	}
+
+	var err error
+	for key, value := range section {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "url":
+			webhook.URL, err = asString(ErrInvalidWebhook, key, value)
+		case "secret":
+			webhook.Secret, err = asString(ErrInvalidWebhook, key, value)
+		case "headers":
+			webhook.Headers, err = asStringMap(ErrInvalidWebhook, key, value)
+		}
+		if err != nil {
+			return webhook, err
+		}
+	}
+
+	err = checkURL(webhook.URL)
+	if err != nil {
+		return webhook, fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+	}
+	if len(webhook.Events) == 0 {
+		webhook.Events = DefaultWebhookEvents
+	}
+	return webhook, nil
+}
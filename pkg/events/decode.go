@@ -0,0 +1,38 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotReplayable is returned by Decode for topics that must not be
+// published again, like init or config changes whose values are not encoded.
+var ErrNotReplayable = errors.New("event is not replayable")
+
+var decoders = map[string]func([]byte) (Event, error){
+	ServerAdded{}.Topic():                      decode[ServerAdded],
+	ServerDeleted{}.Topic():                    decode[ServerDeleted],
+	ServerStatusChanged{Online: true}.Topic():  decode[ServerStatusChanged],
+	ServerStatusChanged{Online: false}.Topic(): decode[ServerStatusChanged],
+	PlayerJoined{}.Topic():                     decode[PlayerJoined],
+	PlayerLeft{}.Topic():                       decode[PlayerLeft],
+}
+
+// Decode restores an event of topic from its JSON encoding.
+func Decode(topic string, data []byte) (Event, error) {
+	fn, ok := decoders[topic]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotReplayable, topic)
+	}
+	return fn(data)
+}
+
+func decode[T Event](data []byte) (Event, error) {
+	var event T
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,254 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Policy decides what happens to an event when a subscriber's buffer is
+// full.
+type Policy int
+
+const (
+	// DropNewest discards the event that does not fit anymore. It is the
+	// default and matches the behavior of earlier versions.
+	DropNewest Policy = iota
+	// DropOldest discards the oldest buffered event to make room.
+	DropOldest
+	// Block waits up to the subscriber's timeout for room in the buffer and
+	// drops the event afterwards.
+	Block
+	// Unbounded queues every event in memory until the subscriber reads it.
+	Unbounded
+)
+
+const (
+	DefaultBufferSize   = 5
+	DefaultBlockTimeout = 5 * time.Second
+)
+
+func (p Policy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	case Unbounded:
+		return "unbounded"
+	default:
+		return "unknown"
+	}
+}
+
+// SubscribeOption configures the delivery of events to a single subscriber.
+type SubscribeOption func(*subscriber)
+
+// WithPolicy sets the delivery policy of the subscriber.
+func WithPolicy(policy Policy) SubscribeOption {
+	return func(s *subscriber) {
+		s.policy = policy
+	}
+}
+
+// WithBufferSize sets the number of events buffered for the subscriber.
+func WithBufferSize(size int) SubscribeOption {
+	return func(s *subscriber) {
+		if size >= 0 {
+			s.bufferSize = size
+		}
+	}
+}
+
+// WithTimeout sets how long Publish waits for a subscriber with the Block
+// policy.
+func WithTimeout(timeout time.Duration) SubscribeOption {
+	return func(s *subscriber) {
+		if timeout > 0 {
+			s.timeout = timeout
+		}
+	}
+}
+
+// DeadLetter describes an event that was not delivered to a subscriber.
+type DeadLetter struct {
+	Subscriber string
+	Policy     Policy
+	Reason     string
+	Event      EventMessage
+}
+
+// DeadLetterFunc receives every dropped event. It is called synchronously
+// from Publish and must neither block nor (un)subscribe.
+type DeadLetterFunc func(DeadLetter)
+
+type subscriber struct {
+	id         uuid.UUID
+	name       string
+	policy     Policy
+	bufferSize int
+	timeout    time.Duration
+	topics     []string
+	predicates []Predicate
+	ch         chan EventMessage
+	opts       []SubscribeOption
+
+	handlerTimeout time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	health         *health
+
+	// done is closed by close and wakes senders waiting for room in ch,
+	// which is only closed once none of them is left.
+	done   chan struct{}
+	sendMu sync.RWMutex
+
+	// queue and signal are only used by the Unbounded policy.
+	mu     sync.Mutex
+	queue  []EventMessage
+	signal chan struct{}
+}
+
+func newSubscriber(id uuid.UUID, name string, opts ...SubscribeOption) *subscriber {
+	s := &subscriber{
+		id:         id,
+		name:       name,
+		policy:     DropNewest,
+		bufferSize: DefaultBufferSize,
+		timeout:    DefaultBlockTimeout,
+
+		handlerTimeout: DefaultHandlerTimeout,
+		minBackoff:     MinRestartBackoff,
+		maxBackoff:     MaxRestartBackoff,
+		health:         &health{},
+		opts:           opts,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.ch = make(chan EventMessage, s.bufferSize)
+	s.done = make(chan struct{})
+	if s.policy == Unbounded {
+		s.signal = make(chan struct{}, 1)
+		go s.pump()
+	}
+	return s
+}
+
+// deliver hands the event to the subscriber according to its policy, drop
+// is called for every event that gets discarded on the way. It is safe to
+// call concurrently with close.
+func (s *subscriber) deliver(emsg EventMessage, drop func(EventMessage, string)) {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+	select {
+	case <-s.done:
+		drop(emsg, "unsubscribed")
+		return
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- emsg:
+				return
+			default:
+			}
+			select {
+			case old := <-s.ch:
+				drop(old, "dropped for newer event")
+			default:
+			}
+		}
+	case Block:
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		select {
+		case s.ch <- emsg:
+		case <-timer.C:
+			drop(emsg, "timed out")
+		case <-s.done:
+			drop(emsg, "unsubscribed")
+		}
+	case Unbounded:
+		s.mu.Lock()
+		s.queue = append(s.queue, emsg)
+		s.mu.Unlock()
+		select {
+		case s.signal <- struct{}{}:
+		default:
+		}
+	default:
+		select {
+		case s.ch <- emsg:
+		default:
+			drop(emsg, "buffer full")
+		}
+	}
+}
+
+// pump moves queued events into the channel of an Unbounded subscriber.
+func (s *subscriber) pump() {
+	defer close(s.ch)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.signal:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		next := s.queue[0]
+		s.queue[0] = EventMessage{}
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- next:
+		case <-s.done:
+			s.mu.Lock()
+			s.queue = append([]EventMessage{next}, s.queue...)
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// queued returns the number of events waiting for the subscriber.
+func (s *subscriber) queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ch) + len(s.queue)
+}
+
+func (s *subscriber) close() {
+	close(s.done)
+	if s.policy == Unbounded {
+		// pump closes the channel
+		return
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	close(s.ch)
+}
+
+// drain returns the events left over after close, in the order they were
+// delivered.
+func (s *subscriber) drain() []EventMessage {
+	var pending []EventMessage
+	for emsg := range s.ch {
+		pending = append(pending, emsg)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(pending, s.queue...)
+}
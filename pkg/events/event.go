@@ -2,40 +2,161 @@ package events
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var meter = otel.GetMeterProvider().Meter("github.com/led0nk/ark-overseer/internal/events")
+var (
+	meter  = otel.GetMeterProvider().Meter("github.com/led0nk/ark-overseer/internal/events")
+	tracer = otel.GetTracerProvider().Tracer("github.com/led0nk/ark-overseer/pkg/events")
+)
 
 type EventHandler interface {
 	HandleEvent(context.Context, EventMessage)
 }
 
+// HandlerFunc adapts a function to an EventHandler.
+type HandlerFunc func(context.Context, EventMessage)
+
+func (f HandlerFunc) HandleEvent(ctx context.Context, event EventMessage) {
+	f(ctx, event)
+}
+
+// On returns an EventHandler that calls fn for every event of type T and
+// ignores all others.
+func On[T Event](fn func(context.Context, T)) EventHandler {
+	return HandlerFunc(func(ctx context.Context, event EventMessage) {
+		if payload, ok := event.Payload.(T); ok {
+			fn(ctx, payload)
+		}
+	})
+}
+
+var ErrUnknownSubscriber = errors.New("unknown subscriber")
+
 type EventManager struct {
 	logger     *slog.Logger
-	subscriber map[uuid.UUID]chan EventMessage
+	subscriber map[uuid.UUID]*subscriber
+	deadLetter DeadLetterFunc
+	publishCtr metric.Int64Counter
+	droppedCtr metric.Int64Counter
+	failedCtr  metric.Int64Counter
+	restartCtr metric.Int64Counter
 	mu         sync.RWMutex
 }
 
+// EventMessage is what subscribers receive. Type is the topic of Payload,
+// handlers switch on the type of Payload to get the event data. SpanContext
+// is the span of the Publish call and parents the spans of the handlers.
 type EventMessage struct {
-	Type    string
-	Payload interface{}
+	Type        string
+	Payload     Event
+	SpanContext trace.SpanContext
 }
 
 func NewEventManager() *EventManager {
-	return &EventManager{
+	e := &EventManager{
 		logger:     slog.Default().WithGroup("event"),
-		subscriber: make(map[uuid.UUID]chan EventMessage),
+		subscriber: make(map[uuid.UUID]*subscriber),
+	}
+
+	var err error
+	e.publishCtr, err = meter.Int64Counter(
+		"eventCtr",
+		metric.WithDescription("number of events published"),
+	)
+	if err != nil {
+		e.logger.Error("failed to create event counter", "error", err)
+	}
+
+	e.droppedCtr, err = meter.Int64Counter(
+		"droppedEventCtr",
+		metric.WithDescription("number of events dropped per subscriber"),
+	)
+	if err != nil {
+		e.logger.Error("failed to create dropped event counter", "error", err)
+	}
+
+	e.failedCtr, err = meter.Int64Counter(
+		"failedHandlerCtr",
+		metric.WithDescription("number of events whose handler panicked or timed out per subscriber"),
+	)
+	if err != nil {
+		e.logger.Error("failed to create failed handler counter", "error", err)
+	}
+
+	e.restartCtr, err = meter.Int64Counter(
+		"listenerRestartCtr",
+		metric.WithDescription("number of listener restarts per subscriber"),
+	)
+	if err != nil {
+		e.logger.Error("failed to create listener restart counter", "error", err)
+	}
+
+	healthyGauge, err := meter.Int64ObservableGauge(
+		"subscriberHealthy",
+		metric.WithDescription("1 if the subscriber is healthy, 0 otherwise"),
+	)
+	if err != nil {
+		e.logger.Error("failed to create subscriber health gauge", "error", err)
+		return e
+	}
+
+	queuedGauge, err := meter.Int64ObservableGauge(
+		"queuedEvents",
+		metric.WithDescription("number of events waiting per subscriber"),
+	)
+	if err != nil {
+		e.logger.Error("failed to create queued events gauge", "error", err)
+		return e
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		for _, sub := range e.subscriber {
+			o.ObserveInt64(queuedGauge, int64(sub.queued()), metric.WithAttributes(
+				attribute.String("subscriber", sub.name),
+				attribute.String("policy", sub.policy.String()),
+			))
+			var healthy int64
+			if sub.health.snapshot(sub).Healthy {
+				healthy = 1
+			}
+			o.ObserveInt64(healthyGauge, healthy, metric.WithAttributes(
+				attribute.String("subscriber", sub.name),
+			))
+		}
+		return nil
+	}, queuedGauge, healthyGauge)
+	if err != nil {
+		e.logger.Error("failed to register queued events callback", "error", err)
 	}
+	return e
 }
 
-func (e *EventManager) Subscribe(name string) (uuid.UUID, <-chan EventMessage) {
+// SetDeadLetter installs fn as the receiver of dropped events, nil removes
+// it.
+func (e *EventManager) SetDeadLetter(fn DeadLetterFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.deadLetter = fn
+}
+
+// Subscribe registers a new subscriber. Without options it receives every
+// event, delivered with the DropNewest policy into a buffer of
+// DefaultBufferSize.
+func (e *EventManager) Subscribe(name string, opts ...SubscribeOption) (uuid.UUID, <-chan EventMessage) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -44,53 +165,179 @@ func (e *EventManager) Subscribe(name string) (uuid.UUID, <-chan EventMessage) {
 		return uuid.Nil, nil
 	}
 
-	ch := make(chan EventMessage, 5)
-	e.subscriber[id] = ch
+	sub := newSubscriber(id, name, opts...)
+	e.subscriber[id] = sub
 
-	e.logger.Info("service subscribed to eventManager", "service id", id, "service name", name)
-	return id, ch
+	e.logger.Info("service subscribed to eventManager", "service id", id, "service name", name, "policy", sub.policy.String(), "topics", sub.topics)
+	return id, sub.ch
 }
 
 func (e *EventManager) Unsubscribe(id uuid.UUID, name string) {
 	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	ch := e.subscriber[id]
-	close(ch)
+	sub, exists := e.subscriber[id]
 	delete(e.subscriber, id)
+	e.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	// close waits for running deliveries, which may need e.mu to drop
+	// their event
+	sub.close()
 	e.logger.Info("service unsubscribed to eventManager", "service id", id, "service name", name)
 }
 
-func (e *EventManager) Publish(emsg EventMessage) {
-	ctx := context.Background()
-	eventCtr, err := meter.Int64Counter(
-		"eventCtr",
-		metric.WithDescription("number of events published"),
+// Publish delivers event to every subscriber whose filters accept it. The
+// span started here becomes the parent of the spans of the handlers, so a
+// trace continues from the caller in ctx to every subscriber.
+func (e *EventManager) Publish(ctx context.Context, event Event) {
+	ctx, span := e.startPublish(ctx, "Publish", event)
+	defer span.End()
+	emsg := e.message(ctx, event)
+
+	for _, sub := range e.subscribers() {
+		if !sub.accepts(emsg) {
+			continue
+		}
+		sub.deliver(emsg, func(dropped EventMessage, reason string) {
+			e.drop(ctx, sub, dropped, reason)
+		})
+		e.logger.Debug("publish eventMessage", "type", emsg.Type, "subscriber", sub.id.String())
+	}
+	if e.publishCtr != nil {
+		e.publishCtr.Add(ctx, 1, metric.WithAttributes(attribute.String("type", emsg.Type)))
+	}
+}
+
+// PublishTo delivers event only to the subscribers registered under name,
+// e.g. to replay missed events to a single notifier.
+func (e *EventManager) PublishTo(ctx context.Context, name string, event Event) error {
+	ctx, span := e.startPublish(ctx, "PublishTo", event, attribute.String("subscriber", name))
+	defer span.End()
+	emsg := e.message(ctx, event)
+
+	var found bool
+	for _, sub := range e.subscribers() {
+		if sub.name != name {
+			continue
+		}
+		found = true
+		if !sub.accepts(emsg) {
+			continue
+		}
+		sub.deliver(emsg, func(dropped EventMessage, reason string) {
+			e.drop(ctx, sub, dropped, reason)
+		})
+	}
+	if !found {
+		err := fmt.Errorf("%w: %s", ErrUnknownSubscriber, name)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// subscribers returns the current subscribers. Events are delivered to them
+// without holding e.mu, as the Block policy may wait for a subscriber and
+// would hold up (un)subscribing meanwhile.
+func (e *EventManager) subscribers() []*subscriber {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	subs := make([]*subscriber, 0, len(e.subscriber))
+	for _, sub := range e.subscriber {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+func (e *EventManager) startPublish(
+	ctx context.Context,
+	name string,
+	event Event,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("event.type", event.Topic()))
+	return tracer.Start(ctx, name+" "+event.Topic(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
 	)
-	if err != nil {
-		return
+}
+
+func (e *EventManager) message(ctx context.Context, event Event) EventMessage {
+	return EventMessage{
+		Type:        event.Topic(),
+		Payload:     event,
+		SpanContext: trace.SpanContextFromContext(ctx),
 	}
+}
 
-	e.mu.Lock()
-	defer e.mu.Unlock()
+// Subscribers returns the sorted names of all current subscribers.
+func (e *EventManager) Subscribers() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	for subscriber, ch := range e.subscriber {
-		select {
-		case ch <- emsg:
-			eventCtr.Add(ctx, 1)
-			e.logger.Debug("publish eventMessage", "debug", "publish", subscriber.String(), fmt.Sprintf("%s", emsg))
-		default:
-			e.logger.Debug("channel blocked, skipping subscriber", "subscriber", subscriber.String())
+	seen := make(map[string]struct{})
+	var names []string
+	for _, sub := range e.subscriber {
+		if _, ok := seen[sub.name]; ok {
+			continue
 		}
+		seen[sub.name] = struct{}{}
+		names = append(names, sub.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *EventManager) drop(ctx context.Context, sub *subscriber, emsg EventMessage, reason string) {
+	if e.droppedCtr != nil {
+		e.droppedCtr.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("subscriber", sub.name),
+			attribute.String("policy", sub.policy.String()),
+		))
+	}
+	e.logger.Debug("dropped eventMessage", "type", emsg.Type, "subscriber", sub.name, "reason", reason)
+
+	e.mu.RLock()
+	deadLetter := e.deadLetter
+	e.mu.RUnlock()
+	if deadLetter != nil {
+		deadLetter(DeadLetter{
+			Subscriber: sub.name,
+			Policy:     sub.policy,
+			Reason:     reason,
+			Event:      emsg,
+		})
 	}
 }
 
-func (e *EventManager) StartListening(ctx context.Context, handler EventHandler, serviceName string, onSubscribe func()) {
-	id, ch := e.Subscribe(serviceName)
+// StartListening subscribes serviceName and passes every event to handler
+// until ctx is done. Each event is handled under panic recovery and the
+// handler timeout of the subscriber. A handler that timed out keeps the
+// subscriber paused until it returns, so the handlers of a subscriber never
+// run concurrently. After a panic the listener re-subscribes with an
+// exponential backoff before it handles the next event.
+func (e *EventManager) StartListening(
+	ctx context.Context,
+	handler EventHandler,
+	serviceName string,
+	onSubscribe func(),
+	opts ...SubscribeOption,
+) {
+	id, _ := e.Subscribe(serviceName, opts...)
 	if id == uuid.Nil {
 		return
 	}
-	defer e.Unsubscribe(id, serviceName)
+
+	e.mu.RLock()
+	sub := e.subscriber[id]
+	e.mu.RUnlock()
+	defer func() {
+		e.Unsubscribe(sub.id, serviceName)
+	}()
+	sub.health.setState(StateRunning)
 
 	onSubscribe()
 
@@ -98,8 +345,153 @@ func (e *EventManager) StartListening(ctx context.Context, handler EventHandler,
 		select {
 		case <-ctx.Done():
 			return
-		case event := <-ch:
-			handler.HandleEvent(ctx, event)
+		case event, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			running, err := e.handle(ctx, handler, sub, event)
+			if ctx.Err() != nil {
+				return
+			}
+			backoff := e.record(ctx, sub, event, err)
+			if running != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case err = <-running:
+				}
+				if err != nil {
+					backoff = e.record(ctx, sub, event, err)
+				}
+			}
+			if backoff > 0 {
+				sub, ok = e.restart(ctx, sub, backoff)
+				if !ok {
+					return
+				}
+			}
 		}
 	}
 }
+
+// handle runs handler in a child span of the span the event was published
+// in. Panics are returned as ErrHandlerPanic, handlers running longer than
+// the handler timeout as ErrHandlerTimeout. In the latter case the handler
+// is still running and its result is sent to the returned channel.
+func (e *EventManager) handle(
+	ctx context.Context,
+	handler EventHandler,
+	sub *subscriber,
+	event EventMessage,
+) (<-chan error, error) {
+	parent := trace.ContextWithRemoteSpanContext(ctx, event.SpanContext)
+	spanCtx, span := tracer.Start(parent, "HandleEvent "+event.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("event.type", event.Type),
+			attribute.String("subscriber", sub.name),
+		),
+	)
+	defer span.End()
+
+	handlerCtx, cancel := context.WithTimeout(spanCtx, sub.handlerTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+			}
+		}()
+		handler.HandleEvent(handlerCtx, event)
+		done <- nil
+	}()
+
+	var running <-chan error
+	var err error
+	select {
+	case err = <-done:
+	case <-handlerCtx.Done():
+		running = done
+		err = fmt.Errorf("%w after %s", ErrHandlerTimeout, sub.handlerTimeout)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return running, err
+}
+
+// record updates the health of sub after event was handled with err and
+// returns how long the listener has to pause.
+func (e *EventManager) record(ctx context.Context, sub *subscriber, event EventMessage, err error) time.Duration {
+	backoff := sub.health.record(err, time.Now(), sub.minBackoff, sub.maxBackoff)
+	if err != nil {
+		e.fail(ctx, sub, event, err)
+	}
+	return backoff
+}
+
+func (e *EventManager) fail(ctx context.Context, sub *subscriber, event EventMessage, err error) {
+	reason := "timeout"
+	if errors.Is(err, ErrHandlerPanic) {
+		reason = "panic"
+	}
+	if e.failedCtr != nil {
+		e.failedCtr.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("subscriber", sub.name),
+			attribute.String("reason", reason),
+		))
+	}
+	e.logger.ErrorContext(ctx, "event handler failed", "error", err, "type", event.Type, "subscriber", sub.name)
+}
+
+// restart replaces the subscription of the listener of sub by a new one
+// with the same options and pauses the listener for backoff. The events
+// still queued for the old subscription are dropped. It returns the new
+// subscriber and false if ctx was done in the meantime.
+func (e *EventManager) restart(ctx context.Context, sub *subscriber, backoff time.Duration) (*subscriber, bool) {
+	if e.restartCtr != nil {
+		e.restartCtr.Add(ctx, 1, metric.WithAttributes(attribute.String("subscriber", sub.name)))
+	}
+	e.logger.WarnContext(ctx, "restarting event listener", "subscriber", sub.name, "backoff", backoff)
+
+	sub = e.resubscribe(ctx, sub)
+	sub.health.setState(StateRestarting)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return sub, false
+	case <-timer.C:
+	}
+	sub.health.setState(StateRunning)
+	return sub, true
+}
+
+// resubscribe moves the listener of old to a new subscription with a fresh
+// buffer. Events published from now on are queued for the new subscription,
+// the backlog of the old one goes to the dead letter receiver.
+func (e *EventManager) resubscribe(ctx context.Context, old *subscriber) *subscriber {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		e.logger.ErrorContext(ctx, "failed to resubscribe", "error", err, "subscriber", old.name)
+		return old
+	}
+	sub := newSubscriber(id, old.name, old.opts...)
+	sub.health = old.health
+
+	e.mu.Lock()
+	delete(e.subscriber, old.id)
+	e.subscriber[id] = sub
+	e.mu.Unlock()
+	old.close()
+
+	for _, emsg := range old.drain() {
+		e.drop(ctx, old, emsg, "listener restarted")
+	}
+	e.logger.Info("service resubscribed to eventManager", "service id", id, "service name", sub.name)
+	return sub
+}
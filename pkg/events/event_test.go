@@ -6,9 +6,22 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
+type testEvent struct {
+	topic string
+	data  string
+}
+
+func (e testEvent) Topic() string { return e.topic }
+
 type MockHandler struct {
 	handledEvents []EventMessage
 	mu            sync.Mutex
@@ -25,12 +38,12 @@ func TestMultipleSubscribers(t *testing.T) {
 	_, ch1 := em.Subscribe("service-1")
 	_, ch2 := em.Subscribe("service-2")
 
-	go em.Publish(EventMessage{Type: "test-event", Payload: "test-payload"})
+	go em.Publish(context.Background(), testEvent{topic: "test-event", data: "test-payload"})
 
 	select {
 	case event := <-ch1:
 		assert.Equal(t, "test-event", event.Type)
-		assert.Equal(t, "test-payload", event.Payload)
+		assert.Equal(t, testEvent{topic: "test-event", data: "test-payload"}, event.Payload)
 	case <-time.After(1 * time.Second):
 		t.Fatal("timed out waiting for event for service-1")
 	}
@@ -38,7 +51,7 @@ func TestMultipleSubscribers(t *testing.T) {
 	select {
 	case event := <-ch2:
 		assert.Equal(t, "test-event", event.Type)
-		assert.Equal(t, "test-payload", event.Payload)
+		assert.Equal(t, testEvent{topic: "test-event", data: "test-payload"}, event.Payload)
 	case <-time.After(1 * time.Second):
 		t.Fatal("timed out waiting for event for service-2")
 	}
@@ -59,20 +72,20 @@ func TestStartListeningWithTimeout(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 	assert.True(t, subscribed, "subscribed should have been called")
 
-	em.Publish(EventMessage{Type: "test-event", Payload: "test-payload"})
+	em.Publish(context.Background(), testEvent{topic: "test-event", data: "test-payload"})
 
 	time.Sleep(100 * time.Millisecond)
 
 	mockHandler.mu.Lock()
 	assert.Len(t, mockHandler.handledEvents, 1)
 	assert.Equal(t, "test-event", mockHandler.handledEvents[0].Type)
-	assert.Equal(t, "test-payload", mockHandler.handledEvents[0].Payload)
+	assert.Equal(t, testEvent{topic: "test-event", data: "test-payload"}, mockHandler.handledEvents[0].Payload)
 	mockHandler.mu.Unlock()
 
 	<-ctx.Done()
 	assert.Equal(t, context.DeadlineExceeded, ctx.Err(), "context should have timed out")
 
-	em.Publish(EventMessage{Type: "after-ctx-done", Payload: "payload-after-ctx-done"})
+	em.Publish(context.Background(), testEvent{topic: "after-ctx-done", data: "payload-after-ctx-done"})
 
 	time.Sleep(100 * time.Millisecond)
 
@@ -80,3 +93,405 @@ func TestStartListeningWithTimeout(t *testing.T) {
 	assert.Len(t, mockHandler.handledEvents, 1, "no more events handled after ctx-done")
 	mockHandler.mu.Unlock()
 }
+
+func TestOn(t *testing.T) {
+	var joined []PlayerJoined
+	handler := On(func(ctx context.Context, e PlayerJoined) {
+		joined = append(joined, e)
+	})
+
+	handler.HandleEvent(context.Background(), EventMessage{Type: "player.joined", Payload: PlayerJoined{Name: "Alice"}})
+	handler.HandleEvent(context.Background(), EventMessage{Type: "player.left", Payload: PlayerLeft{Name: "Alice"}})
+
+	assert.Equal(t, []PlayerJoined{{Name: "Alice"}}, joined)
+}
+
+func TestTopics(t *testing.T) {
+	assert.Equal(t, "player.joined", PlayerJoined{}.Topic())
+	assert.Equal(t, "server.online", ServerStatusChanged{Online: true}.Topic())
+	assert.Equal(t, "server.offline", ServerStatusChanged{}.Topic())
+}
+
+func TestDeliveryPolicies(t *testing.T) {
+	publish := func(em *EventManager, n int) {
+		for i := 0; i < n; i++ {
+			em.Publish(context.Background(), testEvent{topic: "test-event", data: string(rune('a' + i))})
+		}
+	}
+	drain := func(ch <-chan EventMessage) []string {
+		var got []string
+		for {
+			select {
+			case event := <-ch:
+				got = append(got, event.Payload.(testEvent).data)
+			case <-time.After(50 * time.Millisecond):
+				return got
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		opts    []SubscribeOption
+		want    []string
+		dropped []string
+	}{
+		{
+			name:    "drop newest",
+			opts:    []SubscribeOption{WithBufferSize(2)},
+			want:    []string{"a", "b"},
+			dropped: []string{"c", "d"},
+		},
+		{
+			name:    "drop oldest",
+			opts:    []SubscribeOption{WithPolicy(DropOldest), WithBufferSize(2)},
+			want:    []string{"c", "d"},
+			dropped: []string{"a", "b"},
+		},
+		{
+			name:    "block with timeout",
+			opts:    []SubscribeOption{WithPolicy(Block), WithBufferSize(2), WithTimeout(10 * time.Millisecond)},
+			want:    []string{"a", "b"},
+			dropped: []string{"c", "d"},
+		},
+		{
+			name: "unbounded",
+			opts: []SubscribeOption{WithPolicy(Unbounded), WithBufferSize(0)},
+			want: []string{"a", "b", "c", "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			em := NewEventManager()
+			var dropped []string
+			em.SetDeadLetter(func(dl DeadLetter) {
+				assert.Equal(t, "slow", dl.Subscriber)
+				dropped = append(dropped, dl.Event.Payload.(testEvent).data)
+			})
+
+			id, ch := em.Subscribe("slow", tt.opts...)
+			publish(em, 4)
+
+			assert.Equal(t, tt.want, drain(ch))
+			assert.Equal(t, tt.dropped, dropped)
+
+			em.Unsubscribe(id, "slow")
+			_, ok := <-ch
+			assert.False(t, ok, "channel should be closed after unsubscribe")
+		})
+	}
+}
+
+func TestBlockWaitsForSubscriber(t *testing.T) {
+	em := NewEventManager()
+	var dropped int
+	em.SetDeadLetter(func(DeadLetter) { dropped++ })
+
+	_, ch := em.Subscribe("slow", WithPolicy(Block), WithBufferSize(0), WithTimeout(time.Second))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-ch
+	}()
+	em.Publish(context.Background(), testEvent{topic: "test-event", data: "test-payload"})
+
+	assert.Equal(t, 0, dropped)
+}
+
+func TestBlockDoesNotHoldUpSubscribers(t *testing.T) {
+	em := NewEventManager()
+	var mu sync.Mutex
+	var reasons []string
+	em.SetDeadLetter(func(dl DeadLetter) {
+		mu.Lock()
+		defer mu.Unlock()
+		reasons = append(reasons, dl.Reason)
+	})
+
+	stalled, _ := em.Subscribe("stalled", WithPolicy(Block), WithBufferSize(0), WithTimeout(time.Minute))
+	published := make(chan struct{})
+	go func() {
+		em.Publish(context.Background(), testEvent{topic: "test-event"})
+		close(published)
+	}()
+	// let Publish block on the stalled subscriber
+	time.Sleep(50 * time.Millisecond)
+
+	unsubscribed := make(chan struct{})
+	go func() {
+		id, _ := em.Subscribe("other")
+		em.Unsubscribe(id, "other")
+		close(unsubscribed)
+	}()
+	select {
+	case <-unsubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("blocked Publish held up Subscribe and Unsubscribe")
+	}
+
+	em.Unsubscribe(stalled, "stalled")
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe did not wake the blocked Publish")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"unsubscribed"}, reasons)
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"player.*", "player.joined", true},
+		{"player.*", "player.left", true},
+		{"player.*", "server.online", false},
+		{"player.*", "player", false},
+		{"server.offline", "server.offline", true},
+		{"server.offline", "server.online", false},
+		{"*.online", "server.online", true},
+		{"*", "init", true},
+		{"*", "init.services", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MatchTopic(tt.pattern, tt.topic), "%s ~ %s", tt.pattern, tt.topic)
+	}
+}
+
+func TestSubscribeWithTopicsAndPredicates(t *testing.T) {
+	em := NewEventManager()
+	serverID := uuid.New()
+
+	_, players := em.Subscribe("players", WithTopics("player.*"), WithBufferSize(10))
+	_, offline := em.Subscribe("offline", WithTopics("server.offline"), WithBufferSize(10))
+	_, server := em.Subscribe("server", WithPredicate(ForServer(serverID)), WithBufferSize(10))
+	_, all := em.Subscribe("all", WithBufferSize(10))
+
+	em.Publish(context.Background(), PlayerJoined{ServerID: serverID, Name: "Alice"})
+	em.Publish(context.Background(), PlayerLeft{ServerID: uuid.New(), Name: "Bob"})
+	em.Publish(context.Background(), ServerStatusChanged{Server: &model.Server{ID: serverID}})
+	em.Publish(context.Background(), ServerStatusChanged{Server: &model.Server{ID: serverID}, Online: true})
+	em.Publish(context.Background(), Init{})
+
+	assert.Len(t, players, 2)
+	assert.Len(t, offline, 1)
+	assert.Len(t, server, 3)
+	assert.Len(t, all, 5)
+
+	err := em.PublishTo(context.Background(), "offline", PlayerJoined{ServerID: serverID})
+	assert.NoError(t, err)
+	assert.Len(t, offline, 1, "PublishTo respects the topic filter")
+}
+
+var (
+	recorder     = tracetest.NewSpanRecorder()
+	provider     = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	setupTracing sync.Once
+)
+
+func TestStartListeningContinuesTrace(t *testing.T) {
+	// the package tracer keeps delegating to the first provider set
+	setupTracing.Do(func() { otel.SetTracerProvider(provider) })
+
+	em := NewEventManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan trace.SpanContext, 1)
+	subscribed := make(chan struct{})
+	go em.StartListening(ctx, HandlerFunc(func(ctx context.Context, event EventMessage) {
+		handled <- trace.SpanContextFromContext(ctx)
+	}), "test-service", func() { close(subscribed) })
+	<-subscribed
+
+	requestCtx, request := provider.Tracer("test").Start(context.Background(), "request")
+	em.Publish(requestCtx, testEvent{topic: "test-event"})
+	request.End()
+
+	var handlerSpan trace.SpanContext
+	select {
+	case handlerSpan = <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	assert.Equal(t, request.SpanContext().TraceID(), handlerSpan.TraceID(), "handler continues the trace of the publisher")
+	var publish, handle sdktrace.ReadOnlySpan
+	assert.Eventually(t, func() bool {
+		for _, span := range recorder.Ended() {
+			if span.SpanContext().TraceID() != request.SpanContext().TraceID() {
+				continue
+			}
+			switch span.Name() {
+			case "Publish test-event":
+				publish = span
+			case "HandleEvent test-event":
+				handle = span
+			}
+		}
+		return publish != nil && handle != nil
+	}, time.Second, 10*time.Millisecond)
+	if publish != nil && handle != nil {
+		assert.Equal(t, request.SpanContext().SpanID(), publish.Parent().SpanID())
+		assert.Equal(t, publish.SpanContext().SpanID(), handle.Parent().SpanID())
+		assert.Equal(t, handlerSpan.SpanID(), handle.SpanContext().SpanID())
+	}
+}
+
+func TestStartListeningRecoversPanics(t *testing.T) {
+	em := NewEventManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan string, 3)
+	handler := HandlerFunc(func(_ context.Context, event EventMessage) {
+		if event.Type == "panic" {
+			panic("boom")
+		}
+		handled <- event.Type
+	})
+
+	subscribed := make(chan struct{})
+	go em.StartListening(ctx, handler, "test-service", func() { close(subscribed) },
+		WithPolicy(Unbounded), WithRestartBackoff(50*time.Millisecond, 100*time.Millisecond))
+	<-subscribed
+
+	em.Publish(ctx, testEvent{topic: "panic"})
+	assert.Eventually(t, func() bool {
+		health := em.Health()
+		return len(health) == 1 && health[0].State == StateRestarting
+	}, time.Second, 5*time.Millisecond)
+
+	health := em.Health()[0]
+	assert.False(t, health.Healthy)
+	assert.Equal(t, int64(1), health.Panics)
+	assert.Equal(t, int64(1), health.Restarts)
+	assert.Contains(t, health.LastError, "boom")
+
+	em.Publish(ctx, testEvent{topic: "after-panic"})
+	select {
+	case topic := <-handled:
+		assert.Equal(t, "after-panic", topic)
+	case <-time.After(time.Second):
+		t.Fatal("listener was not restarted")
+	}
+
+	assert.Eventually(t, func() bool { return em.Health()[0].Healthy }, time.Second, 5*time.Millisecond)
+	health = em.Health()[0]
+	assert.Equal(t, StateRunning, health.State)
+	assert.Equal(t, int64(1), health.Handled)
+}
+
+func TestStartListeningHandlerTimeout(t *testing.T) {
+	em := NewEventManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+	handler := HandlerFunc(func(ctx context.Context, event EventMessage) {
+		if event.Type == "slow" {
+			<-release
+		}
+		handled <- event.Type
+	})
+
+	subscribed := make(chan struct{})
+	go em.StartListening(ctx, handler, "test-service", func() { close(subscribed) },
+		WithPolicy(Unbounded), WithHandlerTimeout(50*time.Millisecond))
+	<-subscribed
+
+	em.Publish(ctx, testEvent{topic: "slow"})
+	em.Publish(ctx, testEvent{topic: "fast"})
+
+	assert.Eventually(t, func() bool { return em.Health()[0].Timeouts == 1 }, time.Second, 5*time.Millisecond)
+	health := em.Health()[0]
+	assert.False(t, health.Healthy)
+	assert.Equal(t, int64(0), health.Restarts)
+	assert.Contains(t, health.LastError, ErrHandlerTimeout.Error())
+
+	select {
+	case topic := <-handled:
+		t.Fatalf("%s was handled while the slow handler was running", topic)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	for _, want := range []string{"slow", "fast"} {
+		select {
+		case topic := <-handled:
+			assert.Equal(t, want, topic)
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not handled", want)
+		}
+	}
+}
+
+func TestStartListeningResubscribes(t *testing.T) {
+	em := NewEventManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var dropped []DeadLetter
+	em.SetDeadLetter(func(dl DeadLetter) {
+		mu.Lock()
+		defer mu.Unlock()
+		dropped = append(dropped, dl)
+	})
+
+	release := make(chan struct{})
+	handled := make(chan string, 1)
+	handler := HandlerFunc(func(_ context.Context, event EventMessage) {
+		if event.Type == "panic" {
+			<-release
+			panic("boom")
+		}
+		handled <- event.Type
+	})
+
+	subscribed := make(chan struct{})
+	go em.StartListening(ctx, handler, "test-service", func() { close(subscribed) },
+		WithPolicy(Unbounded), WithRestartBackoff(10*time.Millisecond, 10*time.Millisecond))
+	<-subscribed
+
+	em.Publish(ctx, testEvent{topic: "panic"})
+	em.Publish(ctx, testEvent{topic: "queued"})
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(dropped) == 1
+	}, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, "queued", dropped[0].Event.Type)
+	assert.Equal(t, "listener restarted", dropped[0].Reason)
+	mu.Unlock()
+
+	em.Publish(ctx, testEvent{topic: "after-restart"})
+	select {
+	case topic := <-handled:
+		assert.Equal(t, "after-restart", topic)
+	case <-time.After(time.Second):
+		t.Fatal("listener did not resubscribe")
+	}
+	assert.Equal(t, []string{"test-service"}, em.Subscribers())
+	assert.Equal(t, int64(1), em.Health()[0].Restarts)
+}
+
+func TestHealthRestartBackoff(t *testing.T) {
+	var h health
+	now := time.Now()
+	panicked := ErrHandlerPanic
+
+	assert.Equal(t, time.Second, h.record(panicked, now, time.Second, 3*time.Second))
+	assert.Equal(t, 2*time.Second, h.record(panicked, now, time.Second, 3*time.Second))
+	assert.Equal(t, 3*time.Second, h.record(panicked, now, time.Second, 3*time.Second))
+	assert.Equal(t, time.Duration(0), h.record(ErrHandlerTimeout, now, time.Second, 3*time.Second))
+	assert.Equal(t, time.Duration(0), h.record(nil, now, time.Second, 3*time.Second))
+	assert.Equal(t, time.Second, h.record(panicked, now, time.Second, 3*time.Second), "success resets the backoff")
+}
@@ -0,0 +1,178 @@
+package events
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHandlerTimeout = 30 * time.Second
+	MinRestartBackoff     = time.Second
+	MaxRestartBackoff     = time.Minute
+)
+
+var (
+	ErrHandlerPanic   = errors.New("event handler panicked")
+	ErrHandlerTimeout = errors.New("event handler timed out")
+)
+
+// State of a subscriber as reported by Health.
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateIdle       = "idle"
+)
+
+// Health is the state of a single subscriber. Listeners started with
+// StartListening are running or restarting, plain subscribers are idle.
+// Healthy is false while the last handled event failed.
+type Health struct {
+	Subscriber  string     `json:"subscriber"`
+	Policy      string     `json:"policy"`
+	State       string     `json:"state"`
+	Healthy     bool       `json:"healthy"`
+	Queued      int        `json:"queued"`
+	Handled     int64      `json:"handled"`
+	Panics      int64      `json:"panics"`
+	Timeouts    int64      `json:"timeouts"`
+	Restarts    int64      `json:"restarts"`
+	LastEvent   *time.Time `json:"lastEvent,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// HealthReporter reports the health of all subscribers.
+type HealthReporter interface {
+	Health() []Health
+}
+
+// WithHandlerTimeout sets how long StartListening waits for the handler of
+// a single event. A handler that exceeds it is reported as failed and its
+// context is cancelled, the listener waits for it to return before it
+// handles the next event.
+func WithHandlerTimeout(timeout time.Duration) SubscribeOption {
+	return func(s *subscriber) {
+		if timeout > 0 {
+			s.handlerTimeout = timeout
+		}
+	}
+}
+
+// WithRestartBackoff sets the minimum and maximum time a listener pauses
+// after its handler panicked, before it resumes on a new subscription. The
+// pause doubles with every consecutive panic and is reset by the first
+// successfully handled event.
+func WithRestartBackoff(min time.Duration, max time.Duration) SubscribeOption {
+	return func(s *subscriber) {
+		if min > 0 && max >= min {
+			s.minBackoff = min
+			s.maxBackoff = max
+		}
+	}
+}
+
+// health is the mutable part of Health, guarded by its own mutex as it is
+// written by the listener while Publish reads the subscriber.
+type health struct {
+	mu        sync.Mutex
+	state     string
+	failed    bool
+	backoff   time.Duration
+	handled   int64
+	panics    int64
+	timeouts  int64
+	restarts  int64
+	lastEvent time.Time
+	lastError string
+	errorAt   time.Time
+}
+
+func (h *health) setState(state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = state
+}
+
+// record updates the counters after an event was handled with err. It
+// returns how long the listener has to pause, which is zero unless the
+// handler panicked.
+func (h *health) record(err error, now time.Time, min time.Duration, max time.Duration) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastEvent = now
+	if err == nil {
+		h.handled++
+		h.failed = false
+		h.backoff = 0
+		return 0
+	}
+
+	h.failed = true
+	h.lastError = err.Error()
+	h.errorAt = now
+	if !errors.Is(err, ErrHandlerPanic) {
+		h.timeouts++
+		return 0
+	}
+
+	h.panics++
+	h.restarts++
+	switch {
+	case h.backoff == 0:
+		h.backoff = min
+	case h.backoff*2 > max:
+		h.backoff = max
+	default:
+		h.backoff *= 2
+	}
+	return h.backoff
+}
+
+func (h *health) snapshot(sub *subscriber) Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.state
+	if state == "" {
+		state = StateIdle
+	}
+	return Health{
+		Subscriber:  sub.name,
+		Policy:      sub.policy.String(),
+		State:       state,
+		Healthy:     state != StateRestarting && !h.failed,
+		Queued:      sub.queued(),
+		Handled:     h.handled,
+		Panics:      h.panics,
+		Timeouts:    h.timeouts,
+		Restarts:    h.restarts,
+		LastEvent:   timeOrNil(h.lastEvent),
+		LastError:   h.lastError,
+		LastErrorAt: timeOrNil(h.errorAt),
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Health returns the health of every subscriber sorted by name.
+func (e *EventManager) Health() []Health {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	healths := make([]Health, 0, len(e.subscriber))
+	for _, sub := range e.subscriber {
+		healths = append(healths, sub.health.snapshot(sub))
+	}
+	sort.Slice(healths, func(i, j int) bool {
+		return healths[i].Subscriber < healths[j].Subscriber
+	})
+	return healths
+}
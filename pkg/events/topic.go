@@ -0,0 +1,74 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Predicate decides whether a subscriber receives an event whose topic
+// matched.
+type Predicate func(Event) bool
+
+// MatchTopic reports whether topic matches pattern. Both are split into
+// dot-separated segments, a "*" segment in pattern matches exactly one
+// segment of topic, so "player.*" matches "player.joined" but not "player".
+func MatchTopic(pattern string, topic string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	topicSegments := strings.Split(topic, ".")
+	if len(patternSegments) != len(topicSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if segment != "*" && segment != topicSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WithTopics limits the subscriber to events whose topic matches one of
+// patterns, see MatchTopic. Without it a subscriber receives every event.
+func WithTopics(patterns ...string) SubscribeOption {
+	return func(s *subscriber) {
+		s.topics = append(s.topics, patterns...)
+	}
+}
+
+// WithPredicate limits the subscriber to events for which predicate returns
+// true. Multiple predicates must all match.
+func WithPredicate(predicate Predicate) SubscribeOption {
+	return func(s *subscriber) {
+		s.predicates = append(s.predicates, predicate)
+	}
+}
+
+// ForServer is a Predicate matching events about the server with id.
+func ForServer(id uuid.UUID) Predicate {
+	return func(event Event) bool {
+		return ServerOf(event) == id
+	}
+}
+
+// accepts reports whether emsg passes the topic patterns and predicates of
+// the subscriber.
+func (s *subscriber) accepts(emsg EventMessage) bool {
+	if len(s.topics) > 0 {
+		var matched bool
+		for _, pattern := range s.topics {
+			if MatchTopic(pattern, emsg.Type) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, predicate := range s.predicates {
+		if !predicate(emsg.Payload) {
+			return false
+		}
+	}
+	return true
+}
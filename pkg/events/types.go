@@ -0,0 +1,138 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/led0nk/ark-overseer/internal/model"
+)
+
+// Event is implemented by every event published on the EventManager. Topic
+// names the kind of event, e.g. "player.joined".
+type Event interface {
+	Topic() string
+}
+
+// Init starts the observer once all listeners are subscribed.
+type Init struct{}
+
+func (Init) Topic() string { return "init" }
+
+// ServicesInit creates the notification services from Section, the
+// notification-service section of the config.
+type ServicesInit struct {
+	Section map[interface{}]interface{} `json:"-"`
+}
+
+func (ServicesInit) Topic() string { return "init.services" }
+
+// ConfigChanged is published after Key in Section of the config was
+// updated. Values holds the whole section with decrypted secrets and is
+// therefore never encoded.
+type ConfigChanged struct {
+	Section string
+	Key     string
+	Values  map[interface{}]interface{} `json:"-"`
+}
+
+func (ConfigChanged) Topic() string { return "config.changed" }
+
+// ServerAdded is published after a server definition was created.
+type ServerAdded struct {
+	Server *model.Server
+}
+
+func (ServerAdded) Topic() string { return "server.added" }
+
+// ServerDeleted is published when a server definition is deleted.
+type ServerDeleted struct {
+	ServerID uuid.UUID
+}
+
+func (ServerDeleted) Topic() string { return "server.deleted" }
+
+// ServerStatusChanged is published when a scrape finds a server online
+// after being offline or the other way round.
+type ServerStatusChanged struct {
+	Server *model.Server
+	Online bool
+}
+
+func (e ServerStatusChanged) Topic() string {
+	if e.Online {
+		return "server.online"
+	}
+	return "server.offline"
+}
+
+// PlayerJoined is published when a player matching a watchlist entry joins
+// a server. Name is the name the player used, Entry the matched entry. The
+// server fields describe the server as seen by the scrape that noticed the
+// player, ConnectAddr is the address players connect to.
+type PlayerJoined struct {
+	ServerID    uuid.UUID
+	ServerName  string
+	ServerAddr  string
+	ConnectAddr string
+	Map         string
+	Players     int
+	MaxPlayers  int
+	Name        string
+	Entry       *model.BlacklistPlayers
+	Time        time.Time
+}
+
+func (PlayerJoined) Topic() string { return "player.joined" }
+
+// PlayerLeft is published when a tracked player left a server, with the
+// same server fields as PlayerJoined.
+type PlayerLeft struct {
+	ServerID    uuid.UUID
+	ServerName  string
+	ServerAddr  string
+	ConnectAddr string
+	Map         string
+	Players     int
+	MaxPlayers  int
+	Name        string
+	Entry       *model.BlacklistPlayers
+	Time        time.Time
+}
+
+func (PlayerLeft) Topic() string { return "player.left" }
+
+// ServerOf returns the ID of the server event is about, or uuid.Nil for
+// events that do not concern a single server.
+func ServerOf(event Event) uuid.UUID {
+	switch e := event.(type) {
+	case ServerAdded:
+		if e.Server != nil {
+			return e.Server.ID
+		}
+	case ServerDeleted:
+		return e.ServerID
+	case ServerStatusChanged:
+		if e.Server != nil {
+			return e.Server.ID
+		}
+	case PlayerJoined:
+		return e.ServerID
+	case PlayerLeft:
+		return e.ServerID
+	}
+	return uuid.Nil
+}
+
+// Topics returns the topics of all events that are published on their own,
+// in the order of their lifecycle.
+func Topics() []string {
+	return []string{
+		ServerAdded{}.Topic(),
+		ServerDeleted{}.Topic(),
+		ServerStatusChanged{Online: true}.Topic(),
+		ServerStatusChanged{Online: false}.Topic(),
+		PlayerJoined{}.Topic(),
+		PlayerLeft{}.Topic(),
+		ConfigChanged{}.Topic(),
+	}
+}
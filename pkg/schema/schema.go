@@ -0,0 +1,254 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Codec encodes and decodes the on-disk representation of a file.
+type Codec interface {
+	Marshal(any) ([]byte, error)
+	Unmarshal([]byte, any) error
+}
+
+var (
+	JSON Codec = jsonCodec{}
+	YAML Codec = yamlCodec{}
+)
+
+// Migration upgrades the data of a file from version From to From+1. Apply
+// receives the data as decoded by the codec of the registry, e.g.
+// map[string]any for JSON and map[interface{}]interface{} for YAML.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(any) (any, error)
+}
+
+// Registry holds the migrations of one file type. Files without an envelope
+// are treated as version 0.
+type Registry struct {
+	name       string
+	codec      Codec
+	migrations []Migration
+}
+
+type envelope struct {
+	Version int `json:"version" yaml:"version"`
+	Data    any `json:"data" yaml:"data"`
+}
+
+// NewRegistry creates a registry whose current version equals the number of
+// migrations. The migrations must be given in order without gaps.
+func NewRegistry(name string, codec Codec, migrations ...Migration) *Registry {
+	for i, migration := range migrations {
+		if migration.From != i {
+			panic(fmt.Sprintf("schema %s: migration %d starts at version %d", name, i, migration.From))
+		}
+	}
+	return &Registry{
+		name:       name,
+		codec:      codec,
+		migrations: migrations,
+	}
+}
+
+func (r *Registry) Name() string {
+	return r.name
+}
+
+// Version returns the current schema version.
+func (r *Registry) Version() int {
+	return len(r.migrations)
+}
+
+// Plan returns the version of raw and the migrations needed to bring it to
+// the current version.
+func (r *Registry) Plan(raw []byte) (int, []Migration, error) {
+	version, _, err := r.open(raw)
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, r.migrations[version:], nil
+}
+
+// Upgrade migrates raw to the current version and returns the bare data
+// together with the version raw was stored in.
+func (r *Registry) Upgrade(raw []byte) (any, int, error) {
+	version, data, err := r.open(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, migration := range r.migrations[version:] {
+		data, err = migration.Apply(data)
+		if err != nil {
+			return nil, 0, fmt.Errorf(
+				"schema %s: migration from version %d failed: %w",
+				r.name, migration.From, err,
+			)
+		}
+	}
+	return data, version, nil
+}
+
+// Decode upgrades raw and unmarshals the data into v. It returns the version
+// raw was stored in.
+func (r *Registry) Decode(raw []byte, v any) (int, error) {
+	data, version, err := r.Upgrade(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	payload, err := r.codec.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	return version, r.codec.Unmarshal(payload, v)
+}
+
+// Encode wraps v into an envelope of the current version.
+func (r *Registry) Encode(v any) ([]byte, error) {
+	return r.codec.Marshal(envelope{Version: r.Version(), Data: v})
+}
+
+// Migrate upgrades raw and returns it encoded in the current version.
+func (r *Registry) Migrate(raw []byte) ([]byte, int, error) {
+	data, version, err := r.Upgrade(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	migrated, err := r.Encode(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return migrated, version, nil
+}
+
+func (r *Registry) open(raw []byte) (int, any, error) {
+	var decoded any
+	err := r.codec.Unmarshal(raw, &decoded)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	version, data, ok := unwrap(decoded)
+	if !ok {
+		return 0, decoded, nil
+	}
+	if version > r.Version() {
+		return 0, nil, fmt.Errorf(
+			"schema %s: file version %d is newer than the supported version %d",
+			r.name, version, r.Version(),
+		)
+	}
+	if version < 0 {
+		return 0, nil, fmt.Errorf("schema %s: invalid version %d", r.name, version)
+	}
+	return version, data, nil
+}
+
+// unwrap returns the content of an envelope. Anything but a map holding
+// exactly a numeric version and data is not an envelope.
+func unwrap(decoded any) (int, any, bool) {
+	fields := make(map[string]any)
+	switch m := decoded.(type) {
+	case map[string]any:
+		fields = m
+	case map[interface{}]interface{}:
+		for key, value := range m {
+			name, ok := key.(string)
+			if !ok {
+				return 0, nil, false
+			}
+			fields[name] = value
+		}
+	default:
+		return 0, nil, false
+	}
+
+	if len(fields) != 2 {
+		return 0, nil, false
+	}
+	data, ok := fields["data"]
+	if !ok {
+		return 0, nil, false
+	}
+
+	switch version := fields["version"].(type) {
+	case int:
+		return version, data, true
+	case float64:
+		if version != float64(int(version)) {
+			return 0, nil, false
+		}
+		return int(version), data, true
+	default:
+		return 0, nil, false
+	}
+}
+
+// BackupPath returns the name of the copy kept before a file of the given
+// version is migrated.
+func BackupPath(filename string, version int) string {
+	return filename + ".v" + strconv.Itoa(version) + ".pre-migration"
+}
+
+// Backup copies filename to BackupPath. An existing backup of the same
+// version is never overwritten.
+func Backup(filename string, version int) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(BackupPath(filename, version), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "\t")
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type yamlCodec struct{}
+
+func (yamlCodec) Marshal(v any) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func (yamlCodec) Unmarshal(data []byte, v any) error {
+	return yaml.Unmarshal(data, v)
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func renameField(data any) (any, error) {
+	m, ok := data.(map[string]any)
+	if !ok {
+		return nil, errors.New("not an object")
+	}
+	m["renamed"] = m["old"]
+	delete(m, "old")
+	return m, nil
+}
+
+var testRegistry = NewRegistry(
+	"test.json",
+	JSON,
+	Migration{From: 0, Description: "wrap", Apply: func(data any) (any, error) { return data, nil }},
+	Migration{From: 1, Description: "rename old to renamed", Apply: renameField},
+)
+
+func TestRegistryDecode(t *testing.T) {
+	tests := []struct {
+		name            string
+		raw             string
+		expectedVersion int
+		expectedSteps   int
+		expected        map[string]string
+		expectErr       bool
+	}{
+		{
+			name:            "legacy file without envelope",
+			raw:             `{"old": "value"}`,
+			expectedVersion: 0,
+			expectedSteps:   2,
+			expected:        map[string]string{"renamed": "value"},
+		},
+		{
+			name:            "envelope of version 1",
+			raw:             `{"version": 1, "data": {"old": "value"}}`,
+			expectedVersion: 1,
+			expectedSteps:   1,
+			expected:        map[string]string{"renamed": "value"},
+		},
+		{
+			name:            "current envelope",
+			raw:             `{"version": 2, "data": {"renamed": "value"}}`,
+			expectedVersion: 2,
+			expectedSteps:   0,
+			expected:        map[string]string{"renamed": "value"},
+		},
+		{
+			name:      "newer version",
+			raw:       `{"version": 3, "data": {}}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, steps, err := testRegistry.Plan([]byte(tt.raw))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVersion, version)
+			assert.Len(t, steps, tt.expectedSteps)
+
+			var result map[string]string
+			version, err = testRegistry.Decode([]byte(tt.raw), &result)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVersion, version)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestRegistryEncodeRoundTrip(t *testing.T) {
+	encoded, err := testRegistry.Encode(map[string]string{"renamed": "value"})
+	assert.NoError(t, err)
+
+	version, steps, err := testRegistry.Plan(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, testRegistry.Version(), version)
+	assert.Empty(t, steps)
+}
+
+func TestRegistryYAML(t *testing.T) {
+	registry := NewRegistry(
+		"test.yaml",
+		YAML,
+		Migration{From: 0, Description: "wrap", Apply: func(data any) (any, error) { return data, nil }},
+	)
+
+	migrated, version, err := registry.Migrate([]byte("notification-service:\n  discord:\n    token: abc\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	var result map[interface{}]interface{}
+	version, err = registry.Decode(migrated, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Contains(t, result, "notification-service")
+}
+
+func TestBackup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "schema_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "cluster.json")
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"old": "value"}`), 0644))
+
+	assert.NoError(t, Backup(filename, 0))
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"changed": true}`), 0644))
+	assert.NoError(t, Backup(filename, 0))
+
+	data, err := os.ReadFile(BackupPath(filename, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"old": "value"}`, string(data), "existing backups must not be overwritten")
+}